@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+)
+
+// checkConfig validates flags, the config file, access to the api server and the kubelet of the node like the exporter would use
+// them, and prints every failed check with a hint. It returns a non-zero exit code if any check failed.
+func checkConfig() int {
+	var results []preflight.Result
+	for _, err := range validateFlags() {
+		results = append(results, preflight.Result{Name: "flags", Err: err, Hint: "fix the flag value, see -help"})
+	}
+
+	configResult := preflight.Result{Name: "config file", Hint: "fix the config file, see the README for the settings"}
+	if configFile != "" {
+		configResult.Name += " " + configFile
+	}
+	_, configResult.Err = loadConfig()
+	results = append(results, configResult)
+	if apiTokenFile != "" {
+		tokenResult := preflight.Result{Name: "api token file " + apiTokenFile, Hint: "mount a file containing a token per line, e.g. from a Secret"}
+		_, tokenResult.Err = loadAPITokens()
+		results = append(results, tokenResult)
+	}
+	if snmpCommunityFile != "" {
+		communityResult := preflight.Result{Name: "snmp community file " + snmpCommunityFile, Hint: "mount a file containing the community, e.g. from a Secret"}
+		_, communityResult.Err = loadSNMPCommunity()
+		results = append(results, communityResult)
+	}
+	if ephemeralMetricsCAFile != "" {
+		caResult := preflight.Result{Name: "ephemeral metrics api client ca file " + ephemeralMetricsCAFile, Hint: "mount the requestheader client CA of the api server, e.g. from the extension-apiserver-authentication ConfigMap"}
+		_, caResult.Err = loadEphemeralMetricsCA()
+		results = append(results, caResult)
+	}
+	if adminTokenFile != "" {
+		tokenResult := preflight.Result{Name: "admin token file " + adminTokenFile, Hint: "mount a file containing the token, e.g. from a Secret"}
+		_, tokenResult.Err = loadAdminToken()
+		results = append(results, tokenResult)
+	}
+
+	clientResult := preflight.Result{Name: "api server client", Hint: "check -kubeconfig, -context and -apiserver, or the in-cluster service account"}
+	var cli kubernetes.Interface
+	cfg, err := restConfig()
+	if err == nil {
+		cli, err = kubernetes.NewForConfig(cfg)
+	}
+	clientResult.Err = err
+	results = append(results, clientResult)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if len(clusters) > 0 {
+		results = append(results, checkClusters(ctx)...)
+	} else if cli != nil {
+		results = append(results, checkNode(ctx, cli, cfg)...)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.OK() {
+			fmt.Printf("[OK]   %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("[FAIL] %s: %v\n       hint: %s\n", result.Name, result.Err, result.Hint)
+	}
+	if failed > 0 {
+		fmt.Printf("%d check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+func checkNode(ctx context.Context, cli kubernetes.Interface, cfg *rest.Config) []preflight.Result {
+	nodeResult := preflight.Result{Name: "node name", Hint: "set -node-name, or CURRENT_NODE_NAME from spec.nodeName with the downward API"}
+	node, err := resolveNodeName(ctx, cli)
+	if err != nil {
+		nodeResult.Err = err
+		return []preflight.Result{nodeResult}
+	}
+	nodeResult.Name += " " + node
+	results := []preflight.Result{nodeResult}
+	results = append(results, preflight.CheckAccess(ctx, cli, preflight.RequiredPermissions(node, podInformerEnabled(), kubeletAddressTypes != ""))...)
+	kubelet, err := kubeletClient(cli, cfg)
+	if err != nil {
+		return append(results, preflight.Result{Name: "kubelet client", Err: err, Hint: "fix the -kubelet flags, see -help"})
+	}
+	return append(results, preflight.CheckKubelet(ctx, cli, kubelet, node))
+}
+
+func checkClusters(ctx context.Context) []preflight.Result {
+	var results []preflight.Result
+	for _, c := range clusters {
+		clientResult := preflight.Result{Name: "cluster " + c.name + " client", Hint: "check that the kubeconfig has the context " + c.context}
+		var cli kubernetes.Interface
+		cfg, err := contextConfig(c.context)
+		if err == nil {
+			cli, err = kubernetes.NewForConfig(cfg)
+		}
+		clientResult.Err = err
+		results = append(results, clientResult)
+		if cli == nil {
+			continue
+		}
+		for _, result := range preflight.CheckAccess(ctx, cli, preflight.ClusterPermissions()) {
+			result.Name = "cluster " + c.name + " " + result.Name
+			results = append(results, result)
+		}
+	}
+	return results
+}
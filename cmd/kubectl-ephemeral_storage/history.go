@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// history polls the ephemeral storage of a pod or node and prints a row per stat summary with its growth, to
+// watch a pod fill its disk without a Prometheus.
+func history(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	var kube kubeFlags
+	kube.register(fs)
+	interval := fs.Duration("interval", 10*time.Second, "Interval at which the stat summary is requested. The kubelet refreshes disk stats about every minute.")
+	count := fs.Int("count", 0, "Number of rows to print, until interrupted when 0.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kubectl %s history [node/]NAME [flags]\n", pluginName)
+		fs.PrintDefaults()
+	}
+	positional, err := parse(fs, args)
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || *interval <= 0 || *count < 0 || kube.allNamespaces {
+		fs.Usage()
+		return 2
+	}
+	cli, namespace, err := kube.client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var node, pod string
+	if name, ok := cutPrefix(positional[0], "node/", "nodes/", "no/"); ok {
+		node = name
+	} else {
+		pod, _ = cutPrefix(positional[0], "pod/", "pods/", "po/")
+		obj, err := cli.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		if obj.Spec.NodeName == "" {
+			fmt.Fprintf(os.Stderr, "error: pod %s/%s is not scheduled\n", namespace, pod)
+			return 1
+		}
+		node = obj.Spec.NodeName
+	}
+
+	// Rows are printed as they come, so the columns have a fixed width instead of a tabwriter.
+	const format = "%-25s   %-8s   %-9s   %s\n"
+	fmt.Printf(format, "TIME", "USED", "DELTA", "RATE")
+	var previous uint64
+	var previousTime time.Time
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for rows := 0; *count == 0 || rows < *count; {
+		used, at, err := historyUsage(ctx, cli, node, namespace, pod)
+		switch {
+		case ctx.Err() != nil:
+			return 0
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		case at.Equal(previousTime):
+			// The kubelet did not refresh its stats since the previous row.
+		default:
+			delta, rate := "-", "-"
+			if !previousTime.IsZero() {
+				change := int64(used) - int64(previous)
+				delta = formatDelta(change)
+				rate = formatDelta(int64(float64(change)/at.Sub(previousTime).Seconds())) + "/s"
+			}
+			fmt.Printf(format, at.Local().Format(time.RFC3339), formatBytes(used), delta, rate)
+			previous, previousTime = used, at
+			rows++
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+	return 0
+}
+
+// historyUsage returns the used bytes of the pod, or of the node filesystem if pod is empty, and the time of the
+// stats.
+func historyUsage(ctx context.Context, cli kubernetes.Interface, node, namespace, pod string) (uint64, time.Time, error) {
+	summary, err := preflight.FetchSummary(ctx, cli, nil, node)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("stat summary of node %s: %v", node, err)
+	}
+	if pod == "" {
+		if summary.Node.Fs == nil {
+			return 0, time.Time{}, fmt.Errorf("node %s reported no filesystem stats", node)
+		}
+		return provider.NodeFsUsage(summary).UsedBytes, summary.Node.Fs.Time.Time, nil
+	}
+	for _, stat := range provider.SummaryPodStats(summary, false) {
+		if stat.Namespace != namespace || stat.PodName != pod {
+			continue
+		}
+		return stat.UsedBytes, podStatTime(summary, stat.UID), nil
+	}
+	return 0, time.Time{}, fmt.Errorf("pod %s/%s has no storage stats in the stat summary of node %s", namespace, pod, node)
+}
+
+// podStatTime returns the time of the storage stats of the pod uid in summary. Pods whose storage is computed from
+// their containers have the time of the node filesystem.
+func podStatTime(summary *stats.Summary, uid string) time.Time {
+	at := time.Now()
+	if summary.Node.Fs != nil {
+		at = summary.Node.Fs.Time.Time
+	}
+	for i := range summary.Pods {
+		if fs := summary.Pods[i].EphemeralStorage; summary.Pods[i].PodRef.UID == uid && fs != nil {
+			at = fs.Time.Time
+		}
+	}
+	return at
+}
+
+func cutPrefix(s string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return strings.TrimPrefix(s, prefix), true
+		}
+	}
+	return s, false
+}
+
+// formatDelta formats a signed change of bytes, e.g. +1.5Mi.
+func formatDelta(bytes int64) string {
+	if bytes < 0 {
+		return "-" + formatBytes(uint64(-bytes))
+	}
+	return "+" + formatBytes(uint64(bytes))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// binaryName is the name of the plugin binary, found by kubectl in the PATH.
+var binaryName = "kubectl-" + strings.ReplaceAll(pluginName, "-", "_")
+
+// krewPlugin is the krew plugin manifest, see https://krew.sigs.k8s.io/docs/developer-guide/plugin-manifest/.
+type krewPlugin struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec krewSpec `json:"spec"`
+}
+
+type krewSpec struct {
+	Version          string         `json:"version"`
+	Homepage         string         `json:"homepage"`
+	ShortDescription string         `json:"shortDescription"`
+	Description      string         `json:"description"`
+	Platforms        []krewPlatform `json:"platforms"`
+}
+
+type krewPlatform struct {
+	Selector struct {
+		MatchLabels map[string]string `json:"matchLabels"`
+	} `json:"selector"`
+	URI    string `json:"uri"`
+	Sha256 string `json:"sha256"`
+	Bin    string `json:"bin"`
+}
+
+// generate prints generated files, the krew manifest for now.
+func generate(args []string) int {
+	if len(args) == 0 || args[0] != "krew-manifest" {
+		fmt.Fprintf(os.Stderr, "Usage: kubectl %s generate krew-manifest [flags] ARCHIVE...\n", pluginName)
+		return 2
+	}
+	fs := flag.NewFlagSet("generate krew-manifest", flag.ContinueOnError)
+	version := fs.String("version", "", "Version of the release, e.g. v1.2.0.")
+	baseURL := fs.String("base-url", "", "URL the archives are downloaded from, e.g. https://github.com/sangheee/k8s-ephemeral-storage-metrics/releases/download/v1.2.0.")
+	homepage := fs.String("homepage", "https://github.com/sangheee/k8s-ephemeral-storage-metrics", "Homepage of the plugin.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kubectl %s generate krew-manifest [flags] ARCHIVE...\n\n"+
+			"Prints the krew manifest of the archives, each named %s_<os>_<arch>.tar.gz or .zip and containing the binary.\n", pluginName, binaryName)
+		fs.PrintDefaults()
+	}
+	archives, err := parse(fs, args[1:])
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if *version == "" || *baseURL == "" || len(archives) == 0 {
+		fs.Usage()
+		return 2
+	}
+	manifest, err := krewManifest(*version, strings.TrimSuffix(*baseURL, "/"), *homepage, archives)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(manifest)
+	return 0
+}
+
+func krewManifest(version, baseURL, homepage string, archives []string) ([]byte, error) {
+	plugin := krewPlugin{APIVersion: "krew.googlecontainertools.github.com/v1alpha2", Kind: "Plugin"}
+	plugin.Metadata.Name = pluginName
+	plugin.Spec = krewSpec{
+		Version:          version,
+		Homepage:         homepage,
+		ShortDescription: "Show the ephemeral storage used by pods and nodes",
+		Description: "Shows the ephemeral storage, i.e. the writable layers, logs and emptyDir volumes, used by pods and\n" +
+			"nodes, from the stat summaries of their kubelets read through the api server. top prints the pods or nodes\n" +
+			"using the most, with the limits of pods, history the growth of a pod or node over time, and tui the pods\n" +
+			"sorted live with sparklines of their growth.\n" +
+			"Requires get on nodes/proxy.\n",
+	}
+	for _, archive := range archives {
+		base := filepath.Base(archive)
+		ext := ".tar.gz"
+		if strings.HasSuffix(base, ".zip") {
+			ext = ".zip"
+		}
+		target := strings.TrimSuffix(strings.TrimPrefix(base, binaryName+"_"), ext)
+		parts := strings.Split(target, "_")
+		if !strings.HasSuffix(base, ext) || !strings.HasPrefix(base, binaryName+"_") || len(parts) != 2 {
+			return nil, fmt.Errorf("%s is not named %s_<os>_<arch>.tar.gz or .zip", archive, binaryName)
+		}
+		sum, err := sha256File(archive)
+		if err != nil {
+			return nil, err
+		}
+		platform := krewPlatform{URI: baseURL + "/" + base, Sha256: sum, Bin: binaryName}
+		if parts[0] == "windows" {
+			platform.Bin += ".exe"
+		}
+		platform.Selector.MatchLabels = map[string]string{"os": parts[0], "arch": parts[1]}
+		plugin.Spec.Platforms = append(plugin.Spec.Platforms, platform)
+	}
+	sort.Slice(plugin.Spec.Platforms, func(i, j int) bool {
+		return plugin.Spec.Platforms[i].URI < plugin.Spec.Platforms[j].URI
+	})
+	return yaml.Marshal(plugin)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,170 @@
+// Command kubectl-ephemeral_storage is a kubectl plugin, run as kubectl ephemeral-storage, that reads the
+// ephemeral storage of pods and nodes from the stat summaries of their kubelets through the api server, with the
+// credentials of the kubeconfig, the way the exporter does, so that it is used without deploying anything.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+)
+
+// pluginName is the name of the plugin in kubectl and krew, the binary is named after it with _ for -.
+const pluginName = "ephemeral-storage"
+
+// maxConcurrentSummaries bounds the stat summary requests in flight, to spare the api server in large clusters.
+const maxConcurrentSummaries = 8
+
+var commands = map[string]func(args []string) int{
+	"top":      top,
+	"history":  history,
+	"tui":      tui,
+	"generate": generate,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Show the ephemeral storage used by pods and nodes, from the stat summaries of their kubelets.
+
+Usage:
+  kubectl %[1]s top pods [NAME] [-n NAMESPACE | -A] [-l SELECTOR] [--containers]
+  kubectl %[1]s top nodes [NAME]
+  kubectl %[1]s history [node/]NAME [-n NAMESPACE] [--interval 10s] [--count N]
+  kubectl %[1]s tui [-n NAMESPACE | -A] [-l SELECTOR] [--source kubelet|exporter]
+  kubectl %[1]s generate krew-manifest --version VERSION --base-url URL ARCHIVE...
+
+Reading stat summaries requires get on nodes/proxy. Run a command with -h for its flags.
+`, pluginName)
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		if args[0] != "-h" && args[0] != "--help" && args[0] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		}
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(command(args[1:]))
+}
+
+// kubeFlags are the kubectl flags of the commands that talk to the api server.
+type kubeFlags struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+}
+
+func (k *kubeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to KUBECONFIG or ~/.kube/config.")
+	fs.StringVar(&k.context, "context", "", "Kubeconfig context to use. Defaults to the current context.")
+	fs.StringVar(&k.namespace, "namespace", "", "Namespace of the pods. Defaults to the namespace of the context.")
+	fs.StringVar(&k.namespace, "n", "", "Shorthand for -namespace.")
+	fs.BoolVar(&k.allNamespaces, "all-namespaces", false, "Pods of all namespaces.")
+	fs.BoolVar(&k.allNamespaces, "A", false, "Shorthand for -all-namespaces.")
+}
+
+// client returns a client of the api server of the kubeconfig and the namespace of the commands: empty for all
+// namespaces, else -namespace or the namespace of the context.
+func (k *kubeFlags) client() (kubernetes.Interface, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: k.context}
+	overrides.Context.Namespace = k.namespace
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	cfg, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	if k.allNamespaces {
+		return cli, "", nil
+	}
+	namespace, _, err := config.Namespace()
+	return cli, namespace, err
+}
+
+// parse parses the flags of fs in args, which may follow the positional arguments as with kubectl, and returns the
+// positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// nodeSummary is the stat summary of a node, or the error requesting it.
+type nodeSummary struct {
+	node    string
+	summary *stats.Summary
+	err     error
+}
+
+// fetchSummaries requests the stat summaries of nodes through the api server node proxy, like the exporter
+// without -kubelet-address-types, and returns them in the order of the node names.
+func fetchSummaries(ctx context.Context, cli kubernetes.Interface, nodes []string) []nodeSummary {
+	sort.Strings(nodes)
+	summaries := make([]nodeSummary, len(nodes))
+	sem := make(chan struct{}, maxConcurrentSummaries)
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summary, err := preflight.FetchSummary(ctx, cli, nil, node)
+			summaries[i] = nodeSummary{node: node, summary: summary, err: err}
+		}(i, node)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// formatBytes formats bytes with a binary unit and one decimal, e.g. 1.5Gi.
+func formatBytes(bytes uint64) string {
+	const units = "KMGTPE"
+	if bytes < 1024 {
+		return fmt.Sprintf("%d", bytes)
+	}
+	value, unit := float64(bytes)/1024, 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + string(units[unit]) + "i"
+}
+
+// formatPercent formats used out of total, - if total is unknown.
+func formatPercent(used, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*float64(used)/float64(total))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// top prints the ephemeral storage of pods or nodes once, like kubectl top.
+func top(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	var kube kubeFlags
+	kube.register(fs)
+	selector := fs.String("selector", "", "Label selector of the pods, e.g. app=web.")
+	fs.StringVar(selector, "l", "", "Shorthand for -selector.")
+	containers := fs.Bool("containers", false, "Print the writable layer and logs of each container of the pods.")
+	sortBy := fs.String("sort-by", "used", "Order of the rows, used or name.")
+	timeout := fs.Duration("request-timeout", 30*time.Second, "Timeout of the command.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kubectl %s top pods|nodes [NAME] [flags]\n", pluginName)
+		fs.PrintDefaults()
+	}
+	positional, err := parse(fs, args)
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if len(positional) == 0 || len(positional) > 2 || (*sortBy != "used" && *sortBy != "name") {
+		fs.Usage()
+		return 2
+	}
+	var name string
+	if len(positional) == 2 {
+		name = positional[1]
+	}
+	cli, namespace, err := kube.client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch positional[0] {
+	case "pod", "pods", "po":
+		err = topPods(ctx, cli, namespace, name, *selector, *containers, *sortBy == "name")
+	case "node", "nodes", "no":
+		err = topNodes(ctx, cli, name, *sortBy == "name")
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type podRow struct {
+	stat  provider.PodStat
+	limit int64
+	// limited is set if every container has a limit, see provider.EphemeralStorageLimit.
+	limited bool
+}
+
+// scheduledPods lists the scheduled pods of namespace, all if empty, matching name and selector, and returns them
+// by UID with the names of their nodes, the only ones whose stat summaries are requested.
+func scheduledPods(ctx context.Context, cli kubernetes.Interface, namespace, name, selector string) (map[types.UID]*corev1.Pod, []string, error) {
+	opts := metav1.ListOptions{LabelSelector: selector}
+	if name != "" {
+		opts.FieldSelector = "metadata.name=" + name
+	}
+	pods, err := cli.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	byUID := make(map[types.UID]*corev1.Pod, len(pods.Items))
+	nodeSet := map[string]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName != "" {
+			byUID[pod.UID] = pod
+			nodeSet[pod.Spec.NodeName] = true
+		}
+	}
+	if len(byUID) == 0 {
+		return nil, nil, fmt.Errorf("no scheduled pods found")
+	}
+	nodes := make([]string, 0, len(nodeSet))
+	for node := range nodeSet {
+		nodes = append(nodes, node)
+	}
+	return byUID, nodes, nil
+}
+
+func topPods(ctx context.Context, cli kubernetes.Interface, namespace, name, selector string, containers, byName bool) error {
+	byUID, nodes, err := scheduledPods(ctx, cli, namespace, name, selector)
+	if err != nil {
+		return err
+	}
+
+	var rows []podRow
+	for _, fetched := range fetchSummaries(ctx, cli, nodes) {
+		if fetched.err != nil {
+			fmt.Fprintf(os.Stderr, "warning: stat summary of node %s: %v\n", fetched.node, fetched.err)
+			continue
+		}
+		for _, stat := range provider.SummaryPodStats(fetched.summary, containers) {
+			pod, ok := byUID[types.UID(stat.UID)]
+			if !ok {
+				continue
+			}
+			limit, limited := provider.EphemeralStorageLimit(pod)
+			rows = append(rows, podRow{stat: stat, limit: limit, limited: limited})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i].stat, rows[j].stat
+		if !byName && a.UsedBytes != b.UsedBytes {
+			return a.UsedBytes > b.UsedBytes
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.PodName < b.PodName
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	if namespace == "" {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tNODE\tUSED\tLIMIT\tUSE%")
+	for _, row := range rows {
+		if namespace == "" {
+			fmt.Fprintf(w, "%s\t", row.stat.Namespace)
+		}
+		limit, percent := "-", "-"
+		if row.limited {
+			limit, percent = formatBytes(uint64(row.limit)), formatPercent(row.stat.UsedBytes, uint64(row.limit))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", row.stat.PodName, row.stat.NodeName, formatBytes(row.stat.UsedBytes), limit, percent)
+		for _, container := range row.stat.Containers {
+			if namespace == "" {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprintf(w, "  %s\t\t%s\t\t\n", container.Name, formatBytes(container.RootfsUsedBytes+container.LogsUsedBytes))
+		}
+	}
+	return w.Flush()
+}
+
+func topNodes(ctx context.Context, cli kubernetes.Interface, name string, byName bool) error {
+	var nodes []string
+	if name != "" {
+		nodes = []string{name}
+	} else {
+		list, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for _, node := range list.Items {
+			nodes = append(nodes, node.Name)
+		}
+	}
+
+	type nodeRow struct {
+		name     string
+		fs       *provider.FsUsage
+		podsUsed uint64
+		pods     int
+	}
+	var rows []nodeRow
+	for _, fetched := range fetchSummaries(ctx, cli, nodes) {
+		if fetched.err != nil {
+			fmt.Fprintf(os.Stderr, "warning: stat summary of node %s: %v\n", fetched.node, fetched.err)
+			continue
+		}
+		row := nodeRow{name: fetched.node, fs: provider.NodeFsUsage(fetched.summary)}
+		for _, stat := range provider.SummaryPodStats(fetched.summary, false) {
+			row.podsUsed += stat.UsedBytes
+			row.pods++
+		}
+		rows = append(rows, row)
+	}
+	used := func(row nodeRow) uint64 {
+		if row.fs == nil {
+			return 0
+		}
+		return row.fs.UsedBytes
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return !byName && used(rows[i]) > used(rows[j]) })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tUSED\tCAPACITY\tUSE%\tPODS\tPODS-USED")
+	for _, row := range rows {
+		usedBytes, capacity, percent := "-", "-", "-"
+		if row.fs != nil {
+			usedBytes, capacity, percent = formatBytes(row.fs.UsedBytes), formatBytes(row.fs.CapacityBytes), formatPercent(row.fs.UsedBytes, row.fs.CapacityBytes)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", row.name, usedBytes, capacity, percent, row.pods, formatBytes(row.podsUsed))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+	"k8s-ephemeral-storage-metrics/pkg/web"
+)
+
+// sparkWidth is the number of stats of a pod kept for its sparkline.
+const sparkWidth = 20
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// tuiSorts are the orders of the rows, cycled through with s.
+var tuiSorts = []string{"used", "rate", "use%", "name"}
+
+// podUsage is the used bytes of a pod at the time of its stats.
+type podUsage struct {
+	namespace, name, node string
+	used                  uint64
+	at                    time.Time
+	limit                 int64
+	// limited is set if every container has a limit, see provider.EphemeralStorageLimit.
+	limited bool
+}
+
+// tuiPod is a row of the monitor, with the used bytes of the last stats of the pod.
+type tuiPod struct {
+	podUsage
+	// samples are the used bytes of the last sparkWidth stats, oldest first.
+	samples []uint64
+	// rate is the growth in bytes per second between the last two stats.
+	rate    float64
+	hasRate bool
+}
+
+// tui polls the ephemeral storage of pods and shows them in the terminal, sorted live with a sparkline of their
+// growth, like top, so that the pod filling a disk is spotted without a Prometheus.
+func tui(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	var kube kubeFlags
+	kube.register(fs)
+	selector := fs.String("selector", "", "Label selector of the pods, e.g. app=web.")
+	fs.StringVar(selector, "l", "", "Shorthand for -selector.")
+	interval := fs.Duration("interval", 10*time.Second, "Interval at which the usage is polled. The kubelet refreshes disk stats about every minute.")
+	source := fs.String("source", "kubelet", "Where the usage is read: kubelet, the stat summaries of the nodes of the pods, or exporter, the ephemeralmetrics.k8s.io API of an exporter with -ephemeral-metrics-api, which spares the kubelets.")
+	timeout := fs.Duration("request-timeout", 30*time.Second, "Timeout of a poll.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kubectl %s tui [flags]\n\n"+
+			"Keys: s changes the order, j/k or the arrows scroll, q quits.\n", pluginName)
+		fs.PrintDefaults()
+	}
+	positional, err := parse(fs, args)
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if len(positional) != 0 || *interval <= 0 || (*source != "kubelet" && *source != "exporter") {
+		fs.Usage()
+		return 2
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		fmt.Fprintln(os.Stderr, "error: tui requires a terminal, use top or history otherwise")
+		return 1
+	}
+	cli, namespace, err := kube.client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	poll := func(ctx context.Context) ([]podUsage, error) {
+		ctx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		if *source == "exporter" {
+			return exporterUsage(ctx, cli, namespace, *selector)
+		}
+		return kubeletUsage(ctx, cli, namespace, *selector)
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	// Alternate screen without cursor, restored on exit like less does.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		_ = term.Restore(in, state)
+	}()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	m := &monitor{pods: map[string]*tuiPod{}, namespace: namespace, source: *source, sortBy: tuiSorts[0]}
+	m.run(ctx, poll, *interval, out)
+	return 0
+}
+
+type pollResult struct {
+	pods []podUsage
+	err  error
+	at   time.Time
+}
+
+// monitor is the state of the tui.
+type monitor struct {
+	pods      map[string]*tuiPod
+	namespace string
+	source    string
+	sortBy    string
+	offset    int
+	polled    time.Time
+	err       error
+}
+
+func (m *monitor) run(ctx context.Context, poll func(context.Context) ([]podUsage, error), interval time.Duration, out int) {
+	results := make(chan pollResult)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			pods, err := poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case results <- pollResult{pods: pods, err: err, at: time.Now()}:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	// Reads are not interruptible, the goroutine ends with the process.
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	// The screen is redrawn every second as well, for the age of the usage and the size of the terminal.
+	redraw := time.NewTicker(time.Second)
+	defer redraw.Stop()
+
+	m.draw(out)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result := <-results:
+			m.update(result)
+		case key := <-keys:
+			if !m.key(key) {
+				return
+			}
+		case <-redraw.C:
+		}
+		m.draw(out)
+	}
+}
+
+// update merges the usage of a poll into the rows. Pods missing from a successful poll are removed.
+func (m *monitor) update(result pollResult) {
+	m.err = result.err
+	if result.err != nil {
+		return
+	}
+	m.polled = result.at
+	seen := make(map[string]bool, len(result.pods))
+	for _, usage := range result.pods {
+		key := usage.namespace + "/" + usage.name
+		seen[key] = true
+		pod, ok := m.pods[key]
+		if !ok {
+			m.pods[key] = &tuiPod{podUsage: usage, samples: []uint64{usage.used}}
+			continue
+		}
+		if !usage.at.After(pod.at) {
+			// The stats were not refreshed since the previous poll.
+			continue
+		}
+		pod.rate = (float64(usage.used) - float64(pod.used)) / usage.at.Sub(pod.at).Seconds()
+		pod.hasRate = true
+		pod.samples = append(pod.samples, usage.used)
+		if len(pod.samples) > sparkWidth {
+			pod.samples = pod.samples[len(pod.samples)-sparkWidth:]
+		}
+		pod.podUsage = usage
+	}
+	for key := range m.pods {
+		if !seen[key] {
+			delete(m.pods, key)
+		}
+	}
+}
+
+// key handles the keys read at once, and returns false to quit.
+func (m *monitor) key(key []byte) bool {
+	switch string(key) {
+	case "q", "Q", "\x03":
+		return false
+	case "s":
+		for i, sortBy := range tuiSorts {
+			if sortBy == m.sortBy {
+				m.sortBy = tuiSorts[(i+1)%len(tuiSorts)]
+				break
+			}
+		}
+	case "j", "\x1b[B":
+		m.offset++
+	case "k", "\x1b[A":
+		m.offset--
+	case "g", "\x1b[H":
+		m.offset = 0
+	}
+	return true
+}
+
+func (m *monitor) rows() []*tuiPod {
+	rows := make([]*tuiPod, 0, len(m.pods))
+	for _, pod := range m.pods {
+		rows = append(rows, pod)
+	}
+	percent := func(pod *tuiPod) float64 {
+		if !pod.limited || pod.limit == 0 {
+			return -1
+		}
+		return float64(pod.used) / float64(pod.limit)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch {
+		case m.sortBy == "used" && a.used != b.used:
+			return a.used > b.used
+		case m.sortBy == "rate" && a.rate != b.rate:
+			return a.rate > b.rate
+		case m.sortBy == "use%" && percent(a) != percent(b):
+			return percent(a) > percent(b)
+		case a.namespace != b.namespace:
+			return a.namespace < b.namespace
+		}
+		return a.name < b.name
+	})
+	return rows
+}
+
+func (m *monitor) draw(out int) {
+	width, height, err := term.GetSize(out)
+	if err != nil {
+		width, height = 80, 24
+	}
+	var lines []string
+	status := fmt.Sprintf("kubectl %s tui - %d pods from %s", pluginName, len(m.pods), m.source)
+	if !m.polled.IsZero() {
+		status += fmt.Sprintf(", polled %s ago", time.Since(m.polled).Truncate(time.Second))
+	}
+	lines = append(lines, status+fmt.Sprintf(" - sorted by %s, s: sort, j/k: scroll, q: quit", m.sortBy))
+	if m.err != nil {
+		lines = append(lines, "error: "+strings.ReplaceAll(m.err.Error(), "\n", " "))
+	} else if m.polled.IsZero() {
+		lines = append(lines, "polling...")
+	} else {
+		lines = append(lines, "")
+	}
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	if m.namespace == "" {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tNODE\tUSED\tLIMIT\tUSE%\tRATE\tTREND")
+	rows := m.rows()
+	// The header and status lines are kept, the rows are scrolled.
+	visible := height - len(lines) - 1
+	if visible < 1 {
+		visible = 1
+	}
+	if m.offset > len(rows)-visible {
+		m.offset = len(rows) - visible
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+	for _, pod := range rows[m.offset:] {
+		if m.namespace == "" {
+			fmt.Fprintf(w, "%s\t", pod.namespace)
+		}
+		limit, percent, rate := "-", "-", "-"
+		if pod.limited {
+			limit, percent = formatBytes(uint64(pod.limit)), formatPercent(pod.used, uint64(pod.limit))
+		}
+		if pod.hasRate {
+			rate = formatDelta(int64(pod.rate)) + "/s"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pod.name, pod.node, formatBytes(pod.used), limit, percent, rate, sparkline(pod.samples))
+	}
+	_ = w.Flush()
+	lines = append(lines, strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")...)
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	// Raw mode does not translate \n, each line is cleared to its end instead of clearing the screen, which flickers.
+	var frame strings.Builder
+	frame.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			frame.WriteString("\r\n")
+		}
+		frame.WriteString(truncate(line, width))
+		frame.WriteString("\x1b[K")
+	}
+	frame.WriteString("\x1b[J")
+	os.Stdout.WriteString(frame.String())
+}
+
+// kubeletUsage returns the usage of the scheduled pods of namespace matching selector from the stat summaries of
+// their nodes.
+func kubeletUsage(ctx context.Context, cli kubernetes.Interface, namespace, selector string) ([]podUsage, error) {
+	byUID, nodes, err := scheduledPods(ctx, cli, namespace, "", selector)
+	if err != nil {
+		return nil, err
+	}
+	var usages []podUsage
+	var errs []string
+	for _, fetched := range fetchSummaries(ctx, cli, nodes) {
+		if fetched.err != nil {
+			errs = append(errs, fmt.Sprintf("stat summary of node %s: %v", fetched.node, fetched.err))
+			continue
+		}
+		for _, stat := range provider.SummaryPodStats(fetched.summary, false) {
+			pod, ok := byUID[types.UID(stat.UID)]
+			if !ok {
+				continue
+			}
+			usages = append(usages, newPodUsage(pod, stat.NodeName, stat.UsedBytes, podStatTime(fetched.summary, stat.UID)))
+		}
+	}
+	// The pods of the other nodes are still shown, the failed ones are dropped until their node responds again.
+	if len(errs) > 0 && len(usages) == 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return usages, nil
+}
+
+// exporterUsage returns the usage of the scheduled pods of namespace matching selector from the
+// ephemeralmetrics.k8s.io API, read through the api server like with kubectl get --raw. The API does not support
+// selectors, the pods are listed for them and for their limits.
+func exporterUsage(ctx context.Context, cli kubernetes.Interface, namespace, selector string) ([]podUsage, error) {
+	byUID, _, err := scheduledPods(ctx, cli, namespace, "", selector)
+	if err != nil {
+		return nil, err
+	}
+	path := "/apis/" + web.EphemeralMetricsGroup + "/" + web.EphemeralMetricsVersion
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	raw, err := cli.CoreV1().RESTClient().Get().AbsPath(path, "pods").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var list web.PodMetricsList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	byName := make(map[string]*corev1.Pod, len(byUID))
+	for _, pod := range byUID {
+		byName[pod.Namespace+"/"+pod.Name] = pod
+	}
+	var usages []podUsage
+	for _, metrics := range list.Items {
+		pod, ok := byName[metrics.Namespace+"/"+metrics.Name]
+		if !ok {
+			continue
+		}
+		used := metrics.Usage[corev1.ResourceEphemeralStorage]
+		usages = append(usages, newPodUsage(pod, metrics.Labels["node"], uint64(used.Value()), metrics.Timestamp.Time))
+	}
+	return usages, nil
+}
+
+func newPodUsage(pod *corev1.Pod, node string, used uint64, at time.Time) podUsage {
+	limit, limited := provider.EphemeralStorageLimit(pod)
+	return podUsage{namespace: pod.Namespace, name: pod.Name, node: node, used: used, at: at, limit: limit, limited: limited}
+}
+
+// sparkline draws samples scaled between their min and max, flat at the bottom if they did not change.
+func sparkline(samples []uint64) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	low, high := samples[0], samples[0]
+	for _, sample := range samples {
+		if sample < low {
+			low = sample
+		}
+		if sample > high {
+			high = sample
+		}
+	}
+	line := make([]rune, len(samples))
+	for i, sample := range samples {
+		level := 0
+		if high > low {
+			level = int(float64(sample-low) / float64(high-low) * float64(len(sparkLevels)-1))
+		}
+		line[i] = sparkLevels[level]
+	}
+	return string(line)
+}
+
+// truncate cuts s to width runes.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
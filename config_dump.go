@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"k8s-ephemeral-storage-metrics/pkg/config"
+)
+
+// configEnv are the environment variables read by the exporter, besides those of the in-cluster client.
+var configEnv = []string{"CURRENT_NODE_NAME", "SCRAPE_INTERVAL_SECOND"}
+
+// effectiveConfig is the configuration served by GET /-/config.
+type effectiveConfig struct {
+	// Flags are the values of all flags, defaults included, after environment variables were applied.
+	Flags map[string]string `json:"flags"`
+	// Env are the configEnv that are set.
+	Env map[string]string `json:"env,omitempty"`
+	// Config is the config file with the flags that override it applied.
+	Config *config.Config `json:"config"`
+}
+
+// dumpConfig renders the effective configuration as YAML. Keys are sorted, so that the output of replicas and
+// of a rendered manifest can be diffed. Passwords of URLs, e.g. of -proxy-url, are redacted; secrets are otherwise
+// only given as files, whose paths are shown.
+func dumpConfig(appConfig *config.Config) ([]byte, error) {
+	effective := effectiveConfig{Flags: map[string]string{}, Env: map[string]string{}, Config: appConfig}
+	flag.VisitAll(func(f *flag.Flag) {
+		effective.Flags[f.Name] = redactURL(f.Value.String())
+	})
+	for _, name := range configEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			effective.Env[name] = value
+		}
+	}
+	return yaml.Marshal(effective)
+}
+
+// redactURL replaces the password of value if it is a URL with one.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/fakekubelet"
+)
+
+// devModeOptions shape the fake kubelet of -dev-mode.
+var devModeOptions = fakekubelet.Options{Pods: 10, ContainersPerPod: 2, VolumesPerPod: 1, Namespaces: 3}
+
+// devModeGrowth is the growth of the first volume of the pods of -dev-mode per scrape interval, times the index of
+// the pod plus one.
+const devModeGrowth = 256 * 1024
+
+// startDevKubelet starts the fake kubelet of -dev-mode, which also serves as api server, and returns its config. The
+// pods grow every interval until ctx is done, so that dashboards and alerts have something to show.
+func startDevKubelet(ctx context.Context, interval time.Duration) (*fakekubelet.Server, *rest.Config) {
+	kubelet := fakekubelet.NewServer(devModeOptions)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer kubelet.Close()
+		for tick := uint64(1); ; tick++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			summary := fakekubelet.GenerateSummary(devModeOptions)
+			for i := range summary.Pods {
+				pod := &summary.Pods[i]
+				growth := tick * uint64(i+1) * devModeGrowth
+				volume, used := *pod.VolumeStats[0].UsedBytes+growth, *pod.EphemeralStorage.UsedBytes+growth
+				pod.VolumeStats[0].UsedBytes, pod.EphemeralStorage.UsedBytes = &volume, &used
+			}
+			kubelet.SetSummary(summary)
+		}
+	}()
+	klog.Infof("Dev mode: serving the fake kubelet of node %s at %s", kubelet.NodeName(), kubelet.URL)
+	return kubelet, &rest.Config{Host: kubelet.URL}
+}
+
+// devRESTMapper is the REST mapper of the manager in -dev-mode. The fake kubelet serves no discovery, and no
+// informer is started, so nothing is mapped.
+func devRESTMapper(*rest.Config) (meta.RESTMapper, error) {
+	return meta.NewDefaultRESTMapper(nil), nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+)
+
+const (
+	// e2eWriteBytes is what the test pod of e2e writes to its emptyDir volume.
+	e2eWriteBytes = 64 << 20
+	// e2ePollInterval is the interval of the checks of e2e.
+	e2ePollInterval = 5 * time.Second
+	// e2eDefaultPort is the port of exporter pods without a port named http.
+	e2eDefaultPort = "9100"
+)
+
+// e2e runs a test pod writing e2eWriteBytes to an emptyDir volume in -e2e-namespace, waits for its
+// ephemeral_storage_pod_used_bytes on the installed exporters of -e2e-exporter-selector, scraped through the api
+// server pod proxy, and for the series to disappear once the pod is deleted. It validates an install end to end
+// and returns a non-zero exit code if any check failed.
+func e2e() int {
+	cfg, err := restConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e2eTimeout)
+	defer cancel()
+
+	results := e2eRun(ctx, cli)
+	failed := 0
+	for _, result := range results {
+		if result.OK() {
+			fmt.Printf("[OK]   %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("[FAIL] %s: %v\n       hint: %s\n", result.Name, result.Err, result.Hint)
+	}
+	if failed > 0 {
+		fmt.Printf("%d check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// e2eRun runs the checks in order and stops at the first failure. The test pod is always deleted.
+func e2eRun(ctx context.Context, cli kubernetes.Interface) []preflight.Result {
+	pods := cli.CoreV1().Pods(e2eNamespace)
+	pod, err := pods.Create(ctx, e2ePod(), metav1.CreateOptions{})
+	results := []preflight.Result{{Name: "create test pod", Err: err, Hint: fmt.Sprintf("the kubeconfig user needs to create pods in namespace %s", e2eNamespace)}}
+	if err != nil {
+		return results
+	}
+	deleted := false
+	defer func() {
+		if deleted {
+			return
+		}
+		// The context of the checks may be done.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := pods.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete test pod %s/%s: %v\n", e2eNamespace, pod.Name, err)
+		}
+	}()
+	name := fmt.Sprintf("test pod %s/%s", e2eNamespace, pod.Name)
+
+	err = wait.PollImmediateUntilWithContext(ctx, e2ePollInterval, func(ctx context.Context) (bool, error) {
+		current, err := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch current.Status.Phase {
+		case corev1.PodRunning:
+			pod = current
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("pod is %s", current.Status.Phase)
+		}
+		return false, nil
+	})
+	results = append(results, preflight.Result{Name: name + " is running", Err: err, Hint: "check the events of the pod, e.g. whether -e2e-image can be pulled"})
+	if err != nil {
+		return results
+	}
+
+	var used float64
+	err = wait.PollImmediateUntilWithContext(ctx, e2ePollInterval, func(ctx context.Context) (bool, error) {
+		value, found, err := e2eUsedBytes(ctx, cli, pod)
+		if err != nil {
+			return false, err
+		}
+		used = value
+		return found && value >= e2eWriteBytes, nil
+	})
+	if err != nil && used > 0 {
+		err = fmt.Errorf("%v, last pod_used_bytes was %v", err, used)
+	}
+	results = append(results, preflight.Result{
+		Name: fmt.Sprintf("pod_used_bytes of %s reaches %d", name, e2eWriteBytes),
+		Err:  err,
+		Hint: fmt.Sprintf("check that an exporter matching %s runs on node %s and that the pod collector is enabled", e2eExporterSelector, pod.Spec.NodeName),
+	})
+	if err != nil {
+		return results
+	}
+
+	err = pods.Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: new(int64)})
+	deleted = err == nil
+	if err == nil {
+		err = wait.PollImmediateUntilWithContext(ctx, e2ePollInterval, func(ctx context.Context) (bool, error) {
+			_, found, err := e2eUsedBytes(ctx, cli, pod)
+			return !found, err
+		})
+	}
+	return append(results, preflight.Result{Name: fmt.Sprintf("pod_used_bytes of %s disappears once deleted", name), Err: err, Hint: "the exporter exposes series of deleted pods, report a bug"})
+}
+
+// e2ePod returns the test pod, which writes e2eWriteBytes to an emptyDir volume and sleeps.
+func e2ePod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "ephemeral-storage-e2e-",
+			Namespace:    e2eNamespace,
+			Labels:       map[string]string{"app.kubernetes.io/name": "ephemeral-storage-e2e"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: new(int64),
+			Containers: []corev1.Container{{
+				Name:    "write",
+				Image:   e2eImage,
+				Command: []string{"sh", "-c", fmt.Sprintf("dd if=/dev/zero of=/scratch/fill bs=1048576 count=%d && sleep 3600", e2eWriteBytes>>20)},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "scratch",
+					MountPath: "/scratch",
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name:         "scratch",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			}},
+		},
+	}
+}
+
+// e2eUsedBytes returns the ephemeral_storage_pod_used_bytes of pod on the exporters, and whether any exports it.
+func e2eUsedBytes(ctx context.Context, cli kubernetes.Interface, pod *corev1.Pod) (float64, bool, error) {
+	exporters, err := cli.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: e2eExporterSelector})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(exporters.Items) == 0 {
+		return 0, false, fmt.Errorf("no exporter pod matches %s", e2eExporterSelector)
+	}
+	for i := range exporters.Items {
+		exporter := &exporters.Items[i]
+		if exporter.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		content, err := cli.CoreV1().Pods(exporter.Namespace).ProxyGet("http", exporter.Name, e2eExporterPort(exporter), metricsPath, nil).DoRaw(ctx)
+		if err != nil {
+			// Other exporters may still export the pod, e.g. while one is restarting.
+			fmt.Fprintf(os.Stderr, "failed to scrape exporter %s/%s: %v\n", exporter.Namespace, exporter.Name, err)
+			continue
+		}
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(bytes.NewReader(content))
+		if err != nil {
+			return 0, false, fmt.Errorf("exporter %s/%s: %v", exporter.Namespace, exporter.Name, err)
+		}
+		if family, ok := families["ephemeral_storage_pod_used_bytes"]; ok {
+			for _, metric := range family.Metric {
+				if labelValue(metric, "namespace_name") == pod.Namespace && labelValue(metric, "pod_name") == pod.Name {
+					return metric.GetGauge().GetValue(), true, nil
+				}
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// e2eExporterPort returns the port named http of the exporter pod, as the chart names it.
+func e2eExporterPort(exporter *corev1.Pod) string {
+	for _, container := range exporter.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == "http" {
+				return strconv.Itoa(int(port.ContainerPort))
+			}
+		}
+	}
+	return e2eDefaultPort
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,969 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+	"k8s-ephemeral-storage-metrics/pkg/config"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+	"k8s-ephemeral-storage-metrics/pkg/remote"
+	"k8s-ephemeral-storage-metrics/pkg/transport"
+)
+
+var (
+	listenAddress           string
+	scrapeIntervalSecond    int64
+	metricsPath             string
+	verbosityLogLevel       string
+	healthProbeAddress      string
+	leaderElect             bool
+	devMode                 bool
+	e2eNamespace            string
+	e2eExporterSelector     string
+	e2eImage                string
+	e2eTimeout              time.Duration
+	loadgenNamespace        string
+	loadgenPods             int
+	loadgenRate             string
+	loadgenMaxBytes         string
+	loadgenLimit            string
+	loadgenTarget           string
+	loadgenImage            string
+	loadgenDuration         time.Duration
+	leaderElectionID        string
+	leaderElectionNamespace string
+	kubeContext             string
+	apiServer               string
+	excludeCompletedPods    bool
+	excludeTerminatingPods  bool
+	excludeGenericEphemeral bool
+	dedupeEmptyDir          bool
+	podPhaseLabel           bool
+	maxGrowthWindow         time.Duration
+	podPeakUsage            bool
+	kubeletRestartGrace     time.Duration
+	maxStatsAge             time.Duration
+	watchdogIntervals       int
+	scrapeErrorBudget       float64
+	staleAfterFailures      int
+	workloadSummaries       bool
+	workloadSummaryMaxAge   time.Duration
+	topNPerNode             int
+	minUsedBytes            string
+	skipZeroCapacity        bool
+	requirePermissions      bool
+	nodeName                string
+	nodeNameFile            string
+	clusters                clusterFlag
+	namespaceShards         int
+	tenantMetrics           bool
+	tenantReviewRateLimit   float64
+	namespaceShard          int
+	agentTarget             string
+	aggregatorAddress       string
+	aggregatorNodeTTL       time.Duration
+	grpcTLSCertFile         string
+	grpcTLSKeyFile          string
+	grpcTLSCAFile           string
+	grpcTokenFile           string
+	grpcInsecure            bool
+	metricsCompression      bool
+	metricsMaxRequests      int
+	metricsTimeout          time.Duration
+	metricsErrorHandling    string
+	metricsOpenMetrics      bool
+	metricsSparseHeartbeat  time.Duration
+	metricsSparseDelta      float64
+	failScrapeOnError       bool
+	usageAverages           durationsFlag
+	leakMinDuration         time.Duration
+	evictionSimulation      bool
+	nodeSaturationHorizon   time.Duration
+	mountsFile              string
+	diffRetention           time.Duration
+	rawSummary              bool
+	influx                  bool
+	recordDir               string
+	recordMaxFiles          int
+	replayDir               string
+	chaos                   bool
+	chaosMaxDuration        time.Duration
+	graphiteAddress         string
+	graphitePrefix          string
+	graphiteInterval        time.Duration
+	zabbixServer            string
+	zabbixInterval          time.Duration
+	snmpAddress             string
+	sinkExec                commandFlag
+	sinkExecInterval        time.Duration
+	snmpCommunityFile       string
+	ephemeralMetricsAPI     bool
+	ephemeralMetricsCAFile  string
+	debugErrors             int
+	nodeDraining            bool
+	adminTokenFile          string
+	apiTokenFile            string
+	apiRateLimit            float64
+	hostRoot                string
+	cleanupScratch          bool
+	podAllocation           bool
+	usageResetDrop          float64
+	hotScrapeInterval       time.Duration
+	hotPodUsedBytes         string
+	hotPodSelector          string
+	hotNodeAvailable        string
+	kubeletAddressTypes     string
+	kubeletPort             int
+	kubeletHostOverrides    hostOverridesFlag
+	kubeletInsecureTLS      bool
+	proxyURLFlag            string
+	tlsMinVersion           string
+	tlsCipherSuites         string
+	tlsCertFile             string
+	tlsKeyFile              string
+	configFile              string
+	recommendedLabels       bool
+	leanPodLabels           bool
+	pricePerGiBHour         float64
+)
+
+var enabledCollectors = collector.DefaultSelection()
+
+func registerFlags() {
+	flag.Int64Var(&scrapeIntervalSecond, "scrape-interval", int64FromEnv("SCRAPE_INTERVAL_SECOND", 15), "Metrics scraping interval")
+	flag.StringVar(&listenAddress, "listen-address", ":9100", "Address on which to expose metrics and web interface.")
+	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "Path under which to expose metrics.")
+	flag.BoolVar(&tenantMetrics, "tenant-metrics", false, "Serve the series of each namespace at <metrics-path>/namespaces/<namespace> to clients whose bearer token is allowed to get the pods of the namespace, reviewed with TokenReview and SubjectAccessReview.")
+	flag.Float64Var(&tenantReviewRateLimit, "tenant-review-rate-limit", 5, "Reviews per second each client, by remote address, may trigger with -tenant-metrics for tokens not reviewed within the last minute, in bursts of as many. Unlimited when 0.")
+	flag.StringVar(&verbosityLogLevel, "log.verbosity", "0", "Verbosity log level")
+	flag.StringVar(&healthProbeAddress, "health-probe-address", ":8081", "Address on which to expose /healthz and /readyz.")
+	flag.BoolVar(&devMode, "dev-mode", false, "Run against a built-in fake kubelet, which also serves as api server, instead of a cluster, to run the exporter locally. Flags that need the api server are not supported.")
+	flag.StringVar(&e2eNamespace, "e2e-namespace", "default", "Namespace of the test pod of the e2e command.")
+	flag.StringVar(&e2eExporterSelector, "e2e-exporter-selector", "k8s-app=k8s-ephemeral-storage-metrics", "Label selector of the exporter pods the e2e command scrapes, in any namespace.")
+	flag.StringVar(&e2eImage, "e2e-image", "busybox:1.36", "Image of the test pod of the e2e command, with sh and dd.")
+	flag.DurationVar(&e2eTimeout, "e2e-timeout", 5*time.Minute, "Timeout of the e2e command.")
+	flag.StringVar(&loadgenNamespace, "loadgen-namespace", "default", "Namespace of the pods of the loadgen command.")
+	flag.IntVar(&loadgenPods, "loadgen-pods", 3, "Number of pods the loadgen command creates.")
+	flag.StringVar(&loadgenRate, "loadgen-rate", "1Mi", "Bytes each pod of the loadgen command writes per second.")
+	flag.StringVar(&loadgenMaxBytes, "loadgen-max-bytes", "1Gi", "Bytes after which each pod of the loadgen command stops writing.")
+	flag.StringVar(&loadgenLimit, "loadgen-limit", "", "Ephemeral storage limit of the pods of the loadgen command, e.g. below -loadgen-max-bytes to have them evicted. No limit when empty.")
+	flag.StringVar(&loadgenTarget, "loadgen-target", "emptydir", "Where the pods of the loadgen command write, emptydir for an emptyDir volume or rootfs for their writable layer.")
+	flag.StringVar(&loadgenImage, "loadgen-image", "busybox:1.36", "Image of the pods of the loadgen command, with sh and dd.")
+	flag.DurationVar(&loadgenDuration, "loadgen-duration", 10*time.Minute, "Duration after which the loadgen command deletes its pods, until interrupted when 0.")
+	flag.BoolVar(&leaderElect, "leader-elect", false, "Enable leader election so that only one replica collects stats.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "k8s-ephemeral-storage-metrics", "Name of the lease used for leader election.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace of the leader election lease. Defaults to the pod namespace when running in-cluster.")
+	flag.StringVar(&kubeContext, "context", "", "Name of the kubeconfig context to use. Defaults to the current context.")
+	flag.StringVar(&apiServer, "apiserver", "", "Address of the Kubernetes API server. Overrides the server of the kubeconfig or in-cluster config.")
+	flag.BoolVar(&excludeCompletedPods, "exclude-completed-pods", false, "Exclude pods in the Succeeded or Failed phase.")
+	flag.BoolVar(&excludeTerminatingPods, "exclude-terminating-pods", false, "Exclude pods that are being deleted.")
+	flag.BoolVar(&excludeGenericEphemeral, "exclude-generic-ephemeral-volumes", false, "Exclude generic ephemeral volumes, which are backed by a persistent volume claim, from volume metrics.")
+	flag.BoolVar(&dedupeEmptyDir, "dedupe-emptydir", false, "Correct the ephemeral storage of pods whose kubelet counts their emptyDir volumes twice, on nodes whose container runtime has the emptydir-double-counted quirk, detected when it matches the writable layers and logs of their containers plus twice their node-local volumes.")
+	flag.BoolVar(&podPhaseLabel, "pod-phase-label", false, "Add a pod_phase label to pod metrics.")
+	flag.BoolVar(&recommendedLabels, "recommended-labels", false, "Add app_name, app_instance and app_component labels to pod metrics from the app.kubernetes.io/name, instance and component pod labels.")
+	flag.BoolVar(&leanPodLabels, "lean-pod-labels", false, "Only label pod, container, volume, inode and cost series with namespace_name and pod_name, and export the node, workload, QoS class and priority class of pods once in ephemeral_storage_pod_info. Requires -collector.podinfo.")
+	flag.DurationVar(&kubeletRestartGrace, "kubelet-restart-grace", time.Minute, "Duration after a kubelet restart during which pods the kubelet reports without stats keep their previous stats. Disabled when 0.")
+	flag.DurationVar(&maxStatsAge, "max-stats-age", 0, "Drop the pod and node filesystem stats the kubelet reports with an FsStats time older than this, since kubelets under load serve stale disk stats. Disabled when 0.")
+	flag.IntVar(&staleAfterFailures, "stale-after-failures", 3, "Set ephemeral_storage_stats_stale of a node to 1 after this many consecutive failed stat summary requests, while the stats of the last successful one are still exported. Disabled when 0.")
+	flag.Float64Var(&scrapeErrorBudget, "scrape-error-budget", 0, "Fraction of the stat summary requests of the last 5 minutes that may fail, e.g. 0.1, beyond which failed requests are retried with an exponential backoff up to 5m instead of at the scrape interval. Disabled when 0.")
+	flag.IntVar(&watchdogIntervals, "watchdog-intervals", 3, "Restart the collection loop if it did not complete a cycle in this many scrape intervals, e.g. because a request hangs. Disabled when 0.")
+	flag.BoolVar(&podPeakUsage, "pod-peak-usage", false, "Export ephemeral_storage_pod_peak_used_bytes, the max used bytes observed for each pod, to right-size limits.")
+	flag.DurationVar(&maxGrowthWindow, "max-growth-window", 0, "Export the max growth of used bytes between two consecutive kubelet summaries over this sliding window. Disabled when 0.")
+	flag.BoolVar(&workloadSummaries, "workload-summaries", false, "Export p50/p95/p99 of pod used bytes per workload.")
+	flag.DurationVar(&workloadSummaryMaxAge, "workload-summary-max-age", 10*time.Minute, "Duration for which observations are kept in workload summaries.")
+	flag.IntVar(&topNPerNode, "top-n-per-node", 0, "Export pod series only for the N pods using the most bytes on each node and sum the others into pod_name=\"others\". Disabled when 0.")
+	flag.StringVar(&minUsedBytes, "min-used-bytes", "", "Used bytes, e.g. 10Mi, below which pods do not get their own series and are summed into pod_name=\"others\". Disabled when empty.")
+	flag.BoolVar(&skipZeroCapacity, "skip-zero-capacity", false, "Do not export the available and capacity bytes of pods and node filesystems while they report a capacity of 0, so that ratios over them are absent instead of Inf or NaN.")
+	flag.BoolVar(&requirePermissions, "require-permissions", true, "Exit at startup if the RBAC access review denies a required permission. When false, denied permissions are only logged.")
+	flag.StringVar(&nodeName, "node-name", "", "Name of the node to scrape. Defaults to CURRENT_NODE_NAME, the content of -node-name-file or the node matching the host name.")
+	flag.StringVar(&nodeNameFile, "node-name-file", "/etc/podinfo/nodename", "File containing the name of the node to scrape, used when neither -node-name nor CURRENT_NODE_NAME is set.")
+	flag.Var(&clusters, "cluster", "Kubeconfig context of a cluster whose nodes are all scraped, as <context> or <name>=<context>. Series get a cluster label of the name. Can be repeated.")
+	flag.IntVar(&namespaceShards, "namespace-shards", 0, "Number of -cluster replicas the pods are sharded over by a hash of their namespace, so that each replica exports the pod series of its namespaces only. Disabled when 0.")
+	flag.IntVar(&namespaceShard, "namespace-shard", 0, "Index of the shard of this replica with -namespace-shards, from 0.")
+	flag.StringVar(&agentTarget, "agent", "", "Address of an aggregator to push the snapshots of the node to over gRPC.")
+	flag.StringVar(&aggregatorAddress, "aggregator", "", "Address on which to receive snapshots from agents over gRPC. The metrics of all agents are then exposed instead of the metrics of a node.")
+	flag.StringVar(&grpcTLSCertFile, "grpc-tls-cert-file", "", "File containing the PEM certificate chain -aggregator serves, or the client certificate of -agent for mutual TLS. Requires -grpc-tls-key-file.")
+	flag.StringVar(&grpcTLSKeyFile, "grpc-tls-key-file", "", "File containing the PEM private key of -grpc-tls-cert-file.")
+	flag.StringVar(&grpcTLSCAFile, "grpc-tls-ca-file", "", "File containing the PEM CA certificates verifying the aggregator with -agent, the system roots when empty, and the client certificates of agents with -aggregator, which then requires one.")
+	flag.StringVar(&grpcTokenFile, "grpc-token-file", "", "File containing the bearer token -agent sends and -aggregator requires.")
+	flag.BoolVar(&grpcInsecure, "grpc-insecure", false, "Connect -agent and -aggregator over plaintext gRPC without authentication, e.g. on a trusted network. Otherwise the connection uses TLS and is authenticated with -grpc-token-file or client certificates.")
+	flag.DurationVar(&aggregatorNodeTTL, "aggregator-node-ttl", time.Minute, "Duration after which the aggregator drops a node whose agent pushed nothing.")
+	flag.BoolVar(&metricsCompression, "metrics-compression", true, "Gzip the metrics response if the scraper accepts it.")
+	flag.IntVar(&metricsMaxRequests, "metrics-max-requests", 0, "Maximum number of concurrent metrics requests, others get a 503. Unlimited when 0.")
+	flag.DurationVar(&metricsTimeout, "metrics-timeout", 0, "Timeout of a metrics request, after which a 503 is returned. Disabled when 0.")
+	flag.StringVar(&metricsErrorHandling, "metrics-error-handling", "http", "How a metrics request handles collection errors: http (respond 500), continue (serve the metrics collected without error) or panic.")
+	flag.BoolVar(&metricsOpenMetrics, "metrics-openmetrics", false, "Serve the OpenMetrics format to scrapers that negotiate it.")
+	flag.DurationVar(&metricsSparseHeartbeat, "metrics-sparse-heartbeat", 0, "Expose gauges and counters that did not change with the timestamp of their last change, and with the current one at least every heartbeat, which must be shorter than 5m. Reduces the samples Prometheus stores and remote-writes. Disabled when 0.")
+	flag.Float64Var(&metricsSparseDelta, "metrics-sparse-delta", 0, "Relative change of a value, e.g. 0.01 for 1%, below which it is considered unchanged with -metrics-sparse-heartbeat.")
+	flag.BoolVar(&failScrapeOnError, "fail-scrape-on-error", false, "Fail metrics requests while the last stat summary request of a node failed, instead of exposing the stats of the last successful request. Responds 500 with -metrics-error-handling=http.")
+	flag.DurationVar(&leakMinDuration, "leak-min-duration", 0, "Export ephemeral_storage_pod_suspected_leak, the growth rate of pods whose used bytes grew without decreasing for longer than this, e.g. 24h. Disabled when 0.")
+	flag.Var(&usageAverages, "usage-averages", "Comma separated windows, e.g. 5m,30m,1h, over which the average used bytes of every pod is exported. Disabled when empty.")
+	flag.BoolVar(&evictionSimulation, "eviction-simulation", false, "Serve /api/v1/simulate-eviction, which ranks the pods of the node in the order the kubelet would evict them under disk pressure.")
+	flag.StringVar(&mountsFile, "mounts-file", "", "Mount table of the host in the format of /proc/mounts, e.g. /proc/1/mounts mounted from the host, to label the node filesystem metrics with the device, mountpoint and fstype of their disk. Only for the node the exporter runs on. Disabled when empty.")
+	flag.DurationVar(&nodeSaturationHorizon, "node-saturation-horizon", 0, "Export ephemeral_storage_node_saturation, a 0 to 1 score of the node filesystem combining its available bytes, the eviction threshold and whether the growth of its pods reaches it within this horizon, e.g. 6h. Disabled when 0.")
+	flag.BoolVar(&influx, "influx", false, "Serve the series of the metrics endpoint in the InfluxDB line protocol on GET /influx, for Telegraf, behind -api-token-file and -api-rate-limit like the JSON endpoints.")
+	flag.BoolVar(&rawSummary, "raw-summary", false, "Serve the last stat summary of the kubelet as it responded on GET /api/v1/raw-summary, so that other agents of the node reuse it instead of requesting the kubelet.")
+	flag.StringVar(&recordDir, "record-dir", "", "Directory to write the stat summaries of the nodes to as the kubelet responded them, one file per request in a directory per node, to reproduce metric bugs with -replay-dir. Disabled when empty.")
+	flag.IntVar(&recordMaxFiles, "record-max-files", 1000, "Number of the last stat summaries of each node kept in -record-dir, all when 0.")
+	flag.StringVar(&replayDir, "replay-dir", "", "Directory of a node in -record-dir whose stat summaries are served, one per request, by a built-in fake kubelet like -dev-mode instead of a cluster. Flags that need the api server are not supported.")
+	flag.StringVar(&graphiteAddress, "graphite-address", "", "host:port of the plaintext listener of a carbon server to push the metrics to every -graphite-interval. Disabled when empty.")
+	flag.StringVar(&graphitePrefix, "graphite-prefix", "", "Prefix of the paths of the metrics pushed with -graphite-address, e.g. k8s.prod.")
+	flag.DurationVar(&graphiteInterval, "graphite-interval", time.Minute, "Interval at which the metrics are pushed with -graphite-address.")
+	flag.StringVar(&zabbixServer, "zabbix-server", "", "host:port of the trapper of a Zabbix server or proxy to send the ephemeral storage of nodes and pods to every -zabbix-interval, each node as the host of its name. Disabled when empty.")
+	flag.DurationVar(&zabbixInterval, "zabbix-interval", time.Minute, "Interval at which the ephemeral storage is sent with -zabbix-server.")
+	flag.Var(&sinkExec, "sink-exec", "Command, its executable and arguments separated by spaces, run every -sink-exec-interval with the stats of the nodes as JSON on its standard input, to push them to a proprietary sink. Disabled when empty.")
+	flag.DurationVar(&sinkExecInterval, "sink-exec-interval", time.Minute, "Interval at which the command of -sink-exec is run, and after which it is killed.")
+	flag.StringVar(&snmpAddress, "snmp-address", "", "UDP address, e.g. :161, on which to serve the ephemeral storage of nodes to SNMPv2c requests, see mibs/EPHEMERAL-STORAGE-MIB.txt. Disabled when empty.")
+	flag.BoolVar(&ephemeralMetricsAPI, "ephemeral-metrics-api", false, "Serve the ephemeral storage of pods and nodes as the API group ephemeralmetrics.k8s.io below /apis/, to be registered with an APIService and read with kubectl get --raw. Requires -tls-cert-file.")
+	flag.StringVar(&ephemeralMetricsCAFile, "ephemeral-metrics-api-client-ca-file", "", "File containing the PEM requestheader client CA of the api server, e.g. front-proxy-ca.crt, to only serve -ephemeral-metrics-api to requests proxied by the api server. Guarded by -api-token-file and -api-rate-limit like the JSON endpoints when empty.")
+	flag.StringVar(&snmpCommunityFile, "snmp-community-file", "", "File containing the community of SNMP requests with -snmp-address. public when empty.")
+	flag.DurationVar(&diffRetention, "debug-diff-retention", 0, "Retain the pod stats of the node for this duration and serve /debug/diff, which reports the pods that grew or shrank the most. Disabled when 0.")
+	flag.IntVar(&debugErrors, "debug-errors", 100, "Number of the last failed stat summary requests served at /debug/errors, with their time, node and cause. Disabled when 0.")
+	flag.BoolVar(&nodeDraining, "node-draining", false, "Export ephemeral_storage_node_draining, 1 while the node is cordoned or drained, to silence alerts during maintenance.")
+	flag.StringVar(&apiTokenFile, "api-token-file", "", "File containing the bearer tokens, one per line, of the JSON endpoints below /api/v1/ and /debug/, except the admin ones, of /influx and of -ephemeral-metrics-api without its client CA. Unauthenticated when empty.")
+	flag.Float64Var(&apiRateLimit, "api-rate-limit", 0, "Requests per second each client, by token or by remote address without -api-token-file, may send to the JSON endpoints below /api/v1/ and /debug/, to /influx and to -ephemeral-metrics-api without its client CA, in bursts of as many. Unlimited when 0.")
+	flag.StringVar(&adminTokenFile, "admin-token-file", "", "File containing the bearer token of the admin endpoints POST /-/pause and /-/resume, which stop and restart stat summary requests, POST /-/scrape-now, which requests one immediately, and GET /-/config, which returns the effective configuration. Disabled when empty.")
+	flag.StringVar(&hostRoot, "host-root", "", "Path where the host filesystem, at least /var/lib/kubelet/pods and /var/log/pods, is mounted, to serve GET /api/v1/pods/<uid>/largest-files with -admin-token-file, for -cleanup and for -pod-allocation. Disabled when empty.")
+	flag.Float64Var(&usageResetDrop, "usage-reset-drop", 0, "Count the drops of the used bytes of pods by at least this fraction between two summaries, e.g. 0.5, in ephemeral_storage_pod_usage_reset_total, by whether a container of the pod restarted in between. Disabled when 0.")
+	flag.BoolVar(&podAllocation, "pod-allocation", false, "Export the ephemeral storage the kubelet allocated to pods from its allocation checkpoint in /var/lib/kubelet, and whether it diverges from their spec. Requires -host-root.")
+	flag.BoolVar(&cleanupScratch, "cleanup", false, "Delete old files of the emptyDir volume of pods annotated with a cleanup policy when they are above its threshold. Requires -host-root mounted read-write. See the README for the annotations.")
+	flag.DurationVar(&hotScrapeInterval, "hot-scrape-interval", 0, "Interval between stat summary requests while the node has a hot pod, i.e. a pod matching -hot-pod-used-bytes or -hot-pod-selector, or is below -hot-node-available. Disabled when 0.")
+	flag.StringVar(&hotPodUsedBytes, "hot-pod-used-bytes", "", "Used bytes, e.g. 5Gi, from which a pod is hot. See -hot-scrape-interval.")
+	flag.StringVar(&hotPodSelector, "hot-pod-selector", "", "Label selector of hot pods, e.g. tier=batch. See -hot-scrape-interval.")
+	flag.StringVar(&hotNodeAvailable, "hot-node-available", "", "Available bytes of the node filesystem, e.g. 5Gi, or percentage of its capacity, e.g. 10%, below which the node is hot. See -hot-scrape-interval.")
+	flag.StringVar(&kubeletAddressTypes, "kubelet-address-types", "", "Comma separated node address types, e.g. InternalIP,Hostname, in order of preference, to request the kubelet at directly instead of through the api server node proxy. Disabled when empty.")
+	flag.IntVar(&kubeletPort, "kubelet-port", 10250, "Port of the kubelet API with -kubelet-address-types.")
+	flag.Var(&kubeletHostOverrides, "kubelet-host-override", "Host, or host:port, of the kubelet of a node as <node>=<host>, e.g. where node names are not resolvable, with -kubelet-address-types. Can be repeated.")
+	flag.BoolVar(&kubeletInsecureTLS, "kubelet-insecure-tls", false, "Do not verify the serving certificate of kubelets with -kubelet-address-types, e.g. when it is self-signed.")
+	flag.StringVar(&proxyURLFlag, "proxy-url", "", "URL of an HTTP proxy for the requests to api servers and kubelets and the connection to the aggregator, except to hosts of NO_PROXY. Defaults to HTTPS_PROXY.")
+	flag.StringVar(&tlsMinVersion, "tls-min-version", "1.2", "Minimum TLS version, 1.2 or 1.3, of the web server with -tls-cert-file and of the connections to api servers and kubelets.")
+	flag.StringVar(&tlsCipherSuites, "tls-cipher-suites", "", "Comma separated TLS 1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, of the web server and of the connections to api servers and kubelets. Defaults to the Go defaults.")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "File containing the PEM certificate chain to serve HTTPS on -listen-address with. Requires -tls-key-file.")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "File containing the PEM private key of -tls-cert-file.")
+	flag.Float64Var(&pricePerGiBHour, "price-per-gib-hour", 0, "Price of a GiB-hour of ephemeral storage, to export ephemeral_storage_pod_estimated_cost_per_hour. Overrides cost.pricePerGiBHour of the config file.")
+	flag.StringVar(&configFile, "config", "", "Path of a YAML config file, e.g. to rename metrics. See the README for the settings.")
+	enabledCollectors.RegisterFlags(flag.CommandLine)
+
+	// Fault injection is meant for staging, so its flags are left out of the usage.
+	flag.BoolVar(&chaos, "chaos", false, "Serve /-/chaos with -admin-token-file, which fails stat summary requests or spikes the used bytes of a pod or node on demand, to test alert rules and runbooks end to end.")
+	flag.DurationVar(&chaosMaxDuration, "chaos-max-duration", time.Hour, "Longest fault /-/chaos injects with -chaos.")
+	flag.Usage = usage
+}
+
+// hiddenFlags are left out of the usage.
+var hiddenFlags = map[string]bool{"chaos": true, "chaos-max-duration": true}
+
+// usage prints the defaults of the flags like the flag package does, without hiddenFlags.
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// validateFlags returns every invalid flag value or combination.
+func validateFlags() []error {
+	var errs []error
+	if scrapeIntervalSecond <= 0 {
+		errs = append(errs, fmt.Errorf("-scrape-interval must be positive, got %d", scrapeIntervalSecond))
+	}
+	if topNPerNode < 0 {
+		errs = append(errs, fmt.Errorf("-top-n-per-node must not be negative, got %d", topNPerNode))
+	}
+	if _, err := minUsedBytesFlag(); err != nil {
+		errs = append(errs, err)
+	}
+	if maxGrowthWindow < 0 {
+		errs = append(errs, fmt.Errorf("-max-growth-window must not be negative, got %v", maxGrowthWindow))
+	} else if maxGrowthWindow > 0 && maxGrowthWindow < time.Duration(scrapeIntervalSecond)*time.Second {
+		errs = append(errs, fmt.Errorf("-max-growth-window (%v) must be at least -scrape-interval (%ds) to observe any growth", maxGrowthWindow, scrapeIntervalSecond))
+	}
+	if workloadSummaries && workloadSummaryMaxAge <= 0 {
+		errs = append(errs, fmt.Errorf("-workload-summary-max-age must be positive with -workload-summaries, got %v", workloadSummaryMaxAge))
+	}
+	if len(clusters) > 0 && podInformerEnabled() {
+		errs = append(errs, errors.New("-cluster does not support flags that need pod objects"))
+	}
+	for _, w := range usageAverages {
+		if w < time.Duration(scrapeIntervalSecond)*time.Second {
+			errs = append(errs, fmt.Errorf("-usage-averages window %v must be at least -scrape-interval (%ds)", w, scrapeIntervalSecond))
+		}
+	}
+	if len(usageAverages) > 0 && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -usage-averages"))
+	}
+	if leakMinDuration < 0 {
+		errs = append(errs, fmt.Errorf("-leak-min-duration must not be negative, got %v", leakMinDuration))
+	}
+	if leakMinDuration > 0 && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -leak-min-duration"))
+	}
+	if nodeSaturationHorizon < 0 {
+		errs = append(errs, fmt.Errorf("-node-saturation-horizon must not be negative, got %v", nodeSaturationHorizon))
+	}
+	if nodeSaturationHorizon > 0 && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -node-saturation-horizon"))
+	}
+	if evictionSimulation && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -eviction-simulation"))
+	}
+	if kubeletAddressTypes == "" {
+		if len(kubeletHostOverrides) > 0 || kubeletInsecureTLS {
+			errs = append(errs, errors.New("-kubelet-host-override and -kubelet-insecure-tls require -kubelet-address-types"))
+		}
+	} else {
+		if aggregatorAddress != "" || len(clusters) > 0 {
+			errs = append(errs, errors.New("-aggregator and -cluster do not support -kubelet-address-types"))
+		}
+		if _, err := parseAddressTypes(kubeletAddressTypes); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -kubelet-address-types: %v", err))
+		}
+	}
+	if kubeletPort <= 0 || kubeletPort > 65535 {
+		errs = append(errs, fmt.Errorf("-kubelet-port must be a port number, got %d", kubeletPort))
+	}
+	if proxyURLFlag != "" {
+		if u, err := url.Parse(proxyURLFlag); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -proxy-url: %v", err))
+		} else if u.Scheme != "http" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("-proxy-url must be an http://<host>:<port> URL, got %q", proxyURLFlag))
+		}
+	}
+	if _, err := transport.ParseTLSPolicy(tlsMinVersion, tlsCipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -tls-min-version or -tls-cipher-suites: %v", err))
+	}
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		errs = append(errs, errors.New("-tls-cert-file and -tls-key-file must be set together"))
+	}
+	if leanPodLabels {
+		if !enabledCollectors["podinfo"] {
+			errs = append(errs, errors.New("-lean-pod-labels requires -collector.podinfo"))
+		}
+		if podPhaseLabel || recommendedLabels {
+			errs = append(errs, errors.New("-lean-pod-labels does not support -pod-phase-label and -recommended-labels"))
+		}
+	}
+	if kubeletRestartGrace < 0 {
+		errs = append(errs, fmt.Errorf("-kubelet-restart-grace must not be negative, got %v", kubeletRestartGrace))
+	}
+	if maxStatsAge < 0 {
+		errs = append(errs, fmt.Errorf("-max-stats-age must not be negative, got %v", maxStatsAge))
+	}
+	if staleAfterFailures < 0 {
+		errs = append(errs, fmt.Errorf("-stale-after-failures must not be negative, got %d", staleAfterFailures))
+	}
+	if scrapeErrorBudget < 0 || scrapeErrorBudget >= 1 {
+		errs = append(errs, fmt.Errorf("-scrape-error-budget must be in [0, 1), got %v", scrapeErrorBudget))
+	}
+	if watchdogIntervals < 0 {
+		errs = append(errs, fmt.Errorf("-watchdog-intervals must not be negative, got %d", watchdogIntervals))
+	}
+	if podPeakUsage && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -pod-peak-usage"))
+	}
+	if diffRetention < 0 {
+		errs = append(errs, fmt.Errorf("-debug-diff-retention must not be negative, got %v", diffRetention))
+	} else if diffRetention > 0 && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -debug-diff-retention"))
+	}
+	if rawSummary && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -raw-summary"))
+	}
+	if graphiteInterval <= 0 {
+		errs = append(errs, fmt.Errorf("-graphite-interval must be positive, got %v", graphiteInterval))
+	}
+	if graphiteAddress != "" {
+		if _, _, err := net.SplitHostPort(graphiteAddress); err != nil {
+			errs = append(errs, fmt.Errorf("-graphite-address: %v", err))
+		}
+	}
+	if strings.HasPrefix(graphitePrefix, ".") || strings.HasSuffix(graphitePrefix, ".") {
+		errs = append(errs, fmt.Errorf("-graphite-prefix must not start or end with a dot, got %q", graphitePrefix))
+	}
+	if zabbixInterval <= 0 {
+		errs = append(errs, fmt.Errorf("-zabbix-interval must be positive, got %v", zabbixInterval))
+	}
+	if zabbixServer != "" {
+		if _, _, err := net.SplitHostPort(zabbixServer); err != nil {
+			errs = append(errs, fmt.Errorf("-zabbix-server: %v", err))
+		}
+	}
+	if len(sinkExec) > 0 {
+		if _, err := exec.LookPath(sinkExec[0]); err != nil {
+			errs = append(errs, fmt.Errorf("-sink-exec: %v", err))
+		}
+	}
+	if sinkExecInterval <= 0 {
+		errs = append(errs, fmt.Errorf("-sink-exec-interval must be positive, got %v", sinkExecInterval))
+	}
+	if ephemeralMetricsAPI && tlsCertFile == "" {
+		errs = append(errs, errors.New("-ephemeral-metrics-api requires -tls-cert-file, the api server proxies to it over HTTPS"))
+	}
+	if ephemeralMetricsCAFile != "" && !ephemeralMetricsAPI {
+		errs = append(errs, errors.New("-ephemeral-metrics-api-client-ca-file requires -ephemeral-metrics-api"))
+	}
+	if snmpCommunityFile != "" && snmpAddress == "" {
+		errs = append(errs, errors.New("-snmp-community-file requires -snmp-address"))
+	}
+	if debugErrors < 0 {
+		errs = append(errs, fmt.Errorf("-debug-errors must not be negative, got %d", debugErrors))
+	}
+	if nodeDraining && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -node-draining"))
+	}
+	if apiRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("-api-rate-limit must not be negative, got %v", apiRateLimit))
+	}
+	if tenantReviewRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("-tenant-review-rate-limit must not be negative, got %v", tenantReviewRateLimit))
+	}
+	if adminTokenFile != "" && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -admin-token-file"))
+	}
+	if hostRoot != "" && adminTokenFile == "" && !cleanupScratch && !podAllocation {
+		errs = append(errs, errors.New("-host-root requires -admin-token-file, -cleanup or -pod-allocation"))
+	}
+	if chaos && adminTokenFile == "" {
+		errs = append(errs, errors.New("-chaos requires -admin-token-file"))
+	}
+	if chaosMaxDuration <= 0 {
+		errs = append(errs, fmt.Errorf("-chaos-max-duration must be positive, got %v", chaosMaxDuration))
+	}
+	if recordMaxFiles < 0 {
+		errs = append(errs, fmt.Errorf("-record-max-files must not be negative, got %v", recordMaxFiles))
+	}
+	if mountsFile != "" && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -mounts-file, the mount table is the one of a single node"))
+	}
+	if recordDir != "" && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -record-dir, set it on the agents"))
+	}
+	if replayDir != "" && devMode {
+		errs = append(errs, errors.New("-replay-dir and -dev-mode are mutually exclusive"))
+	}
+	if replayDir != "" && maxStatsAge > 0 {
+		errs = append(errs, errors.New("-replay-dir does not support -max-stats-age, the recorded stats are as old as the recording"))
+	}
+	// -replay-dir runs against a fake kubelet like -dev-mode.
+	fakeKubeletFlag := ""
+	if devMode {
+		fakeKubeletFlag = "-dev-mode"
+	} else if replayDir != "" {
+		fakeKubeletFlag = "-replay-dir"
+	}
+	if fakeKubeletFlag != "" && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, fmt.Errorf("%s does not support -aggregator and -cluster", fakeKubeletFlag))
+	}
+	if fakeKubeletFlag != "" && (leaderElect || tenantMetrics || kubeletAddressTypes != "" || nodeDraining || podInformerEnabled()) {
+		errs = append(errs, fmt.Errorf("%s does not support flags that need the api server: -leader-elect, -tenant-metrics, -kubelet-address-types, -node-draining and flags that need pod objects", fakeKubeletFlag))
+	}
+	if usageResetDrop < 0 || usageResetDrop >= 1 {
+		errs = append(errs, fmt.Errorf("-usage-reset-drop must be in [0, 1), got %v", usageResetDrop))
+	}
+	if usageResetDrop > 0 && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -usage-reset-drop"))
+	}
+	if podAllocation && hostRoot == "" {
+		errs = append(errs, errors.New("-pod-allocation requires -host-root"))
+	}
+	if podAllocation && (aggregatorAddress != "" || len(clusters) > 0) {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -pod-allocation"))
+	}
+	if cleanupScratch && hostRoot == "" {
+		errs = append(errs, errors.New("-cleanup requires -host-root"))
+	}
+	if cleanupScratch && aggregatorAddress != "" {
+		errs = append(errs, errors.New("-aggregator does not support -cleanup"))
+	}
+	if hotScrapeInterval != 0 {
+		errs = append(errs, validateHotFlags()...)
+	} else if hotPodUsedBytes != "" || hotPodSelector != "" || hotNodeAvailable != "" {
+		errs = append(errs, errors.New("-hot-pod-used-bytes, -hot-pod-selector and -hot-node-available require -hot-scrape-interval"))
+	}
+	if pricePerGiBHour < 0 {
+		errs = append(errs, fmt.Errorf("-price-per-gib-hour must not be negative, got %v", pricePerGiBHour))
+	}
+	if metricsMaxRequests < 0 {
+		errs = append(errs, fmt.Errorf("-metrics-max-requests must not be negative, got %d", metricsMaxRequests))
+	}
+	if metricsTimeout < 0 {
+		errs = append(errs, fmt.Errorf("-metrics-timeout must not be negative, got %v", metricsTimeout))
+	}
+	if metricsSparseHeartbeat < 0 || metricsSparseHeartbeat >= 5*time.Minute {
+		errs = append(errs, fmt.Errorf("-metrics-sparse-heartbeat must be shorter than the 5m lookback of Prometheus, got %v", metricsSparseHeartbeat))
+	}
+	if metricsSparseDelta < 0 {
+		errs = append(errs, fmt.Errorf("-metrics-sparse-delta must not be negative, got %v", metricsSparseDelta))
+	}
+	if _, ok := errorHandlings[metricsErrorHandling]; !ok {
+		errs = append(errs, fmt.Errorf("-metrics-error-handling must be http, continue or panic, got %q", metricsErrorHandling))
+	}
+	if agentTarget != "" && len(clusters) > 0 {
+		errs = append(errs, errors.New("-cluster and -agent are exclusive"))
+	}
+	if aggregatorAddress != "" {
+		switch {
+		case agentTarget != "":
+			errs = append(errs, errors.New("-agent and -aggregator are exclusive"))
+		case len(clusters) > 0:
+			errs = append(errs, errors.New("-cluster and -aggregator are exclusive"))
+		case workloadSummaries || enabledCollectors.NeedsPods():
+			errs = append(errs, errors.New("-aggregator does not support -workload-summaries and collectors that need pod objects"))
+		}
+		if aggregatorNodeTTL <= 0 {
+			errs = append(errs, fmt.Errorf("-aggregator-node-ttl must be positive, got %v", aggregatorNodeTTL))
+		}
+	}
+	grpcCredentials := grpcTLSCertFile != "" || grpcTLSKeyFile != "" || grpcTLSCAFile != "" || grpcTokenFile != ""
+	switch {
+	case agentTarget == "" && aggregatorAddress == "":
+		if grpcCredentials || grpcInsecure {
+			errs = append(errs, errors.New("-grpc-* flags require -agent or -aggregator"))
+		}
+	case grpcInsecure:
+		if grpcCredentials {
+			errs = append(errs, errors.New("-grpc-insecure and the -grpc-tls-* and -grpc-token-file flags are exclusive"))
+		}
+	case (grpcTLSCertFile == "") != (grpcTLSKeyFile == ""):
+		errs = append(errs, errors.New("-grpc-tls-cert-file and -grpc-tls-key-file must be set together"))
+	case aggregatorAddress != "" && (grpcTLSCertFile == "" || grpcTokenFile == "" && grpcTLSCAFile == ""):
+		errs = append(errs, errors.New("-aggregator requires -grpc-tls-cert-file and -grpc-token-file or -grpc-tls-ca-file, or -grpc-insecure"))
+	case agentTarget != "" && grpcTokenFile == "" && grpcTLSCertFile == "":
+		errs = append(errs, errors.New("-agent requires -grpc-token-file or -grpc-tls-cert-file, or -grpc-insecure"))
+	}
+	if namespaceShards < 0 {
+		errs = append(errs, fmt.Errorf("-namespace-shards must not be negative, got %d", namespaceShards))
+	}
+	if tenantMetrics && len(clusters) > 0 {
+		errs = append(errs, errors.New("-cluster does not support -tenant-metrics, namespaces of remote clusters are not authorized"))
+	}
+	if namespaceShards > 0 && len(clusters) == 0 {
+		errs = append(errs, errors.New("-namespace-shards requires -cluster"))
+	}
+	if namespaceShard < 0 || (namespaceShard > 0 && namespaceShard >= namespaceShards) {
+		errs = append(errs, fmt.Errorf("-namespace-shard must be between 0 and -namespace-shards - 1, got %d", namespaceShard))
+	}
+	errs = append(errs, validateDecorators()...)
+	seen := map[string]bool{}
+	for _, c := range clusters {
+		if seen[c.name] {
+			errs = append(errs, fmt.Errorf("-cluster %s is given twice", c.name))
+		}
+		seen[c.name] = true
+	}
+	return errs
+}
+
+// reservedLabelNames are the labels of the series decorators add their labels to.
+var reservedLabelNames = []string{
+	"node_name", "namespace_name", "pod_name", "pod_phase", "app_name", "app_instance", "app_component",
+	"container_name", "volume_name", "pvc_name", "generic_ephemeral",
+	"uid", "workload_kind", "workload_name", "qos_class", "priority_class", "cluster",
+}
+
+// validateDecorators returns the invalid label names of the registered decorators.
+func validateDecorators() []error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, name := range reservedLabelNames {
+		seen[name] = true
+	}
+	for _, name := range provider.DecoratorLabelNames(provider.Decorators()) {
+		switch {
+		case !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix):
+			errs = append(errs, fmt.Errorf("decorator label %q is not a valid label name", name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("decorator label %q is used by the exporter or another decorator", name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+func validateHotFlags() []error {
+	var errs []error
+	if hotScrapeInterval < 0 || hotScrapeInterval >= time.Duration(scrapeIntervalSecond)*time.Second {
+		errs = append(errs, fmt.Errorf("-hot-scrape-interval must be positive and shorter than -scrape-interval (%ds), got %v", scrapeIntervalSecond, hotScrapeInterval))
+	}
+	if aggregatorAddress != "" || len(clusters) > 0 {
+		errs = append(errs, errors.New("-aggregator and -cluster do not support -hot-scrape-interval"))
+	}
+	if hotPodUsedBytes == "" && hotPodSelector == "" && hotNodeAvailable == "" {
+		errs = append(errs, errors.New("-hot-scrape-interval requires -hot-pod-used-bytes, -hot-pod-selector or -hot-node-available"))
+	}
+	if _, _, err := hotPodFlags(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := hotNodeFlag(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// hotPodFlags parses -hot-pod-used-bytes and -hot-pod-selector. The selector is nil if not set.
+func hotPodFlags() (uint64, labels.Selector, error) {
+	var usedBytes uint64
+	if hotPodUsedBytes != "" {
+		q, err := resource.ParseQuantity(hotPodUsedBytes)
+		if err != nil || q.Sign() <= 0 {
+			return 0, nil, fmt.Errorf("-hot-pod-used-bytes must be a positive quantity such as 5Gi, got %q", hotPodUsedBytes)
+		}
+		usedBytes = uint64(q.Value())
+	}
+	var selector labels.Selector
+	if hotPodSelector != "" {
+		var err error
+		if selector, err = labels.Parse(hotPodSelector); err != nil {
+			return 0, nil, fmt.Errorf("invalid -hot-pod-selector: %v", err)
+		}
+	}
+	return usedBytes, selector, nil
+}
+
+// minUsedBytesFlag parses -min-used-bytes, 0 if not set.
+func minUsedBytesFlag() (uint64, error) {
+	if minUsedBytes == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(minUsedBytes)
+	if err != nil || q.Sign() <= 0 {
+		return 0, fmt.Errorf("-min-used-bytes must be a positive quantity such as 10Mi, got %q", minUsedBytes)
+	}
+	return uint64(q.Value()), nil
+}
+
+// hotNodeFlag parses -hot-node-available into bytes or a percentage, both 0 if not set.
+func hotNodeFlag() (uint64, float64, error) {
+	switch {
+	case hotNodeAvailable == "":
+		return 0, 0, nil
+	case strings.HasSuffix(hotNodeAvailable, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(hotNodeAvailable, "%"), 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return 0, 0, fmt.Errorf("-hot-node-available must be a percentage between 0 and 100 such as 10%%, got %q", hotNodeAvailable)
+		}
+		return 0, percent, nil
+	}
+	q, err := resource.ParseQuantity(hotNodeAvailable)
+	if err != nil || q.Sign() <= 0 {
+		return 0, 0, fmt.Errorf("-hot-node-available must be a positive quantity such as 5Gi or a percentage such as 10%%, got %q", hotNodeAvailable)
+	}
+	return uint64(q.Value()), 0, nil
+}
+
+// loadConfig loads -config, or returns an empty config if it is not set.
+func loadConfig() (*config.Config, error) {
+	if configFile == "" {
+		return &config.Config{}, nil
+	}
+	return config.Load(configFile)
+}
+
+// podInformerEnabled reports whether any flag requires pod objects, which are then watched through an informer.
+// The aggregator never watches pods, pod attributes are resolved by the agents.
+func podInformerEnabled() bool {
+	if aggregatorAddress != "" {
+		return false
+	}
+	return excludeCompletedPods || excludeTerminatingPods || podPhaseLabel || recommendedLabels || workloadSummaries ||
+		evictionSimulation || hotPodSelector != "" || cleanupScratch || podAllocation || usageResetDrop > 0 || enabledCollectors.NeedsPods() ||
+		len(provider.Decorators()) > 0
+}
+
+var errorHandlings = map[string]promhttp.HandlerErrorHandling{
+	"http":     promhttp.HTTPErrorOnError,
+	"continue": promhttp.ContinueOnError,
+	"panic":    promhttp.PanicOnError,
+}
+
+// metricsHandlerOpts returns the options of the metrics handler from the -metrics-* flags.
+func metricsHandlerOpts() promhttp.HandlerOpts {
+	return promhttp.HandlerOpts{
+		ErrorLog:            klogLogger{},
+		ErrorHandling:       errorHandlings[metricsErrorHandling],
+		DisableCompression:  !metricsCompression,
+		MaxRequestsInFlight: metricsMaxRequests,
+		Timeout:             metricsTimeout,
+		EnableOpenMetrics:   metricsOpenMetrics,
+	}
+}
+
+// klogLogger logs errors of the metrics handler.
+type klogLogger struct{}
+
+func (klogLogger) Println(v ...interface{}) {
+	klog.ErrorDepth(1, fmt.Sprintln(v...))
+}
+
+func int64FromEnv(env string, defaultValue int64) int64 {
+	str, ok := os.LookupEnv(env)
+	if !ok {
+		return defaultValue
+	}
+
+	num, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return num
+}
+
+// cluster is a cluster given with -cluster.
+type cluster struct {
+	name    string
+	context string
+}
+
+type clusterFlag []cluster
+
+func (f *clusterFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for _, c := range *f {
+		values = append(values, c.name+"="+c.context)
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *clusterFlag) Set(value string) error {
+	name, context, found := strings.Cut(value, "=")
+	if !found {
+		context = name
+	}
+	if name == "" || context == "" {
+		return fmt.Errorf("expected <context> or <name>=<context>, got %q", value)
+	}
+	*f = append(*f, cluster{name: name, context: context})
+	return nil
+}
+
+// hostOverridesFlag maps node names to hosts.
+type hostOverridesFlag map[string]string
+
+func (f *hostOverridesFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for node, host := range *f {
+		values = append(values, node+"="+host)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (f *hostOverridesFlag) Set(value string) error {
+	node, host, found := strings.Cut(value, "=")
+	if !found || node == "" || host == "" {
+		return fmt.Errorf("expected <node>=<host>, got %q", value)
+	}
+	if *f == nil {
+		*f = hostOverridesFlag{}
+	}
+	(*f)[node] = host
+	return nil
+}
+
+// commandFlag is a command line, its executable and arguments separated by spaces. Arguments cannot contain spaces,
+// the command is not run by a shell.
+type commandFlag []string
+
+func (f *commandFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *commandFlag) Set(value string) error {
+	*f = strings.Fields(value)
+	return nil
+}
+
+type durationsFlag []time.Duration
+
+func (f *durationsFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for _, d := range *f {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *durationsFlag) Set(value string) error {
+	*f = nil
+	for _, v := range strings.Split(value, ",") {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*f = append(*f, d)
+	}
+	return nil
+}
+
+// loadAdminToken reads the bearer token of -admin-token-file.
+func loadAdminToken() (string, error) {
+	content, err := os.ReadFile(adminTokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", adminTokenFile)
+	}
+	return token, nil
+}
+
+// grpcSecurity returns the credentials of the connection between -agent and -aggregator.
+func grpcSecurity() (remote.Security, error) {
+	security := remote.Security{
+		Insecure: grpcInsecure,
+		CertFile: grpcTLSCertFile,
+		KeyFile:  grpcTLSKeyFile,
+		CAFile:   grpcTLSCAFile,
+		Policy:   tlsPolicy(),
+	}
+	if grpcTokenFile != "" {
+		content, err := os.ReadFile(grpcTokenFile)
+		if err != nil {
+			return security, err
+		}
+		security.Token = strings.TrimSpace(string(content))
+		if security.Token == "" {
+			return security, fmt.Errorf("%s is empty", grpcTokenFile)
+		}
+	}
+	return security, nil
+}
+
+// loadSNMPCommunity reads the community of -snmp-community-file, public if it is not set.
+func loadSNMPCommunity() (string, error) {
+	if snmpCommunityFile == "" {
+		return "public", nil
+	}
+	content, err := os.ReadFile(snmpCommunityFile)
+	if err != nil {
+		return "", err
+	}
+	community := strings.TrimSpace(string(content))
+	if community == "" {
+		return "", fmt.Errorf("%s is empty", snmpCommunityFile)
+	}
+	return community, nil
+}
+
+// loadEphemeralMetricsCA reads the certificate pool of -ephemeral-metrics-api-client-ca-file, nil if it is not set.
+func loadEphemeralMetricsCA() (*x509.CertPool, error) {
+	if ephemeralMetricsCAFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(ephemeralMetricsCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%s contains no PEM certificate", ephemeralMetricsCAFile)
+	}
+	return pool, nil
+}
+
+// loadAPITokens reads -api-token-file, nil if it is not set. Empty lines and lines starting with # are ignored.
+func loadAPITokens() ([]string, error) {
+	if apiTokenFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(apiTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s has no token", apiTokenFile)
+	}
+	return tokens, nil
+}
+
+// nodeAddressTypes are the address types a node can report.
+var nodeAddressTypes = []corev1.NodeAddressType{
+	corev1.NodeHostName, corev1.NodeInternalIP, corev1.NodeExternalIP, corev1.NodeInternalDNS, corev1.NodeExternalDNS,
+}
+
+func parseAddressTypes(value string) ([]corev1.NodeAddressType, error) {
+	var types []corev1.NodeAddressType
+	for _, v := range strings.Split(value, ",") {
+		addressType := corev1.NodeAddressType(strings.TrimSpace(v))
+		found := false
+		for _, known := range nodeAddressTypes {
+			found = found || addressType == known
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown node address type %q, expected one of %v", addressType, nodeAddressTypes)
+		}
+		types = append(types, addressType)
+	}
+	return types, nil
+}
+
+// kubeletClient returns the client of the kubelets of -kubelet-address-types, or nil to request them through the api
+// server node proxy.
+func kubeletClient(cli kubernetes.Interface, cfg *rest.Config) (*provider.KubeletClient, error) {
+	if kubeletAddressTypes == "" {
+		return nil, nil
+	}
+	types, err := parseAddressTypes(kubeletAddressTypes)
+	if err != nil {
+		return nil, err
+	}
+	return provider.NewKubeletClient(cli, cfg, provider.KubeletOptions{
+		Port:               kubeletPort,
+		AddressTypes:       types,
+		HostOverrides:      kubeletHostOverrides,
+		InsecureSkipVerify: kubeletInsecureTLS,
+	})
+}
+
+// proxyURL returns the URL of -proxy-url, or nil if it is not set.
+func proxyURL() *url.URL {
+	if proxyURLFlag == "" {
+		return nil
+	}
+	// Validated by validateFlags.
+	u, _ := url.Parse(proxyURLFlag)
+	return u
+}
+
+// tlsPolicy returns the policy of -tls-min-version and -tls-cipher-suites.
+func tlsPolicy() transport.TLSPolicy {
+	// Validated by validateFlags.
+	policy, _ := transport.ParseTLSPolicy(tlsMinVersion, tlsCipherSuites)
+	return policy
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// loadgenName is the name prefix and app.kubernetes.io/name label of the pods of loadgen.
+	loadgenName = "ephemeral-storage-loadgen"
+	// loadgenPollInterval is the interval at which loadgen reports the pods that changed.
+	loadgenPollInterval = 5 * time.Second
+)
+
+// loadgenSpec is the write load of the pods of loadgen, from its flags.
+type loadgenSpec struct {
+	rate     int64
+	maxBytes int64
+	limit    *resource.Quantity
+	target   string
+}
+
+// loadgen creates -loadgen-pods pods in -loadgen-namespace writing -loadgen-rate bytes per second to an emptyDir
+// volume or their writable layer, up to -loadgen-max-bytes, reports their phase and evictions until -loadgen-duration
+// or an interrupt, and deletes them. It validates the exporter, alerts and eviction in a new cluster with usage
+// that grows at a known rate.
+func loadgen() int {
+	spec, err := loadgenFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg, err := restConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if loadgenDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, loadgenDuration)
+		defer cancel()
+	}
+
+	pods := cli.CoreV1().Pods(loadgenNamespace)
+	var created []string
+	defer func() {
+		// The context of the run is done.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, name := range created {
+			if err := pods.Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: new(int64)}); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to delete pod %s/%s: %v\n", loadgenNamespace, name, err)
+			}
+		}
+		fmt.Printf("deleted %d pod(s)\n", len(created))
+	}()
+	for i := 0; i < loadgenPods; i++ {
+		pod, err := pods.Create(ctx, loadgenPod(spec), metav1.CreateOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create pod in namespace %s: %v\n", loadgenNamespace, err)
+			return 1
+		}
+		created = append(created, pod.Name)
+	}
+	fmt.Printf("created %d pod(s) writing %s/s to their %s up to %s, until %s\n", len(created),
+		resource.NewQuantity(spec.rate, resource.BinarySI), spec.target, resource.NewQuantity(spec.maxBytes, resource.BinarySI), loadgenUntil())
+
+	// Only the changes of the pods are printed, e.g. when they are scheduled, evicted or exceed their limit.
+	states := map[string]string{}
+	ticker := time.NewTicker(loadgenPollInterval)
+	defer ticker.Stop()
+	for {
+		for _, name := range created {
+			pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+			if ctx.Err() != nil {
+				break
+			}
+			state := ""
+			if err != nil {
+				state = err.Error()
+			} else {
+				state = loadgenState(pod)
+			}
+			if state != states[name] {
+				fmt.Printf("%s  %s/%s: %s\n", time.Now().Format(time.RFC3339), loadgenNamespace, name, state)
+				states[name] = state
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadgenFlags validates the flags of loadgen.
+func loadgenFlags() (loadgenSpec, error) {
+	spec := loadgenSpec{target: loadgenTarget}
+	if loadgenPods <= 0 {
+		return spec, fmt.Errorf("-loadgen-pods must be positive, got %d", loadgenPods)
+	}
+	if loadgenTarget != "emptydir" && loadgenTarget != "rootfs" {
+		return spec, fmt.Errorf("-loadgen-target must be emptydir or rootfs, got %q", loadgenTarget)
+	}
+	rate, err := resource.ParseQuantity(loadgenRate)
+	if err != nil || rate.Sign() <= 0 {
+		return spec, fmt.Errorf("-loadgen-rate must be a positive quantity such as 1Mi, got %q", loadgenRate)
+	}
+	maxBytes, err := resource.ParseQuantity(loadgenMaxBytes)
+	if err != nil || maxBytes.Cmp(rate) < 0 {
+		return spec, fmt.Errorf("-loadgen-max-bytes must be a quantity such as 1Gi of at least -loadgen-rate, got %q", loadgenMaxBytes)
+	}
+	spec.rate, spec.maxBytes = rate.Value(), maxBytes.Value()
+	if loadgenLimit != "" {
+		limit, err := resource.ParseQuantity(loadgenLimit)
+		if err != nil || limit.Sign() <= 0 {
+			return spec, fmt.Errorf("-loadgen-limit must be a positive quantity such as 512Mi, got %q", loadgenLimit)
+		}
+		spec.limit = &limit
+	}
+	if loadgenDuration < 0 {
+		return spec, fmt.Errorf("-loadgen-duration must not be negative, got %v", loadgenDuration)
+	}
+	return spec, nil
+}
+
+func loadgenUntil() string {
+	if loadgenDuration == 0 {
+		return "interrupted"
+	}
+	return fmt.Sprintf("interrupted or %v", loadgenDuration)
+}
+
+// loadgenPod returns a pod writing spec.rate bytes every second to its emptyDir volume or writable layer, up to
+// spec.maxBytes, then sleeping.
+func loadgenPod(spec loadgenSpec) *corev1.Pod {
+	dir := "/tmp"
+	if spec.target == "emptydir" {
+		dir = "/scratch"
+	}
+	// dd appends a chunk per second to the same file, so that the usage grows steadily rather than in steps.
+	script := fmt.Sprintf("i=0; while [ $i -lt %d ]; do dd if=/dev/zero of=%s/fill bs=%d count=1 seek=$i conv=notrunc 2>/dev/null; i=$((i+1)); sleep 1; done; while true; do sleep 3600; done",
+		spec.maxBytes/spec.rate, dir, spec.rate)
+	container := corev1.Container{
+		Name:    "write",
+		Image:   loadgenImage,
+		Command: []string{"sh", "-c", script},
+	}
+	if spec.limit != nil {
+		container.Resources.Limits = corev1.ResourceList{corev1.ResourceEphemeralStorage: *spec.limit}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: loadgenName + "-",
+			Namespace:    loadgenNamespace,
+			Labels:       map[string]string{"app.kubernetes.io/name": loadgenName},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: new(int64),
+		},
+	}
+	if spec.target == "emptydir" {
+		container.VolumeMounts = []corev1.VolumeMount{{Name: "scratch", MountPath: dir}}
+		pod.Spec.Volumes = []corev1.Volume{{
+			Name:         "scratch",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}}
+	}
+	pod.Spec.Containers = []corev1.Container{container}
+	return pod
+}
+
+// loadgenState describes the phase of pod, with its node and the reason it failed, e.g. Evicted.
+func loadgenState(pod *corev1.Pod) string {
+	state := string(pod.Status.Phase)
+	if pod.Spec.NodeName != "" {
+		state += " on node " + pod.Spec.NodeName
+	}
+	if pod.Status.Reason != "" {
+		state += ", " + pod.Status.Reason
+	}
+	if pod.Status.Message != "" {
+		state += ": " + pod.Status.Message
+	}
+	return state
+}
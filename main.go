@@ -2,36 +2,70 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
-)
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
-var (
-	listenAddress        string
-	scrapeIntervalSecond int64
-	metricsPath          string
-	verbosityLogLevel    string
+	"k8s-ephemeral-storage-metrics/pkg/allocation"
+	"k8s-ephemeral-storage-metrics/pkg/cleanup"
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+	"k8s-ephemeral-storage-metrics/pkg/config"
+	"k8s-ephemeral-storage-metrics/pkg/diff"
+	"k8s-ephemeral-storage-metrics/pkg/eviction"
+	"k8s-ephemeral-storage-metrics/pkg/fakekubelet"
+	"k8s-ephemeral-storage-metrics/pkg/podfiles"
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+	"k8s-ephemeral-storage-metrics/pkg/remote"
+	"k8s-ephemeral-storage-metrics/pkg/sink"
+	"k8s-ephemeral-storage-metrics/pkg/snmp"
+	"k8s-ephemeral-storage-metrics/pkg/transport"
+	"k8s-ephemeral-storage-metrics/pkg/web"
 )
 
+// commands are run instead of the exporter when given as first argument.
+var commands = map[string]func() int{
+	"check-config":      checkConfig,
+	"e2e":               e2e,
+	"loadgen":           loadgen,
+	"promtool-fixtures": promtoolFixtures,
+	"selftest":          selftest,
+	"validate-kubelet":  validateKubelet,
+}
+
 func main() {
-	flag.Int64Var(&scrapeIntervalSecond, "scrape-interval", int64FromEnv("SCRAPE_INTERVAL_SECOND", 15), "Metrics scraping interval")
-	flag.StringVar(&listenAddress, "listen-address", ":9100", "Address on which to expose metrics and web interface.")
-	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "Path under which to expose metrics.")
-	flag.StringVar(&verbosityLogLevel, "log.verbosity", "0", "Verbosity log level")
+	registerFlags()
 
-	flag.Parse()
+	args := os.Args[1:]
+	var command func() int
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			command, args = cmd, args[1:]
+		}
+	}
+	_ = flag.CommandLine.Parse(args)
 
 	klog.InitFlags(flag.CommandLine)
 	err := flag.Set("v", verbosityLogLevel)
@@ -39,60 +73,573 @@ func main() {
 		klog.Errorf("error on setting v to %s: %v", verbosityLogLevel, err)
 	}
 	defer klog.Flush()
+	ctrl.SetLogger(klog.NewKlogr())
 
-	klog.Info("Starting ephemeral-storage-exporter")
-	// Use the clientcmd library to load the Kubernetes client configuration
-	cfg, err := config.GetConfig()
+	if command != nil {
+		klog.Flush()
+		os.Exit(command())
+	}
+
+	if errs := validateFlags(); len(errs) > 0 {
+		for _, err := range errs {
+			klog.Error(err)
+		}
+		klog.Fatal("Invalid flags, run check-config for details")
+	}
+	appConfig, err := loadConfig()
 	if err != nil {
+		klog.Fatalf("Failed to load config: %v", err)
+	}
+
+	klog.Info("Starting ephemeral-storage-exporter")
+	ctx := ctrl.SetupSignalHandler()
+	var cfg *rest.Config
+	// fakeKubelet replaces the cluster with -dev-mode and -replay-dir.
+	var fakeKubelet *fakekubelet.Server
+	if devMode {
+		fakeKubelet, cfg = startDevKubelet(ctx, time.Duration(scrapeIntervalSecond)*time.Second)
+	} else if replayDir != "" {
+		if fakeKubelet, cfg, err = startReplayKubelet(ctx, replayDir); err != nil {
+			klog.Fatalf("Failed to replay stat summaries: %v", err)
+		}
+	} else if cfg, err = restConfig(); err != nil {
 		panic(fmt.Errorf("failed to create Kubernetes client config: %v", err))
 	}
+	transport.WithTokenRetry(cfg)
 	// create the clientset
 	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	manager := NewManager(clientset, time.Duration(scrapeIntervalSecond)*time.Second)
-	// Start the manager.
-	if err := manager.Start(); err != nil {
-		klog.Fatalf("Failed to start manager: %v", err)
+	// With -cluster, every node of the given clusters is scraped instead of the current node. With -aggregator,
+	// nodes are scraped by agents.
+	scrapeNode := len(clusters) == 0 && aggregatorAddress == ""
+	var currentNode string
+	switch {
+	case fakeKubelet != nil:
+		currentNode = fakeKubelet.NodeName()
+		klog.Infof("Scraping node %s", currentNode)
+	case scrapeNode:
+		currentNode, err = resolveNodeName(context.Background(), clientset)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		klog.Infof("Scraping node %s", currentNode)
+		checkPermissions(clientset, currentNode)
 	}
-	defer func() {
-		if err := manager.Stop(); err != nil {
-			klog.Errorf("Failed to stop container manager: %v", err)
+
+	mgrOpts := manager.Options{
+		// Metrics are served by our own web server so that they share the listen address and path flags.
+		MetricsBindAddress:      "0",
+		HealthProbeBindAddress:  healthProbeAddress,
+		LeaderElection:          leaderElect,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
+	}
+	if pricePerGiBHour > 0 {
+		appConfig.Cost.PricePerGiBHour = pricePerGiBHour
+	}
+	if appConfig.Cost.NodeLabel != "" && len(clusters) > 0 {
+		klog.Fatal("cost.nodeLabel of the config file is not supported with -cluster")
+	}
+	selectors := cache.SelectorsByObject{}
+	if podInformerEnabled() {
+		// Only pods of the scraped node are cached.
+		selectors[&corev1.Pod{}] = cache.ObjectSelector{Field: fields.OneTermEqualSelector("spec.nodeName", currentNode)}
+	}
+	if scrapeNode && (appConfig.Cost.NodeLabel != "" || nodeDraining) {
+		selectors[&corev1.Node{}] = cache.ObjectSelector{Field: fields.OneTermEqualSelector("metadata.name", currentNode)}
+	}
+	if len(selectors) > 0 {
+		mgrOpts.NewCache = cache.BuilderWithOptions(cache.Options{SelectorsByObject: selectors})
+	}
+	if fakeKubelet != nil {
+		if informers := usedInformers(scrapeNode, appConfig); len(informers) > 0 {
+			klog.Fatal("The config file needs informers, which -dev-mode and -replay-dir do not support")
 		}
-	}()
+		mgrOpts.MapperProvider = devRESTMapper
+	}
+	mgr, err := ctrl.NewManager(cfg, mgrOpts)
+	if err != nil {
+		klog.Fatalf("Failed to create manager: %v", err)
+	}
 
-	prometheus.MustRegister(newEphemeralStorageCollector(manager))
-	http.Handle(metricsPath, promhttp.Handler())
+	providerOpts := provider.Options{
+		NodeName:           currentNode,
+		Interval:           time.Duration(scrapeIntervalSecond) * time.Second,
+		ExcludeCompleted:   excludeCompletedPods,
+		ExcludeTerminating: excludeTerminatingPods,
+		MaxGrowthWindow:    maxGrowthWindow,
+		TrackPeaks:         podPeakUsage,
+		KeepContainers:     enabledCollectors["container"] || enabledCollectors["source"],
+		KeepVolumes:        enabledCollectors["volume"] || enabledCollectors["source"],
 
-	srv := &http.Server{Addr: listenAddress}
-	stopCh := make(chan os.Signal, 1)
-	signal.Notify(stopCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		ExcludeGenericEphemeralVolumes: excludeGenericEphemeral,
+		DedupeEmptyDir:                 dedupeEmptyDir,
+		NamespaceShard:                 provider.NamespaceShard{Index: namespaceShard, Count: namespaceShards},
+		KubeletRestartGrace:            kubeletRestartGrace,
+		MaxStatsAge:                    maxStatsAge,
+		WatchdogIntervals:              watchdogIntervals,
+		KeepRawSummary:                 rawSummary,
+		ErrorBudget:                    scrapeErrorBudget,
+	}
+	if scrapeNode {
+		providerOpts.Kubelet, err = kubeletClient(clientset, cfg)
+		if err != nil {
+			klog.Fatalf("Failed to create kubelet client: %v", err)
+		}
+	}
+	if hotScrapeInterval > 0 {
+		// Validated by validateFlags.
+		providerOpts.HotInterval = hotScrapeInterval
+		providerOpts.HotUsedBytes, providerOpts.HotSelector, _ = hotPodFlags()
+		providerOpts.HotNodeAvailableBytes, providerOpts.HotNodeAvailablePercent, _ = hotNodeFlag()
+	}
+	var podReader client.Reader
+	if podInformerEnabled() {
+		podReader = mgr.GetCache()
+		providerOpts.Pods = provider.NewCachePodLookup(mgr.GetCache())
+	}
+	if recommendedLabels {
+		providerOpts.PodLabels = provider.RecommendedLabels
+	}
+	if chaos {
+		providerOpts.Chaos = provider.NewChaos()
+	}
+	if recordDir != "" {
+		providerOpts.Recorder = provider.NewRecorder(recordDir, recordMaxFiles)
+	}
+	if mountsFile != "" {
+		if _, err := provider.ReadMounts(mountsFile); err != nil {
+			klog.Fatalf("Failed to read mount table: %v", err)
+		}
+		providerOpts.MountsFile = mountsFile
+	}
+	providerOpts.Decorators = provider.Decorators()
+	collectorOpts := collector.Options{
+		Collectors:         enabledCollectors,
+		Pods:               podReader,
+		PodPhaseLabel:      podPhaseLabel,
+		RecommendedLabels:  recommendedLabels,
+		MaxGrowth:          maxGrowthWindow > 0,
+		PeakUsage:          podPeakUsage,
+		FailOnError:        failScrapeOnError,
+		TopNPerNode:        topNPerNode,
+		StaleAfterFailures: staleAfterFailures,
+		SkipZeroCapacity:   skipZeroCapacity,
+		MountLabels:        mountsFile != "",
+		LeanPodLabels:      leanPodLabels,
+		Decorators:         provider.Decorators(),
+		Derived:            appConfig.Derived,
+	}
+	collectorOpts.MinUsedBytes, _ = minUsedBytesFlag()
 
-	// Block until a signal is received.
-	go func() {
-		sig := <-stopCh
-		klog.Infof("Exiting given signal: %v", sig)
-		if err := srv.Shutdown(context.Background()); err != nil {
-			klog.ErrorS(err, "failed to shutdown server")
+	// The Go and process collectors are registered by controller-runtime.
+	crmetrics.Registry.MustRegister(
+		transport.AuthFailures,
+		transport.AuthRetries,
+		preflight.PermissionsOK,
+		provider.SeriesDropped,
+		provider.ScrapeLoopRestarts,
+		provider.ZeroCapacityReports,
+		provider.EmptyDirCorrections,
+		web.APIRequestsRejected,
+	)
+	srv := web.NewServer(listenAddress)
+	if tlsCertFile != "" {
+		tlsConfig := &tls.Config{}
+		tlsPolicy().Apply(tlsConfig)
+		if ephemeralMetricsAPI {
+			// Only the ephemeral metrics API requires the client certificate the api server proxies with.
+			clientCAs, err := loadEphemeralMetricsCA()
+			if err != nil {
+				klog.Fatalf("Failed to read ephemeral metrics api client CA: %v", err)
+			}
+			if clientCAs != nil {
+				tlsConfig.ClientCAs, tlsConfig.ClientAuth = clientCAs, tls.VerifyClientCertIfGiven
+			}
+		}
+		srv.EnableTLS(tlsCertFile, tlsKeyFile, tlsConfig)
+	}
+	apiTokens, err := loadAPITokens()
+	if err != nil {
+		klog.Fatalf("Failed to read api tokens: %v", err)
+	}
+	// api guards the JSON endpoints, the admin ones have their own token.
+	api := web.NewAPIGuard(apiTokens, apiRateLimit)
+	// The aggregator fetches no stat summaries, the errors of nodes are in the logs of their agents.
+	if debugErrors > 0 && aggregatorAddress == "" {
+		providerOpts.Errors = provider.NewErrorLog(debugErrors)
+		srv.Handle("/debug/errors", api.Wrap(web.NewErrorsHandler(providerOpts.Errors)))
+	}
+	var targets []web.Cluster
+	// filterTargets are the providers of the pod series of metricsPath, sliced with its query parameters.
+	var filterTargets []web.FilterTarget
+	for _, c := range clusters {
+		clusterManager, err := addCluster(mgr, c, providerOpts, collectorOpts, appConfig.Cost)
+		if err != nil {
+			klog.Fatalf("Failed to add cluster %s: %v", c.name, err)
+		}
+		targets = append(targets, web.Cluster{Name: c.name, Manager: clusterManager})
+		filterTargets = append(filterTargets, web.FilterTarget{Labels: prometheus.Labels{"cluster": c.name}, Provider: clusterManager})
+	}
+	if len(targets) > 0 {
+		srv.Handle("/api/v1/targets", api.Wrap(web.NewTargetsHandler(targets)))
+		srv.Handle("/api/v1/sd", api.Wrap(web.NewSDHandler(targets)))
+		srv.Handle("/probe", web.NewProbeHandler(targets, func(p provider.Provider) prometheus.Collector {
+			return collector.NewEphemeralStorageCollector(p, collectorOpts)
+		}, metricsHandlerOpts()))
+	}
+	if aggregatorAddress != "" {
+		security, err := grpcSecurity()
+		if err != nil {
+			klog.Fatalf("Failed to read gRPC credentials: %v", err)
+		}
+		grpcOpts, err := security.ServerOptions()
+		if err != nil {
+			klog.Fatalf("Failed to configure gRPC credentials: %v", err)
+		}
+		aggregator := remote.NewAggregator(aggregatorAddress, aggregatorNodeTTL, grpcOpts...)
+		if err := mgr.Add(aggregator); err != nil {
+			klog.Fatalf("Failed to add aggregator: %v", err)
+		}
+		crmetrics.Registry.MustRegister(collector.NewEphemeralStorageCollector(aggregator, collectorOpts))
+		filterTargets = append(filterTargets, web.FilterTarget{Provider: aggregator})
+		if appConfig.Cost.Enabled() {
+			crmetrics.Registry.MustRegister(collector.NewCostEstimator(aggregator, collectorOpts, appConfig.Cost.PriceFunc(mgr.GetCache())))
+		}
+	}
+	if scrapeNode {
+		statsManager := provider.NewManager(clientset, providerOpts)
+		if err := mgr.Add(statsManager); err != nil {
+			klog.Fatalf("Failed to add stats manager: %v", err)
+		}
+		crmetrics.Registry.MustRegister(collector.NewEphemeralStorageCollector(statsManager, collectorOpts))
+		filterTargets = append(filterTargets, web.FilterTarget{Provider: statsManager})
+		if !leaderElect {
+			// Replicas waiting for the lease never fetch stats, so readiness only tracks stats without leader election.
+			if err := mgr.AddReadyzCheck("stats", func(*http.Request) error {
+				if !statsManager.Ready() {
+					return errors.New("no stat summary fetched yet")
+				}
+				return nil
+			}); err != nil {
+				klog.Fatalf("Failed to add ready check: %v", err)
+			}
+		}
+		if appConfig.Cost.Enabled() {
+			crmetrics.Registry.MustRegister(collector.NewCostEstimator(statsManager, collectorOpts, appConfig.Cost.PriceFunc(mgr.GetCache())))
+		}
+		if workloadSummaries {
+			summaries := collector.NewWorkloadSummaries(workloadSummaryMaxAge)
+			statsManager.AddObserver(summaries)
+			crmetrics.Registry.MustRegister(summaries)
+		}
+		if len(usageAverages) > 0 {
+			averages := collector.NewPodAverages(usageAverages)
+			statsManager.AddTickObserver(averages)
+			crmetrics.Registry.MustRegister(averages)
+		}
+		if leakMinDuration > 0 {
+			leaks := collector.NewPodLeaks(leakMinDuration)
+			statsManager.AddTickObserver(leaks)
+			crmetrics.Registry.MustRegister(leaks)
+		}
+		if enabledCollectors["limits"] {
+			overshoots := collector.NewLimitOvershoots(providerOpts.Pods)
+			statsManager.AddObserver(overshoots)
+			crmetrics.Registry.MustRegister(overshoots)
+		}
+		if usageResetDrop > 0 {
+			resets := collector.NewUsageResets(providerOpts.Pods, usageResetDrop)
+			statsManager.AddObserver(resets)
+			crmetrics.Registry.MustRegister(resets)
+		}
+		if nodeSaturationHorizon > 0 {
+			saturation := eviction.NewSaturation(statsManager, clientset, nodeSaturationHorizon)
+			statsManager.AddTickObserver(saturation)
+			crmetrics.Registry.MustRegister(saturation)
+		}
+		if evictionSimulation {
+			srv.Handle("/api/v1/simulate-eviction", api.Wrap(eviction.NewHandler(statsManager, providerOpts.Pods, clientset)))
 		}
-	}()
+		if rawSummary {
+			srv.Handle("/api/v1/raw-summary", api.Wrap(web.NewRawSummaryHandler(statsManager)))
+		}
+		if diffRetention > 0 {
+			history := diff.NewHistory(diffRetention)
+			statsManager.AddObserver(history)
+			srv.Handle("/debug/diff", api.Wrap(diff.NewHandler(history)))
+		}
+		if adminTokenFile != "" {
+			token, err := loadAdminToken()
+			if err != nil {
+				klog.Fatalf("Failed to read admin token: %v", err)
+			}
+			dump, err := dumpConfig(appConfig)
+			if err != nil {
+				klog.Fatalf("Failed to render the effective config: %v", err)
+			}
+			srv.Handle("/-/", web.WithBearerToken(token, web.NewAdminHandler(statsManager, statsManager, dump)))
+			if chaos {
+				chaosHandler := web.WithBearerToken(token, web.NewChaosHandler(providerOpts.Chaos, chaosMaxDuration))
+				srv.Handle("/-/chaos", chaosHandler)
+				srv.Handle("/-/chaos/", chaosHandler)
+				crmetrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+					Namespace: "ephemeral_storage",
+					Name:      "chaos_active",
+					Help:      "1 while a fault injected with /-/chaos is active, so that alerts it fires can be told apart, 0 otherwise",
+				}, func() float64 {
+					if providerOpts.Chaos.Active(time.Now()) {
+						return 1
+					}
+					return 0
+				}))
+			}
+			if hostRoot != "" {
+				srv.Handle("/api/v1/pods/", web.WithBearerToken(token, podfiles.NewHandler(hostRoot)))
+			}
+			crmetrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "ephemeral_storage",
+				Name:      "scrape_paused",
+				Help:      "1 if stat summary requests are paused with /-/pause, 0 otherwise",
+			}, func() float64 {
+				if statsManager.Paused() {
+					return 1
+				}
+				return 0
+			}))
+		}
+		if cleanupScratch {
+			recorder := appConfig.MaintenanceWindows.Recorder(mgr.GetEventRecorderFor("k8s-ephemeral-storage-metrics"))
+			cleaner := cleanup.NewCleaner(hostRoot, providerOpts.Pods, recorder)
+			if err := mgr.Add(cleaner); err != nil {
+				klog.Fatalf("Failed to add cleaner: %v", err)
+			}
+			statsManager.AddObserver(cleaner)
+			crmetrics.Registry.MustRegister(cleanup.DeletedFiles, cleanup.DeletedBytes, cleanup.Runs)
+		}
+		if podAllocation {
+			checkpoint := allocation.NewCheckpoint(filepath.Join(hostRoot, "var/lib/kubelet"))
+			crmetrics.Registry.MustRegister(collector.NewAllocationCollector(statsManager, collectorOpts, checkpoint))
+		}
+		if nodeDraining {
+			crmetrics.Registry.MustRegister(collector.NewNodeDraining(mgr.GetCache(), currentNode))
+		}
+		if agentTarget != "" {
+			security, err := grpcSecurity()
+			if err != nil {
+				klog.Fatalf("Failed to read gRPC credentials: %v", err)
+			}
+			dialOpts, err := security.DialOptions()
+			if err != nil {
+				klog.Fatalf("Failed to configure gRPC credentials: %v", err)
+			}
+			if u := proxyURL(); u != nil {
+				dialOpts = append(dialOpts, grpc.WithContextDialer(transport.ProxyDialer(u)))
+			}
+			if err := mgr.Add(remote.NewAgent(agentTarget, statsManager, providerOpts.Interval, dialOpts...)); err != nil {
+				klog.Fatalf("Failed to add agent: %v", err)
+			}
+		}
+	}
+	if len(appConfig.NamespaceLabels) > 0 {
+		if len(clusters) > 0 {
+			klog.Fatal("namespaceLabels of the config file are not supported with -cluster")
+		}
+		crmetrics.Registry.MustRegister(collector.NewNamespaceInfo(mgr.GetCache(), appConfig.NamespaceLabels))
+	}
+	if len(appConfig.MaintenanceWindows) > 0 {
+		crmetrics.Registry.MustRegister(appConfig.MaintenanceWindows.ActiveGauge())
+	}
+	if informers := usedInformers(scrapeNode, appConfig); len(informers) > 0 {
+		health := collector.NewInformerHealth()
+		for resource, obj := range informers {
+			if err := health.Watch(context.Background(), mgr.GetCache(), resource, obj); err != nil {
+				klog.Fatalf("Failed to watch informer of %s: %v", resource, err)
+			}
+		}
+		crmetrics.Registry.MustRegister(health)
+	}
+	gatherer := appConfig.Metrics.Gatherer(crmetrics.Registry)
+	if tenantMetrics {
+		// Tenants get the full series, the sparse exposition state is shared by the scrapers of metricsPath.
+		prefix := strings.TrimSuffix(metricsPath, "/") + "/namespaces/"
+		srv.Handle(prefix, web.NewTenantHandler(prefix, gatherer, clientset, metricsHandlerOpts(), tenantReviewRateLimit))
+	}
+	if influx {
+		// Telegraf scrapes the full series as well, it keeps no state between scrapes to fill in the skipped ones.
+		srv.Handle("/influx", api.Wrap(web.NewInfluxHandler(gatherer)))
+	}
+	providers := make([]provider.Provider, 0, len(filterTargets))
+	for _, target := range filterTargets {
+		providers = append(providers, target.Provider)
+	}
+	if ephemeralMetricsAPI {
+		handler := web.NewEphemeralMetricsHandler(providers...)
+		ephemeralMetrics := http.Handler(handler)
+		if ephemeralMetricsCAFile != "" {
+			handler.RequireClientCert()
+		} else {
+			// Not proxied by the api server, which authenticates and authorizes the requests otherwise.
+			ephemeralMetrics = api.Wrap(handler)
+		}
+		srv.Handle("/apis/"+web.EphemeralMetricsGroup, ephemeralMetrics)
+		srv.Handle("/apis/"+web.EphemeralMetricsGroup+"/", ephemeralMetrics)
+	}
+	sinks := sink.Registered()
+	if graphiteAddress != "" {
+		graphiteSink, err := sink.NewGraphite(graphiteAddress, graphitePrefix, graphiteInterval, gatherer)
+		if err != nil {
+			klog.Fatalf("Failed to create graphite sink: %v", err)
+		}
+		sinks = append(sinks, sink.RegisteredSink{Sink: graphiteSink, Interval: graphiteInterval})
+	}
+	if zabbixServer != "" {
+		sinks = append(sinks, sink.RegisteredSink{Sink: sink.NewZabbix(zabbixServer), Interval: zabbixInterval})
+	}
+	if len(sinkExec) > 0 {
+		sinks = append(sinks, sink.RegisteredSink{Sink: sink.NewExec(sinkExec), Interval: sinkExecInterval})
+	}
+	for _, s := range sinks {
+		if err := mgr.Add(sink.NewRunner(s.Sink, s.Interval, providers...)); err != nil {
+			klog.Fatalf("Failed to add sink %s: %v", s.Sink.Name(), err)
+		}
+	}
+	if len(sinks) > 0 {
+		crmetrics.Registry.MustRegister(sink.PushFailures)
+	}
+	if snmpAddress != "" {
+		community, err := loadSNMPCommunity()
+		if err != nil {
+			klog.Fatalf("Failed to read snmp community: %v", err)
+		}
+		if err := mgr.Add(snmp.NewAgent(snmpAddress, community, providers...)); err != nil {
+			klog.Fatalf("Failed to add snmp agent: %v", err)
+		}
+		crmetrics.Registry.MustRegister(snmp.Requests)
+	}
+	if metricsSparseHeartbeat > 0 {
+		gatherer = collector.NewSparseGatherer(gatherer, metricsSparseDelta, metricsSparseHeartbeat)
+	}
+	srv.Handle(metricsPath, web.NewFilterHandler(promhttp.HandlerFor(gatherer, metricsHandlerOpts()), filterTargets,
+		func(p provider.Provider, collectors []string) (prometheus.Collector, error) {
+			opts := collectorOpts
+			if len(collectors) > 0 {
+				selection, err := enabledCollectors.Only(collectors)
+				if err != nil {
+					return nil, err
+				}
+				opts.Collectors, opts.Derived = selection, nil
+			}
+			return collector.NewEphemeralStorageCollector(p, opts), nil
+		}, appConfig.Metrics.Gatherer, metricsHandlerOpts()))
+	if err := mgr.Add(srv); err != nil {
+		klog.Fatalf("Failed to add web server: %v", err)
+	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatalf("Failed to add health check: %v", err)
+	}
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		klog.Fatalf("Failed to add ready check: %v", err)
+	}
+
+	if err := mgr.Start(ctx); err != nil {
+		klog.ErrorS(err, "manager exited with error")
+	}
+}
+
+// addCluster scrapes every node of the cluster of the kubeconfig context of c, and exports the series with a
+// cluster label. It returns the manager of the cluster to list its nodes as targets.
+func addCluster(mgr manager.Manager, c cluster, providerOpts provider.Options, collectorOpts collector.Options, cost config.Cost) (*provider.ClusterManager, error) {
+	cfg, err := contextConfig(c.context)
+	if err != nil {
+		return nil, err
+	}
+	transport.WithTokenRetry(cfg)
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clusterManager := provider.NewClusterManager(cli, providerOpts)
+	if err := mgr.Add(clusterManager); err != nil {
+		return nil, err
+	}
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"cluster": c.name}, crmetrics.Registry)
+	if cost.Enabled() {
+		if err := registerer.Register(collector.NewCostEstimator(clusterManager, collectorOpts, cost.PriceFunc(nil))); err != nil {
+			return nil, err
+		}
+	}
+	if err := registerer.Register(collector.NewTopologyAggregates(clusterManager, collectorOpts.SkipZeroCapacity)); err != nil {
+		return nil, err
+	}
+	return clusterManager, registerer.Register(collector.NewEphemeralStorageCollector(clusterManager, collectorOpts))
+}
+
+// usedInformers returns the objects, by resource, that are read through the informer cache of the manager.
+func usedInformers(scrapeNode bool, appConfig *config.Config) map[string]client.Object {
+	informers := map[string]client.Object{}
+	if podInformerEnabled() {
+		informers["pods"] = &corev1.Pod{}
+	}
+	nodeLabel := appConfig.Cost.Enabled() && appConfig.Cost.NodeLabel != "" && (scrapeNode || aggregatorAddress != "")
+	if nodeLabel || (scrapeNode && nodeDraining) {
+		informers["nodes"] = &corev1.Node{}
+	}
+	if len(appConfig.NamespaceLabels) > 0 {
+		informers["namespaces"] = &corev1.Namespace{}
+	}
+	return informers
+}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		klog.ErrorS(err, "error starting HTTP server")
+// checkPermissions reviews the RBAC access required for the node and exits on denied permissions if
+// -require-permissions is set, so that a missing ClusterRole does not show up as failed requests every interval.
+func checkPermissions(cli kubernetes.Interface, node string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	denied := false
+	for _, result := range preflight.CheckAccess(ctx, cli, preflight.RequiredPermissions(node, podInformerEnabled(), kubeletAddressTypes != "")) {
+		switch {
+		case result.OK():
+			klog.V(1).Infof("Checked %s", result.Name)
+		case errors.Is(result.Err, preflight.ErrDenied):
+			denied = true
+			klog.Errorf("Missing %s: %v, %s", result.Name, result.Err, result.Hint)
+		default:
+			klog.Warningf("Could not check %s: %v", result.Name, result.Err)
+		}
+	}
+	if denied && requirePermissions {
+		klog.Fatal("Required permissions are denied, run check-config for details or set -require-permissions=false")
 	}
 }
 
-func int64FromEnv(env string, defaultValue int64) int64 {
-	str, ok := os.LookupEnv(env)
-	if !ok {
-		return defaultValue
+// restConfig loads the Kubernetes client configuration from -kubeconfig (registered by controller-runtime),
+// KUBECONFIG, the in-cluster config or $HOME/.kube/config, in that order, and applies -context and -apiserver.
+func restConfig() (*rest.Config, error) {
+	cfg, err := contextConfig(kubeContext)
+	if err != nil {
+		return nil, err
 	}
+	if apiServer != "" {
+		cfg.Host = apiServer
+	}
+	return cfg, nil
+}
 
-	num, err := strconv.ParseInt(str, 10, 64)
+// contextConfig loads the Kubernetes client configuration of the kubeconfig context, or of the current context if
+// empty, and applies -proxy-url and the TLS policy.
+func contextConfig(context string) (*rest.Config, error) {
+	cfg, err := crconfig.GetConfigWithContext(context)
 	if err != nil {
-		return defaultValue
+		return nil, err
+	}
+	transport.WithTLSPolicy(cfg, tlsPolicy())
+	if u := proxyURL(); u != nil {
+		transport.WithProxy(cfg, u)
 	}
-	return num
+	return cfg, nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// errNoNodeName is returned when none of the sources yields the name of the node to scrape.
+var errNoNodeName = errors.New("node name is not found in -node-name, CURRENT_NODE_NAME, -node-name-file or the host name, " +
+	"set -node-name or CURRENT_NODE_NAME from spec.nodeName with the downward API")
+
+// resolveNodeName returns the name of the node to scrape from, in order, -node-name, CURRENT_NODE_NAME,
+// -node-name-file and the host name if a node object matches it. The host name only matches with hostNetwork.
+func resolveNodeName(ctx context.Context, cli kubernetes.Interface) (string, error) {
+	if nodeName != "" {
+		return nodeName, nil
+	}
+	if name := os.Getenv("CURRENT_NODE_NAME"); name != "" {
+		return name, nil
+	}
+	if nodeNameFile != "" {
+		content, err := os.ReadFile(nodeNameFile)
+		switch {
+		case err == nil && strings.TrimSpace(string(content)) != "":
+			klog.V(1).Infof("Node name is read from %s", nodeNameFile)
+			return strings.TrimSpace(string(content)), nil
+		case err != nil && !os.IsNotExist(err):
+			klog.Warningf("Failed to read node name from %s: %v", nodeNameFile, err)
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to get host name: %v", errNoNodeName, err)
+	}
+	name, err := nodeForHostname(ctx, cli, hostname)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errNoNodeName, err)
+	}
+	klog.V(1).Infof("Node name %s is matched by host name %s", name, hostname)
+	return name, nil
+}
+
+// nodeForHostname returns the node named hostname or labeled with it as kubernetes.io/hostname.
+func nodeForHostname(ctx context.Context, cli kubernetes.Interface, hostname string) (string, error) {
+	node, err := cli.CoreV1().Nodes().Get(ctx, hostname, metav1.GetOptions{})
+	if err == nil {
+		return node.Name, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get node %s: %v", hostname, err)
+	}
+	nodes, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"kubernetes.io/hostname": hostname}).String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes of host name %s: %v", hostname, err)
+	}
+	if len(nodes.Items) != 1 {
+		return "", fmt.Errorf("%d nodes match host name %s", len(nodes.Items), hostname)
+	}
+	return nodes.Items[0].Name, nil
+}
@@ -0,0 +1,133 @@
+package allocation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkpointFiles are the names of the checkpoint in the kubelet root directory, newest kubelets first. Older
+// kubelets keep it in the checkpoint of the status manager. Both only exist with in-place pod resizing enabled.
+var checkpointFiles = []string{"allocated_pods_state", "pod_status_manager_state"}
+
+// Allocation is the ephemeral storage allocated to a pod, summed over the containers of the checkpoint.
+type Allocation struct {
+	RequestBytes int64
+	// HasRequest is set if a container has a request.
+	HasRequest bool
+	LimitBytes int64
+	// HasLimit is set if every container has a limit. Older kubelets only checkpoint requests.
+	HasLimit bool
+}
+
+// checkpoint is the JSON encoding of the checkpoint. Entries are ResourceRequirements on newer kubelets and
+// ResourceLists of the requests on older ones, by pod UID and container name.
+type checkpoint struct {
+	AllocationEntries map[string]map[string]json.RawMessage `json:"allocationEntries"`
+}
+
+// Checkpoint reads the pod resource allocation checkpoint of a kubelet, the resources the kubelet admitted pods with.
+// They diverge from the pod spec after in-place resizes. The file is only decoded again when it changed.
+type Checkpoint struct {
+	dir string
+
+	lock        sync.Mutex
+	path        string
+	modTime     time.Time
+	size        int64
+	allocations map[string]Allocation
+}
+
+// NewCheckpoint returns a reader of the checkpoint of the kubelet root directory dir, e.g.
+// <host-root>/var/lib/kubelet.
+func NewCheckpoint(dir string) *Checkpoint {
+	return &Checkpoint{dir: dir}
+}
+
+// Allocations returns the allocations by pod UID, or nil if the kubelet keeps no checkpoint. The checksum of the
+// file is not verified, the kubelet may be writing it.
+func (c *Checkpoint) Allocations() (map[string]Allocation, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, name := range checkpointFiles {
+		path := filepath.Join(c.dir, name)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path == c.path && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+			return c.allocations, nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		allocations, err := decode(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		c.path, c.modTime, c.size, c.allocations = path, info.ModTime(), info.Size(), allocations
+		return allocations, nil
+	}
+	c.path, c.allocations = "", nil
+	return nil, nil
+}
+
+func decode(content []byte) (map[string]Allocation, error) {
+	cp := checkpoint{}
+	if err := json.Unmarshal(content, &cp); err != nil {
+		return nil, err
+	}
+	allocations := make(map[string]Allocation, len(cp.AllocationEntries))
+	for uid, containers := range cp.AllocationEntries {
+		allocation := Allocation{HasLimit: len(containers) > 0}
+		for _, raw := range containers {
+			resources, err := decodeResources(raw)
+			if err != nil {
+				return nil, fmt.Errorf("pod %s: %v", uid, err)
+			}
+			if request, ok := resources.Requests[corev1.ResourceEphemeralStorage]; ok {
+				allocation.RequestBytes += request.Value()
+				allocation.HasRequest = true
+			}
+			if limit, ok := resources.Limits[corev1.ResourceEphemeralStorage]; ok {
+				allocation.LimitBytes += limit.Value()
+			} else {
+				allocation.HasLimit = false
+			}
+		}
+		if !allocation.HasLimit {
+			allocation.LimitBytes = 0
+		}
+		allocations[uid] = allocation
+	}
+	return allocations, nil
+}
+
+// decodeResources decodes the entry of a container, ResourceRequirements or the ResourceList of its requests.
+func decodeResources(raw json.RawMessage) (corev1.ResourceRequirements, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return corev1.ResourceRequirements{}, err
+	}
+	_, hasRequests := fields["requests"]
+	_, hasLimits := fields["limits"]
+	if hasRequests || hasLimits {
+		resources := corev1.ResourceRequirements{}
+		err := json.Unmarshal(raw, &resources)
+		return resources, err
+	}
+	requests := corev1.ResourceList{}
+	err := json.Unmarshal(raw, &requests)
+	return corev1.ResourceRequirements{Requests: requests}, err
+}
@@ -0,0 +1,292 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Annotations of the pods whose scratch directory is cleaned up. Every annotation is required.
+const (
+	// AnnotationVolume is the name of the emptyDir volume to clean up.
+	AnnotationVolume = "k8s-ephemeral-storage-metrics/cleanup-volume"
+	// AnnotationMaxAge is the age, e.g. 7d, from which files are deleted.
+	AnnotationMaxAge = "k8s-ephemeral-storage-metrics/cleanup-max-age"
+	// AnnotationThreshold is the used bytes of the pod, e.g. 10Gi, from which files are deleted.
+	AnnotationThreshold = "k8s-ephemeral-storage-metrics/cleanup-threshold"
+)
+
+// cooldown is the minimum duration between two cleanups of a pod, so that a pod staying above its threshold with
+// only recent files is not walked on every stat summary.
+const cooldown = 5 * time.Minute
+
+var (
+	DeletedFiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "cleanup_deleted_files_total",
+		Help:      "Files deleted by the cleanup of pod scratch directories",
+	}, []string{"namespace_name"})
+	DeletedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "cleanup_deleted_bytes_total",
+		Help:      "Bytes of the files deleted by the cleanup of pod scratch directories",
+	}, []string{"namespace_name"})
+	Runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "cleanup_runs_total",
+		Help:      "Cleanups of pod scratch directories, by result: success or error",
+	}, []string{"namespace_name", "result"})
+)
+
+// Policy is the cleanup policy of a pod, read from its annotations.
+type Policy struct {
+	Volume         string
+	MaxAge         time.Duration
+	ThresholdBytes uint64
+}
+
+// PolicyOf returns the policy of pod, nil if it has no cleanup annotation. The volume must be an emptyDir on disk.
+func PolicyOf(pod *corev1.Pod) (*Policy, error) {
+	volume, hasVolume := pod.Annotations[AnnotationVolume]
+	maxAge, hasMaxAge := pod.Annotations[AnnotationMaxAge]
+	threshold, hasThreshold := pod.Annotations[AnnotationThreshold]
+	if !hasVolume && !hasMaxAge && !hasThreshold {
+		return nil, nil
+	}
+	if !hasVolume || !hasMaxAge || !hasThreshold {
+		return nil, fmt.Errorf("%s, %s and %s are all required", AnnotationVolume, AnnotationMaxAge, AnnotationThreshold)
+	}
+	if errs := validation.IsDNS1123Label(volume); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid %s %q: %v", AnnotationVolume, volume, errs)
+	}
+	emptyDir := false
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == volume && v.EmptyDir != nil && v.EmptyDir.Medium != corev1.StorageMediumMemory {
+			emptyDir = true
+		}
+	}
+	if !emptyDir {
+		return nil, fmt.Errorf("%s %q is not an emptyDir volume on disk", AnnotationVolume, volume)
+	}
+	age, err := model.ParseDuration(maxAge)
+	if err != nil || age <= 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a duration such as 7d", AnnotationMaxAge, maxAge)
+	}
+	q, err := resource.ParseQuantity(threshold)
+	if err != nil || q.Sign() < 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a quantity such as 10Gi", AnnotationThreshold, threshold)
+	}
+	return &Policy{Volume: volume, MaxAge: time.Duration(age), ThresholdBytes: uint64(q.Value())}, nil
+}
+
+// Cleaner deletes old files of the scratch directories of the pods of the node above their cleanup threshold.
+// Cleanups run one at a time in the background, so that they never delay stat summaries.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Cleaner struct {
+	hostRoot string
+	pods     provider.PodLookup
+	recorder record.EventRecorder
+	jobs     chan job
+
+	lock sync.Mutex
+	last map[types.UID]time.Time
+}
+
+type job struct {
+	pod    *corev1.Pod
+	policy *Policy
+}
+
+var _ provider.Observer = &Cleaner{}
+
+// NewCleaner returns a cleaner of the host filesystem mounted read-write at hostRoot. Events are recorded on the pods.
+func NewCleaner(hostRoot string, pods provider.PodLookup, recorder record.EventRecorder) *Cleaner {
+	return &Cleaner{
+		hostRoot: hostRoot,
+		pods:     pods,
+		recorder: recorder,
+		jobs:     make(chan job, 16),
+		last:     map[types.UID]time.Time{},
+	}
+}
+
+// Observe implements provider.Observer.
+func (c *Cleaner) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := range stats {
+		stat := &stats[i]
+		pod, ok := c.pods.Pod(context.Background(), stat.Namespace, stat.PodName)
+		if !ok || string(pod.UID) != stat.UID {
+			continue
+		}
+		policy, err := PolicyOf(pod)
+		if err != nil {
+			klog.V(1).InfoS("Ignoring invalid cleanup policy", "pod", klog.KObj(pod), "err", err)
+			continue
+		}
+		if policy == nil || stat.UsedBytes < policy.ThresholdBytes || now.Sub(c.last[pod.UID]) < cooldown {
+			continue
+		}
+		select {
+		case c.jobs <- job{pod: pod, policy: policy}:
+			c.last[pod.UID] = now
+		default:
+			klog.V(1).InfoS("Skipping cleanup, too many cleanups pending", "pod", klog.KObj(pod))
+		}
+	}
+	// Expired cooldowns are forgotten, so that pods that are gone do not leak.
+	for uid := range c.last {
+		if now.Sub(c.last[uid]) >= cooldown {
+			delete(c.last, uid)
+		}
+	}
+}
+
+// Start runs the cleanups until ctx is done.
+func (c *Cleaner) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case j := <-c.jobs:
+			c.clean(ctx, j.pod, j.policy)
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica cleans up the pods of its node.
+func (c *Cleaner) NeedLeaderElection() bool {
+	return false
+}
+
+func (c *Cleaner) clean(ctx context.Context, pod *corev1.Pod, policy *Policy) {
+	dir := filepath.Join("var/lib/kubelet/pods", string(pod.UID), "volumes/kubernetes.io~empty-dir", policy.Volume)
+	files, bytes, err := deleteOlder(ctx, c.hostRoot, dir, time.Now().Add(-policy.MaxAge))
+	DeletedFiles.WithLabelValues(pod.Namespace).Add(float64(files))
+	DeletedBytes.WithLabelValues(pod.Namespace).Add(float64(bytes))
+	size := resource.NewQuantity(bytes, resource.BinarySI)
+	if err != nil {
+		Runs.WithLabelValues(pod.Namespace, "error").Inc()
+		klog.ErrorS(err, "Failed to clean up scratch directory", "pod", klog.KObj(pod), "volume", policy.Volume)
+		c.recorder.Eventf(pod, corev1.EventTypeWarning, "EphemeralStorageCleanupFailed",
+			"Deleted %d files (%s) older than %s of emptyDir %s before failing: %v", files, size, model.Duration(policy.MaxAge), policy.Volume, err)
+		return
+	}
+	Runs.WithLabelValues(pod.Namespace, "success").Inc()
+	klog.InfoS("Cleaned up scratch directory", "pod", klog.KObj(pod), "volume", policy.Volume, "files", files, "bytes", bytes)
+	c.recorder.Eventf(pod, corev1.EventTypeNormal, "EphemeralStorageCleanup",
+		"Deleted %d files (%s) older than %s of emptyDir %s above %s of ephemeral storage", files, size, model.Duration(policy.MaxAge),
+		policy.Volume, resource.NewQuantity(int64(policy.ThresholdBytes), resource.BinarySI))
+}
+
+// deleteOlder deletes the regular files of dir, relative to root, last modified before t, and returns their number
+// and bytes. Directories are kept since the application may rely on them.
+//
+// The pod can replace any path of its volume with a symbolic link while it is walked, so every file is opened and
+// deleted relative to the opened directory containing it, and symbolic links, in dir as well, are never followed.
+func deleteOlder(ctx context.Context, root, dir string, t time.Time) (int, int64, error) {
+	d, err := openDir(root, dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer d.Close()
+	files := 0
+	var bytes int64
+	err = deleteOlderIn(ctx, d, t, &files, &bytes)
+	return files, bytes, err
+}
+
+// openDir opens dir, relative to root, without following symbolic links below root.
+func openDir(root, dir string) (*os.File, error) {
+	d, err := os.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	path := root
+	for _, name := range strings.Split(filepath.Clean(dir), string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+		child, err := openAt(d, name, path, unix.O_DIRECTORY)
+		d.Close()
+		if err != nil {
+			return nil, err
+		}
+		d = child
+	}
+	return d, nil
+}
+
+// openAt opens name in the directory d without following it if it is a symbolic link. path is the name of the file.
+func openAt(d *os.File, name, path string, flags int) (*os.File, error) {
+	fd, err := unix.Openat(int(d.Fd()), name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC|flags, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+func deleteOlderIn(ctx context.Context, d *os.File, t time.Time, files *int, bytes *int64) error {
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(d.Name(), entry.Name())
+		switch {
+		case entry.IsDir():
+			child, err := openAt(d, entry.Name(), path, unix.O_DIRECTORY)
+			if err != nil {
+				continue
+			}
+			err = deleteOlderIn(ctx, child, t, files, bytes)
+			child.Close()
+			if err != nil {
+				return err
+			}
+		case entry.Type().IsRegular():
+			// Opened rather than stat by path, so that the file deleted is the file found old.
+			f, err := openAt(d, entry.Name(), path, unix.O_NONBLOCK)
+			if err != nil {
+				continue
+			}
+			info, err := f.Stat()
+			f.Close()
+			if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(t) {
+				continue
+			}
+			if err := unix.Unlinkat(int(d.Fd()), entry.Name(), 0); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return &fs.PathError{Op: "unlinkat", Path: path, Err: err}
+			}
+			klog.V(2).InfoS("Deleted file", "path", path, "bytes", info.Size(), "modified", info.ModTime())
+			*files++
+			*bytes += info.Size()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package cleanup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPolicyOf(t *testing.T) {
+	emptyDir := corev1.Volume{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	memory := corev1.Volume{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}}
+	complete := map[string]string{AnnotationVolume: "scratch", AnnotationMaxAge: "7d", AnnotationThreshold: "10Gi"}
+	with := func(key, value string) map[string]string {
+		annotations := map[string]string{}
+		for k, v := range complete {
+			annotations[k] = v
+		}
+		annotations[key] = value
+		return annotations
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		volumes     []corev1.Volume
+		want        *Policy
+		wantErr     bool
+	}{
+		{
+			name:    "no annotation",
+			volumes: []corev1.Volume{emptyDir},
+		},
+		{
+			name:        "complete",
+			annotations: complete,
+			volumes:     []corev1.Volume{emptyDir},
+			want:        &Policy{Volume: "scratch", MaxAge: 7 * 24 * time.Hour, ThresholdBytes: 10 << 30},
+		},
+		{
+			name:        "missing annotation",
+			annotations: map[string]string{AnnotationVolume: "scratch"},
+			volumes:     []corev1.Volume{emptyDir},
+			wantErr:     true,
+		},
+		{
+			name:        "unknown volume",
+			annotations: complete,
+			wantErr:     true,
+		},
+		{
+			name:        "memory volume",
+			annotations: complete,
+			volumes:     []corev1.Volume{memory},
+			wantErr:     true,
+		},
+		{
+			name:        "path as volume",
+			annotations: with(AnnotationVolume, "../scratch"),
+			volumes:     []corev1.Volume{emptyDir},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid max age",
+			annotations: with(AnnotationMaxAge, "a week"),
+			volumes:     []corev1.Volume{emptyDir},
+			wantErr:     true,
+		},
+		{
+			name:        "negative threshold",
+			annotations: with(AnnotationThreshold, "-1Gi"),
+			volumes:     []corev1.Volume{emptyDir},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Volumes: tt.volumes},
+			}
+			got, err := PolicyOf(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PolicyOf() error = %v, want error %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("PolicyOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteOlder(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	tests := []struct {
+		name string
+		// setup creates the files below root, the scratch directory being root/volume.
+		setup       func(t *testing.T, root, outside string)
+		dir         string
+		wantFiles   int
+		wantBytes   int64
+		wantErr     bool
+		wantDeleted []string
+		wantKept    []string
+		// wantOutside are the files below outside, which must never be deleted.
+		wantOutside []string
+	}{
+		{
+			name: "old files are deleted, recent files and directories kept",
+			setup: func(t *testing.T, root, outside string) {
+				writeFile(t, filepath.Join(root, "volume/old"), "12345", old)
+				writeFile(t, filepath.Join(root, "volume/new"), "1", time.Now())
+				writeFile(t, filepath.Join(root, "volume/sub/old"), "123", old)
+			},
+			dir:         "volume",
+			wantFiles:   2,
+			wantBytes:   8,
+			wantDeleted: []string{"volume/old", "volume/sub/old"},
+			wantKept:    []string{"volume/new", "volume/sub"},
+		},
+		{
+			name: "symbolic links are not followed",
+			setup: func(t *testing.T, root, outside string) {
+				writeFile(t, filepath.Join(outside, "secret"), "12345", old)
+				writeFile(t, filepath.Join(outside, "dir/secret"), "12345", old)
+				mustSymlink(t, filepath.Join(outside, "secret"), filepath.Join(root, "volume/file-link"))
+				mustSymlink(t, filepath.Join(outside, "dir"), filepath.Join(root, "volume/dir-link"))
+			},
+			dir:         "volume",
+			wantKept:    []string{"volume/file-link", "volume/dir-link"},
+			wantOutside: []string{"secret", "dir/secret"},
+		},
+		{
+			name: "a symbolic link as directory is not followed",
+			setup: func(t *testing.T, root, outside string) {
+				writeFile(t, filepath.Join(outside, "secret"), "12345", old)
+				mustSymlink(t, outside, filepath.Join(root, "volume"))
+			},
+			dir:         "volume",
+			wantErr:     true,
+			wantOutside: []string{"secret"},
+		},
+		{
+			name:    "missing directory",
+			setup:   func(t *testing.T, root, outside string) {},
+			dir:     "volume",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, outside := t.TempDir(), t.TempDir()
+			tt.setup(t, root, outside)
+			files, bytes, err := deleteOlder(context.Background(), root, tt.dir, time.Now().Add(-24*time.Hour))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deleteOlder() error = %v, want error %v", err, tt.wantErr)
+			}
+			if files != tt.wantFiles || bytes != tt.wantBytes {
+				t.Errorf("deleteOlder() = %d files, %d bytes, want %d, %d", files, bytes, tt.wantFiles, tt.wantBytes)
+			}
+			for _, path := range tt.wantDeleted {
+				if _, err := os.Lstat(filepath.Join(root, path)); !os.IsNotExist(err) {
+					t.Errorf("%s was not deleted", path)
+				}
+			}
+			for _, path := range tt.wantKept {
+				if _, err := os.Lstat(filepath.Join(root, path)); err != nil {
+					t.Errorf("%s was deleted: %v", path, err)
+				}
+			}
+			for _, path := range tt.wantOutside {
+				if _, err := os.Lstat(filepath.Join(outside, path)); err != nil {
+					t.Errorf("%s outside the volume was deleted: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string, modified time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/allocation"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// AllocationCollector exports the ephemeral storage the kubelet allocated to the pods of the snapshots, from its
+// checkpoint, and whether it diverges from the pod spec.
+type AllocationCollector struct {
+	provider   provider.Provider
+	opts       Options
+	checkpoint *allocation.Checkpoint
+	request    *prometheus.Desc
+	limit      *prometheus.Desc
+	diverged   *prometheus.Desc
+}
+
+var _ prometheus.Collector = &AllocationCollector{}
+
+// NewAllocationCollector returns a collector of the allocations of checkpoint for the pods of p. The divergence
+// from the spec is only exported with opts.Pods. Pod labels follow opts.
+func NewAllocationCollector(p provider.Provider, opts Options, checkpoint *allocation.Checkpoint) *AllocationCollector {
+	return &AllocationCollector{
+		provider:   p,
+		opts:       opts,
+		checkpoint: checkpoint,
+		request: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "allocated_request_bytes"),
+			"Ephemeral storage request the kubelet allocated to the pod, the sum of its container requests in the allocation checkpoint",
+			podLabelNames(opts), nil,
+		),
+		limit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "allocated_limit_bytes"),
+			"Ephemeral storage limit the kubelet allocated to the pod. Only exported when every container has a limit in the allocation checkpoint",
+			podLabelNames(opts), nil,
+		),
+		diverged: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "allocation_diverged"),
+			"1 if the ephemeral storage request or limit the kubelet allocated to the pod differs from its spec, 0 otherwise",
+			podLabelNames(opts), nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *AllocationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.request
+	ch <- c.limit
+	ch <- c.diverged
+}
+
+// Collect implements prometheus.Collector.
+func (c *AllocationCollector) Collect(ch chan<- prometheus.Metric) {
+	allocations, err := c.checkpoint.Allocations()
+	if err != nil {
+		klog.ErrorS(err, "Failed to read the pod resource allocation checkpoint")
+		return
+	}
+	if len(allocations) == 0 {
+		return
+	}
+	var pods map[string]*corev1.Pod
+	if c.opts.Pods != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+		defer cancel()
+		list := &corev1.PodList{}
+		if err := c.opts.Pods.List(ctx, list); err != nil {
+			klog.ErrorS(err, "Failed to list pods")
+		}
+		pods = make(map[string]*corev1.Pod, len(list.Items))
+		for i := range list.Items {
+			pods[string(list.Items[i].UID)] = &list.Items[i]
+		}
+	}
+	for _, snapshot := range c.provider.Snapshots() {
+		podStats, _, _ := podSeries(snapshot.Pods, c.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			allocated, ok := allocations[stat.UID]
+			if !ok {
+				continue
+			}
+			labels := podLabelValues(c.opts, stat)
+			if allocated.HasRequest {
+				ch <- prometheus.MustNewConstMetric(c.request, prometheus.GaugeValue, float64(allocated.RequestBytes), labels...)
+			}
+			if allocated.HasLimit {
+				ch <- prometheus.MustNewConstMetric(c.limit, prometheus.GaugeValue, float64(allocated.LimitBytes), labels...)
+			}
+			if pod, ok := pods[stat.UID]; ok {
+				ch <- prometheus.MustNewConstMetric(c.diverged, prometheus.GaugeValue, diverged(allocated, pod), labels...)
+			}
+		}
+	}
+}
+
+// diverged returns 1 if allocated differs from the spec of pod. Limits are not compared when the checkpoint has
+// none, since older kubelets only checkpoint requests.
+func diverged(allocated allocation.Allocation, pod *corev1.Pod) float64 {
+	request, hasRequest := provider.EphemeralStorageRequest(pod)
+	if request != allocated.RequestBytes || hasRequest != allocated.HasRequest {
+		return 1
+	}
+	if allocated.HasLimit {
+		if limit, ok := provider.EphemeralStorageLimit(pod); !ok || limit != allocated.LimitBytes {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// PodAverages maintains the average used bytes of every pod over sliding windows, so that alerts can compare
+// a smoothed value with a threshold instead of running avg_over_time on high-churn series.
+type PodAverages struct {
+	windows []time.Duration
+	longest time.Duration
+	desc    *prometheus.Desc
+
+	lock sync.Mutex
+	pods map[string]*podSamples
+}
+
+type podKey struct {
+	node, namespace, name string
+}
+
+type podSamples struct {
+	key    podKey
+	times  []time.Time
+	values []float64
+}
+
+var (
+	_ prometheus.Collector = &PodAverages{}
+	_ provider.Observer    = &PodAverages{}
+)
+
+// NewPodAverages returns averages over each of the given windows.
+func NewPodAverages(windows []time.Duration) *PodAverages {
+	a := &PodAverages{
+		windows: windows,
+		pods:    map[string]*podSamples{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "used_bytes_avg"),
+			"Average used bytes of pod ephemeral storage over the window",
+			[]string{"node_name", "namespace_name", "pod_name", "window"}, nil,
+		),
+	}
+	for _, w := range windows {
+		if w > a.longest {
+			a.longest = w
+		}
+	}
+	return a
+}
+
+// Observe implements provider.Observer. Pods are tracked by UID, so that a pod recreated with the same name, e.g. of
+// a StatefulSet, starts a new average. Pods missing in the stats are removed.
+func (a *PodAverages) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	seen := make(map[string]*podSamples, len(stats))
+	for i := range stats {
+		stat := &stats[i]
+		samples, ok := a.pods[stat.UID]
+		if !ok {
+			samples = &podSamples{key: podKey{stat.NodeName, stat.Namespace, stat.PodName}}
+		}
+		samples.add(now, float64(stat.UsedBytes), a.longest)
+		seen[stat.UID] = samples
+	}
+	a.pods = seen
+}
+
+func (s *podSamples) add(now time.Time, value float64, keep time.Duration) {
+	drop := 0
+	for drop < len(s.times) && now.Sub(s.times[drop]) > keep {
+		drop++
+	}
+	s.times = append(s.times[:0], s.times[drop:]...)
+	s.values = append(s.values[:0], s.values[drop:]...)
+	s.times = append(s.times, now)
+	s.values = append(s.values, value)
+}
+
+// average returns the mean of the samples within window of the last sample, so that averages are kept
+// while no stats are observed, like the stats themselves.
+func (s *podSamples) average(window time.Duration) float64 {
+	last := s.times[len(s.times)-1]
+	var sum float64
+	n := 0
+	for i := len(s.times) - 1; i >= 0 && last.Sub(s.times[i]) <= window; i-- {
+		sum += s.values[i]
+		n++
+	}
+	return sum / float64(n)
+}
+
+// Describe implements prometheus.Collector.
+func (a *PodAverages) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+// Collect implements prometheus.Collector.
+func (a *PodAverages) Collect(ch chan<- prometheus.Metric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, samples := range a.pods {
+		for _, w := range a.windows {
+			ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, samples.average(w),
+				samples.key.node, samples.key.namespace, samples.key.name, model.Duration(w).String())
+		}
+	}
+}
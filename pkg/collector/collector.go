@@ -0,0 +1,354 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+const namespace = "ephemeral_storage"
+
+type ephemeralStorageMetric struct {
+	name        string
+	help        string
+	extraLabels []string
+	valueType   prometheus.ValueType
+	getValue    func(stat *provider.PodStat) float64
+	// capacity marks the metrics that are meaningless while the pod reports no capacity, see
+	// Options.SkipZeroCapacity.
+	capacity bool
+	// max folds the pods summed into OthersPodName with the largest value instead of the sum, for maxima and for
+	// the node filesystem values every pod reports.
+	max bool
+}
+
+func (m *ephemeralStorageMetric) desc(baseLabels []string) *prometheus.Desc {
+	return prometheus.NewDesc(m.name, m.help, append(baseLabels, m.extraLabels...), nil)
+}
+
+// Options configures an EphemeralStorageCollector.
+type Options struct {
+	// Collectors selects the enabled collector families. DefaultSelection is used when nil.
+	Collectors Selection
+	// Pods reads pod objects, usually from an informer cache. Families that need pods are skipped when nil.
+	Pods client.Reader
+	// PodPhaseLabel adds a pod_phase label to pod metrics.
+	PodPhaseLabel bool
+	// RecommendedLabels adds app_name, app_instance and app_component labels to pod metrics, from the
+	// provider.RecommendedLabels kept with provider.Options.PodLabels.
+	RecommendedLabels bool
+	// MaxGrowth exports the max growth tracked with provider.Options.MaxGrowthWindow.
+	MaxGrowth bool
+	// PeakUsage exports the peak used bytes tracked with provider.Options.TrackPeaks.
+	PeakUsage bool
+	// FailOnError makes the collection fail while the last stat summary request of a node failed, so that the
+	// metrics handler responds with an error instead of the stats of the last successful request.
+	FailOnError bool
+	// TopNPerNode limits pod series to the N pods using the most bytes on each node. The other pods of
+	// the node are summed into a series with pod_name="others". Disabled when 0.
+	TopNPerNode int
+	// MinUsedBytes sums the pods using fewer bytes into the series with pod_name="others" as well, since most pods
+	// use little ephemeral storage and only add series. Disabled when 0.
+	MinUsedBytes uint64
+	// StaleAfterFailures marks the stats of a node as stale in ephemeral_storage_stats_stale once this many
+	// consecutive stat summary requests failed. The stats of the last successful request are exported meanwhile.
+	// Disabled when 0.
+	StaleAfterFailures int
+	// SkipZeroCapacity drops the available and capacity bytes of pods and node filesystems that report a capacity
+	// of 0, which some runtimes do briefly, so that ratios over them do not turn into Inf or NaN.
+	SkipZeroCapacity bool
+	// MountLabels adds device, mountpoint and fstype labels to node filesystem metrics, from provider.FsUsage.Mount
+	// set with provider.Options.MountsFile, empty if unknown.
+	MountLabels bool
+	// LeanPodLabels only labels pod, container, volume, inode and cost series with namespace_name and pod_name. The
+	// node and the other attributes of the pod are exported once by the podinfo family instead.
+	LeanPodLabels bool
+	// Decorators add their labels to the series labeled like pods, from provider.PodStat.Decorations, which
+	// provider.Options.Decorators fills with the same decorators.
+	Decorators []provider.Decorator
+	// Derived are pod metrics computed from expressions, validated with ValidateDerived.
+	Derived []DerivedMetric
+}
+
+// OthersPodName is the pod_name of the series aggregating pods outside of Options.TopNPerNode or below
+// Options.MinUsedBytes.
+const OthersPodName = "others"
+
+// EphemeralStorageCollector exposes the snapshots of a provider.Provider as prometheus metrics.
+type EphemeralStorageCollector struct {
+	provider        provider.Provider
+	opts            Options
+	errors          prometheus.Gauge
+	kubeletUp       *prometheus.Desc
+	scrapeLatency   *prometheus.Desc
+	stale           *prometheus.Desc
+	statsAge        *prometheus.Desc
+	payloadBytes    *prometheus.Desc
+	parseDuration   *prometheus.Desc
+	statsSource     *prometheus.Desc
+	schema          *prometheus.Desc
+	runtime         *prometheus.Desc
+	interval        *prometheus.Desc
+	kubeletRestarts *prometheus.Desc
+	successRatio    *prometheus.Desc
+	budgetExhausted *prometheus.Desc
+	statsStale      *prometheus.Desc
+	families        []family
+}
+
+var _ prometheus.Collector = &EphemeralStorageCollector{}
+
+// NewEphemeralStorageCollector returns a collector for the snapshots of the given provider.
+// https://github.com/kubernetes/kubernetes/blob/7d309e0104fedb57280b261e5677d919cb2a0e2d/staging/src/k8s.io/kubelet/pkg/apis/stats/v1alpha1/types.go#L128
+// https://github.com/kubernetes/kubernetes/blob/7d309e0104fedb57280b261e5677d919cb2a0e2d/staging/src/k8s.io/kubelet/pkg/apis/stats/v1alpha1/types.go#L280-L305
+func NewEphemeralStorageCollector(p provider.Provider, opts Options) *EphemeralStorageCollector {
+	if opts.Collectors == nil {
+		opts.Collectors = DefaultSelection()
+	}
+	c := &EphemeralStorageCollector{
+		provider: p,
+		opts:     opts,
+		errors: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "scrape_error",
+			Help:      "1 if there was an error while getting container metrics, 0 otherwise",
+		}),
+		kubeletUp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "kubelet_up"),
+			"1 if the last stat summary request to the kubelet of the node succeeded, 0 otherwise",
+			[]string{"node_name"}, nil,
+		),
+		scrapeLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "kubelet_scrape_latency_seconds"),
+			"Duration of the last stat summary request to the kubelet of the node",
+			[]string{"node_name"}, nil,
+		),
+		stale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stale_seconds"),
+			"Age of the stats of the node, i.e. seconds since the last successful stat summary request to its kubelet",
+			[]string{"node_name"}, nil,
+		),
+		statsAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stats_age_seconds"),
+			"Age of the kubelet stats in the last successful stat summary of the node at the time of the request, from their FsStats time, by fs: nodefs, imagefs or pods, the oldest pod",
+			[]string{"node_name", "fs"}, nil,
+		),
+		payloadBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "summary_payload_bytes"),
+			"Size of the last stat summary response of the kubelet of the node",
+			[]string{"node_name"}, nil,
+		),
+		parseDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "summary_parse_duration_seconds"),
+			"Time spent decoding the last stat summary response of the kubelet of the node",
+			[]string{"node_name"}, nil,
+		),
+		interval: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "scrape_interval_seconds"),
+			"Interval until the next stat summary request to the kubelet of the node",
+			[]string{"node_name"}, nil,
+		),
+		kubeletRestarts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "kubelet_restarts_total"),
+			"Number of restarts of the kubelet of the node detected from the start time in its stat summary",
+			[]string{"node_name"}, nil,
+		),
+		successRatio: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "scrape_success_ratio_5m"),
+			"Fraction of the stat summary requests to the kubelet of the node in the last 5 minutes that succeeded",
+			[]string{"node_name"}, nil,
+		),
+		budgetExhausted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "scrape_error_budget_exhausted"),
+			"1 while more stat summary requests to the kubelet of the node failed in the last 5 minutes than -scrape-error-budget allows and failed requests back off, 0 otherwise",
+			[]string{"node_name"}, nil,
+		),
+		statsStale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stats_stale"),
+			"1 while the exported stats of the node are those of the last successful stat summary request, after -stale-after-failures failed requests, 0 otherwise",
+			[]string{"node_name"}, nil,
+		),
+		statsSource: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "stats_source"),
+			"1 for the source of the pod stats detected in the stat summary of the node: summary, containers or none",
+			[]string{"node_name", "source"}, nil,
+		),
+		schema: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "summary_schema_version"),
+			"1 for the kubelet version of the node and the storage fields present in its stat summary, comma separated",
+			[]string{"node_name", "kubelet_version", "fields"}, nil,
+		),
+		runtime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "container_runtime"),
+			"1 for the container runtime of the node and its known stat summary quirks, comma separated",
+			[]string{"node_name", "runtime", "version", "quirks"}, nil,
+		),
+	}
+	for _, name := range FamilyNames() {
+		if !opts.Collectors[name] {
+			continue
+		}
+		factory := factories[name]
+		if factory.needsPods && opts.Pods == nil {
+			klog.Warningf("Collector %s needs pod objects and is disabled", name)
+			continue
+		}
+		klog.V(1).Infof("Enabled collector %s", name)
+		c.families = append(c.families, factory.new(opts))
+	}
+	if len(opts.Derived) > 0 {
+		c.families = append(c.families, newDerivedFamily(opts))
+	}
+	return c
+}
+
+// Collect implements prometheus.Collector.
+func (c *EphemeralStorageCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshots := c.provider.Snapshots()
+	failed := 0.0
+	for _, snapshot := range snapshots {
+		if snapshot.Node.Up {
+			continue
+		}
+		failed = 1
+		if c.opts.FailOnError {
+			ch <- prometheus.NewInvalidMetric(c.kubeletUp, fmt.Errorf("stat summary request to node %s failed: %s", snapshot.Node.NodeName, snapshot.Node.Error))
+		}
+	}
+	c.errors.Set(failed)
+	for _, f := range c.families {
+		f.collect(ch, snapshots)
+	}
+	c.collectNodeStatuses(ch, snapshots)
+	c.errors.Collect(ch)
+}
+
+// Describe implements prometheus.Collector.
+func (c *EphemeralStorageCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.errors.Describe(ch)
+	ch <- c.kubeletUp
+	ch <- c.scrapeLatency
+	ch <- c.stale
+	ch <- c.statsAge
+	ch <- c.payloadBytes
+	ch <- c.parseDuration
+	ch <- c.statsSource
+	ch <- c.schema
+	ch <- c.runtime
+	ch <- c.interval
+	ch <- c.kubeletRestarts
+	ch <- c.successRatio
+	ch <- c.budgetExhausted
+	if c.opts.StaleAfterFailures > 0 {
+		ch <- c.statsStale
+	}
+	for _, f := range c.families {
+		f.describe(ch)
+	}
+}
+
+func (c *EphemeralStorageCollector) collectNodeStatuses(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	now := time.Now()
+	for _, snapshot := range snapshots {
+		status := snapshot.Node
+		up := 0.0
+		if status.Up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.kubeletUp, prometheus.GaugeValue, up, status.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.scrapeLatency, prometheus.GaugeValue, status.Latency.Seconds(), status.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.payloadBytes, prometheus.GaugeValue, float64(status.PayloadBytes), status.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.parseDuration, prometheus.GaugeValue, status.ParseDuration.Seconds(), status.NodeName)
+		if status.Interval > 0 {
+			ch <- prometheus.MustNewConstMetric(c.interval, prometheus.GaugeValue, status.Interval.Seconds(), status.NodeName)
+		}
+		ch <- prometheus.MustNewConstMetric(c.kubeletRestarts, prometheus.CounterValue, float64(status.KubeletRestarts), status.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.successRatio, prometheus.GaugeValue, status.SuccessRatio, status.NodeName)
+		exhausted := 0.0
+		if status.ErrorBudgetExhausted {
+			exhausted = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.budgetExhausted, prometheus.GaugeValue, exhausted, status.NodeName)
+		if snapshot.Source != "" {
+			ch <- prometheus.MustNewConstMetric(c.statsSource, prometheus.GaugeValue, 1, status.NodeName, snapshot.Source)
+		}
+		if !snapshot.SummaryTime.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.schema, prometheus.GaugeValue, 1, status.NodeName, snapshot.KubeletVersion, snapshot.SummaryFields)
+		}
+		if runtime := snapshot.Runtime; runtime.Name != "" {
+			ch <- prometheus.MustNewConstMetric(c.runtime, prometheus.GaugeValue, 1, status.NodeName, runtime.Name, runtime.Version, strings.Join(runtime.Quirks, ","))
+		}
+		if !snapshot.SummaryTime.IsZero() && c.opts.StaleAfterFailures > 0 {
+			stale := 0.0
+			if status.ConsecutiveFailures >= c.opts.StaleAfterFailures {
+				stale = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.statsStale, prometheus.GaugeValue, stale, status.NodeName)
+		}
+		if !snapshot.SummaryTime.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.stale, prometheus.GaugeValue, now.Sub(snapshot.SummaryTime).Seconds(), status.NodeName)
+		}
+		for fs, age := range snapshot.StatsAge {
+			ch <- prometheus.MustNewConstMetric(c.statsAge, prometheus.GaugeValue, age.Seconds(), status.NodeName, fs)
+		}
+	}
+}
+
+// recommendedLabelNames are the label names of provider.RecommendedLabels.
+var recommendedLabelNames = []string{"app_name", "app_instance", "app_component"}
+
+func podLabelNames(opts Options) []string {
+	if opts.LeanPodLabels {
+		return []string{"namespace_name", "pod_name"}
+	}
+	labels := []string{"node_name", "namespace_name", "pod_name"}
+	if opts.PodPhaseLabel {
+		labels = append(labels, "pod_phase")
+	}
+	if opts.RecommendedLabels {
+		labels = append(labels, recommendedLabelNames...)
+	}
+	return append(labels, provider.DecoratorLabelNames(opts.Decorators)...)
+}
+
+func podLabelValues(opts Options, stat *provider.PodStat) []string {
+	if opts.LeanPodLabels {
+		return []string{stat.Namespace, stat.PodName}
+	}
+	values := []string{stat.NodeName, stat.Namespace, stat.PodName}
+	if opts.PodPhaseLabel {
+		values = append(values, stat.Phase)
+	}
+	if opts.RecommendedLabels {
+		for i := range recommendedLabelNames {
+			value := ""
+			if i < len(stat.Labels) {
+				value = stat.Labels[i]
+			}
+			values = append(values, value)
+		}
+	}
+	return appendDecorations(values, opts.Decorators, stat)
+}
+
+// appendDecorations appends the decoration values of stat, or empty values if the pod is unknown.
+func appendDecorations(values []string, decorators []provider.Decorator, stat *provider.PodStat) []string {
+	if len(decorators) == 0 {
+		return values
+	}
+	n := len(provider.DecoratorLabelNames(decorators))
+	for i := 0; i < n; i++ {
+		value := ""
+		if i < len(stat.Decorations) {
+			value = stat.Decorations[i]
+		}
+		values = append(values, value)
+	}
+	return values
+}
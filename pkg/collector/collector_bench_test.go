@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"k8s-ephemeral-storage-metrics/pkg/fakekubelet"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+var benchmarkPodCounts = []int{10, 100, 300, 1000}
+
+func newBenchmarkManager(b *testing.B, pods int) (*provider.Manager, *fakekubelet.Server) {
+	b.Helper()
+
+	srv := fakekubelet.NewServer(fakekubelet.Options{Pods: pods, ContainersPerPod: 2, VolumesPerPod: 1})
+	b.Cleanup(srv.Close)
+
+	// The default client rate limiter would dominate the measurement.
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, QPS: 1e6, Burst: 1e6})
+	if err != nil {
+		b.Fatalf("failed to create clientset: %v", err)
+	}
+	return provider.NewManager(cli, provider.Options{NodeName: srv.NodeName(), Interval: time.Second}), srv
+}
+
+func gather(b *testing.B, reg *prometheus.Registry) {
+	if _, err := reg.Gather(); err != nil {
+		b.Fatalf("failed to gather metrics: %v", err)
+	}
+}
+
+func BenchmarkScrape(b *testing.B) {
+	for _, pods := range benchmarkPodCounts {
+		b.Run(fmt.Sprintf("pods=%d", pods), func(b *testing.B) {
+			m, _ := newBenchmarkManager(b, pods)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Update(context.Background())
+			}
+		})
+	}
+}
+
+func BenchmarkCollect(b *testing.B) {
+	for _, pods := range benchmarkPodCounts {
+		b.Run(fmt.Sprintf("pods=%d", pods), func(b *testing.B) {
+			m, _ := newBenchmarkManager(b, pods)
+			m.Update(context.Background())
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(NewEphemeralStorageCollector(m, Options{}))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				gather(b, reg)
+			}
+		})
+	}
+}
+
+func BenchmarkScrapeAndCollect(b *testing.B) {
+	for _, pods := range benchmarkPodCounts {
+		b.Run(fmt.Sprintf("pods=%d", pods), func(b *testing.B) {
+			m, _ := newBenchmarkManager(b, pods)
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(NewEphemeralStorageCollector(m, Options{}))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Update(context.Background())
+				gather(b, reg)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("container", false, false, newContainerFamily)
+}
+
+// containerFamily exports the writable layer and log usage of containers.
+// It requires provider.Options.KeepContainers.
+type containerFamily struct {
+	opts   Options
+	rootfs *prometheus.Desc
+	logs   *prometheus.Desc
+}
+
+func newContainerFamily(opts Options) family {
+	labels := append(podLabelNames(opts), "container_name")
+	return &containerFamily{
+		opts:   opts,
+		rootfs: prometheus.NewDesc(prometheus.BuildFQName(namespace, "container", "rootfs_used_bytes"), "Used bytes of the container writable layer", labels, nil),
+		logs:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "container", "logs_used_bytes"), "Used bytes of the container logs", labels, nil),
+	}
+}
+
+func (f *containerFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.rootfs
+	ch <- f.logs
+}
+
+func (f *containerFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		podStats, _, _ := podSeries(snapshot.Pods, f.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			for _, container := range stat.Containers {
+				labels := append(podLabelValues(f.opts, stat), container.Name)
+				ch <- prometheus.MustNewConstMetric(f.rootfs, prometheus.GaugeValue, float64(container.RootfsUsedBytes), labels...)
+				ch <- prometheus.MustNewConstMetric(f.logs, prometheus.GaugeValue, float64(container.LogsUsedBytes), labels...)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+const gib = 1 << 30
+
+// PriceFunc returns the price of a GiB of ephemeral storage per hour on the node, or false if it is unknown.
+type PriceFunc func(node string) (float64, bool)
+
+// CostEstimator exports the hourly cost of the ephemeral storage used by every pod, so that FinOps dashboards
+// can show the monetary impact of scratch space.
+type CostEstimator struct {
+	provider provider.Provider
+	opts     Options
+	price    PriceFunc
+	desc     *prometheus.Desc
+}
+
+var _ prometheus.Collector = &CostEstimator{}
+
+// NewCostEstimator returns a collector of the cost of the pods of the snapshots of p. Pod labels follow opts.
+func NewCostEstimator(p provider.Provider, opts Options, price PriceFunc) *CostEstimator {
+	return &CostEstimator{
+		provider: p,
+		opts:     opts,
+		price:    price,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "estimated_cost_per_hour"),
+			"Estimated cost per hour of the ephemeral storage used by the pod, from the configured price per GiB-hour of its node",
+			podLabelNames(opts), nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *CostEstimator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *CostEstimator) Collect(ch chan<- prometheus.Metric) {
+	for _, snapshot := range c.provider.Snapshots() {
+		price, ok := c.price(snapshot.Node.NodeName)
+		if !ok {
+			continue
+		}
+		podStats, others, _ := podSeries(snapshot.Pods, c.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(stat.UsedBytes)/gib*price, podLabelValues(c.opts, stat)...)
+		}
+		if len(others) > 0 {
+			var used uint64
+			for i := range others {
+				used += others[i].UsedBytes
+			}
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(used)/gib*price, podLabelValues(c.opts, &provider.PodStat{NodeName: snapshot.Node.NodeName, PodName: OthersPodName})...)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// DerivedMetric is a pod metric computed at collection time from an expression over the stats of the pod, e.g.
+// used / capacity, so that sites can export ratios without recording rules.
+type DerivedMetric struct {
+	// Name is the metric name, e.g. ephemeral_storage_pod_used_ratio.
+	Name string `json:"name"`
+	Help string `json:"help,omitempty"`
+	// Expr combines the variables of derivedVariables and numbers with + - * / and parentheses.
+	Expr string `json:"expr"`
+}
+
+// derivedVariables are the variables of expressions. limit and request are only known from pod objects.
+var derivedVariables = map[string]func(stat *provider.PodStat, pod *corev1.Pod) (float64, bool){
+	"used":        func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.UsedBytes), true },
+	"available":   func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.AvailableBytes), true },
+	"capacity":    func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.CapacityBytes), true },
+	"inodes_used": func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.InodesUsed), true },
+	"max_growth":  func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.MaxGrowthBytes), true },
+	"peak_used":   func(stat *provider.PodStat, _ *corev1.Pod) (float64, bool) { return float64(stat.PeakUsedBytes), true },
+	"limit": func(_ *provider.PodStat, pod *corev1.Pod) (float64, bool) {
+		if pod == nil {
+			return 0, false
+		}
+		limit, ok := provider.EphemeralStorageLimit(pod)
+		return float64(limit), ok
+	},
+	"request": func(_ *provider.PodStat, pod *corev1.Pod) (float64, bool) {
+		if pod == nil {
+			return 0, false
+		}
+		request, ok := provider.EphemeralStorageRequest(pod)
+		return float64(request), ok
+	},
+}
+
+// podVariables are the variables read from pod objects.
+var podVariables = map[string]bool{"limit": true, "request": true}
+
+// ValidateDerived checks the names and expressions of metrics.
+func ValidateDerived(metrics []DerivedMetric) error {
+	seen := map[string]bool{}
+	for _, m := range metrics {
+		if !model.IsValidMetricName(model.LabelValue(m.Name)) {
+			return fmt.Errorf("%q is not a valid metric name", m.Name)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("%s is defined twice", m.Name)
+		}
+		seen[m.Name] = true
+		if _, _, err := compileExpr(m.Expr); err != nil {
+			return fmt.Errorf("%s: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// expr evaluates to a value, or to false if a variable is unknown or a division by zero occurs, so that no
+// Inf or NaN is exported.
+type expr func(stat *provider.PodStat, pod *corev1.Pod) (float64, bool)
+
+// compileExpr compiles s and reports whether it reads pod objects.
+func compileExpr(s string) (expr, bool, error) {
+	p := &exprParser{tokens: tokenize(s)}
+	e, err := p.sum()
+	if err != nil {
+		return nil, false, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, false, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, p.needsPods, nil
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t+-*/()", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens    []string
+	pos       int
+	needsPods bool
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// sum parses terms separated by + and -.
+func (p *exprParser) sum() (expr, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+	return left, nil
+}
+
+// product parses factors separated by * and /.
+func (p *exprParser) product() (expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "*" || op == "/"; op = p.peek() {
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+	return left, nil
+}
+
+// factor parses a number, a variable, a negated factor or a parenthesized expression.
+func (p *exprParser) factor() (expr, error) {
+	token := p.peek()
+	p.pos++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "-":
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(stat *provider.PodStat, pod *corev1.Pod) (float64, bool) {
+			v, ok := e(stat, pod)
+			return -v, ok
+		}, nil
+	case "(":
+		e, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	if v, ok := derivedVariables[token]; ok {
+		p.needsPods = p.needsPods || podVariables[token]
+		return v, nil
+	}
+	n, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		names := make([]string, 0, len(derivedVariables))
+		for name := range derivedVariables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown variable %q, expected a number or one of %s", token, strings.Join(names, ", "))
+	}
+	return func(*provider.PodStat, *corev1.Pod) (float64, bool) { return n, true }, nil
+}
+
+func binary(op string, left, right expr) expr {
+	return func(stat *provider.PodStat, pod *corev1.Pod) (float64, bool) {
+		a, ok := left(stat, pod)
+		if !ok {
+			return 0, false
+		}
+		b, ok := right(stat, pod)
+		if !ok {
+			return 0, false
+		}
+		switch op {
+		case "+":
+			return a + b, true
+		case "-":
+			return a - b, true
+		case "*":
+			return a * b, true
+		}
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	}
+}
+
+// derivedFamily exports the DerivedMetric of Options.Derived for every pod. Pods summed into others with
+// Options.TopNPerNode or Options.MinUsedBytes have no derived series, since ratios do not add up.
+type derivedFamily struct {
+	opts      Options
+	exprs     []expr
+	descs     []*prometheus.Desc
+	needsPods bool
+}
+
+func newDerivedFamily(opts Options) *derivedFamily {
+	f := &derivedFamily{opts: opts}
+	for _, m := range opts.Derived {
+		// Validated with the config.
+		e, needsPods, err := compileExpr(m.Expr)
+		if err != nil {
+			klog.ErrorS(err, "Skipping invalid derived metric", "name", m.Name)
+			continue
+		}
+		if needsPods && opts.Pods == nil {
+			klog.Warningf("Derived metric %s needs pod objects and is disabled", m.Name)
+			continue
+		}
+		help := m.Help
+		if help == "" {
+			help = "Derived from the pod stats: " + m.Expr
+		}
+		f.needsPods = f.needsPods || needsPods
+		f.exprs = append(f.exprs, e)
+		f.descs = append(f.descs, prometheus.NewDesc(m.Name, help, podLabelNames(opts), nil))
+	}
+	return f
+}
+
+func (f *derivedFamily) describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range f.descs {
+		ch <- desc
+	}
+}
+
+func (f *derivedFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	var pods map[string]*corev1.Pod
+	if f.needsPods {
+		ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+		defer cancel()
+		list := &corev1.PodList{}
+		if err := f.opts.Pods.List(ctx, list); err != nil {
+			klog.ErrorS(err, "Failed to list pods")
+		}
+		pods = make(map[string]*corev1.Pod, len(list.Items))
+		for i := range list.Items {
+			pods[string(list.Items[i].UID)] = &list.Items[i]
+		}
+	}
+	for _, snapshot := range snapshots {
+		podStats, _, _ := podSeries(snapshot.Pods, f.opts)
+		for j := range podStats {
+			stat := &podStats[j]
+			pod := pods[stat.UID]
+			for i, e := range f.exprs {
+				if v, ok := e(stat, pod); ok {
+					ch <- prometheus.MustNewConstMetric(f.descs[i], prometheus.GaugeValue, v, podLabelValues(f.opts, stat)...)
+				}
+			}
+		}
+	}
+}
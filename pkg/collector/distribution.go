@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("distribution", false, false, newDistributionFamily)
+}
+
+const (
+	// distributionBucketFactor bounds the growth between consecutive buckets of the native histogram of pod used
+	// bytes to 10%, resolved to the next schema, 2^(2^-3) or about 9%.
+	distributionBucketFactor = 1.1
+	// distributionMaxBuckets bounds the buckets of a node, whose resolution is lowered beyond.
+	distributionMaxBuckets = 160
+)
+
+// distributionFamily exports the distribution of pod used bytes of every node as a native histogram, whose
+// exponential buckets cover any usage at a fraction of the series of the pod family. Prometheus only scrapes
+// native histograms in the protobuf format, with the native-histograms feature; other scrapers get the sum and
+// count only.
+type distributionFamily struct {
+	opts prometheus.HistogramOpts
+}
+
+func newDistributionFamily(Options) family {
+	return &distributionFamily{
+		opts: prometheus.HistogramOpts{
+			Namespace:                      namespace,
+			Subsystem:                      "pod",
+			Name:                           "used_bytes_distribution",
+			Help:                           "Native histogram of the used bytes of the ephemeral storage of the pods of the node",
+			NativeHistogramBucketFactor:    distributionBucketFactor,
+			NativeHistogramMaxBucketNumber: distributionMaxBuckets,
+		},
+	}
+}
+
+func (f *distributionFamily) describe(ch chan<- *prometheus.Desc) {
+	prometheus.NewHistogramVec(f.opts, []string{"node_name"}).Describe(ch)
+}
+
+// collect observes the pods of the snapshots in new histograms, since the distribution is that of the last
+// summaries and not of all observations.
+func (f *distributionFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	histograms := prometheus.NewHistogramVec(f.opts, []string{"node_name"})
+	for _, snapshot := range snapshots {
+		histogram := histograms.WithLabelValues(snapshot.Node.NodeName)
+		for i := range snapshot.Pods {
+			histogram.Observe(float64(snapshot.Pods[i].UsedBytes))
+		}
+	}
+	histograms.Collect(ch)
+}
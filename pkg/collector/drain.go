@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// drainTaints are the taints set by the tools that drain nodes, besides the cordon of kubectl
+// (spec.unschedulable and its node.kubernetes.io/unschedulable taint).
+var drainTaints = []string{
+	corev1.TaintNodeUnschedulable,
+	"ToBeDeletedByClusterAutoscaler",
+	"karpenter.sh/disruption",
+	"node.kubernetes.io/out-of-service",
+}
+
+// NodeDraining exports whether the node is cordoned or being drained, so that alerts on ephemeral storage can be
+// silenced while pods are evicted intentionally during maintenance.
+type NodeDraining struct {
+	reader client.Reader
+	node   string
+	desc   *prometheus.Desc
+}
+
+var _ prometheus.Collector = &NodeDraining{}
+
+// NewNodeDraining returns a collector of the draining state of node read from reader.
+func NewNodeDraining(reader client.Reader, node string) *NodeDraining {
+	return &NodeDraining{
+		reader: reader,
+		node:   node,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node", "draining"),
+			"1 if the node is cordoned or has a taint of a drain, e.g. of the cluster autoscaler, 0 otherwise",
+			[]string{"node_name"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *NodeDraining) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.desc
+}
+
+// Collect implements prometheus.Collector.
+func (d *NodeDraining) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	node := &corev1.Node{}
+	if err := d.reader.Get(ctx, types.NamespacedName{Name: d.node}, node); err != nil {
+		klog.ErrorS(err, "Failed to get node", "node", d.node)
+		return
+	}
+	draining := 0.0
+	if isDraining(node) {
+		draining = 1
+	}
+	ch <- prometheus.MustNewConstMetric(d.desc, prometheus.GaugeValue, draining, d.node)
+}
+
+// isDraining reports whether node is unschedulable or has a taint of a drain.
+func isDraining(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		for _, key := range drainTaints {
+			if taint.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("histogram", false, false, newHistogramFamily)
+}
+
+// histogramBuckets are the upper bounds of the pod used bytes histogram, from 1MiB to 1TiB.
+var histogramBuckets = prometheus.ExponentialBuckets(1<<20, 4, 11)
+
+// histogramFamily exports the distribution of pod used bytes of every node. Gauges cannot carry exemplars,
+// so the histogram is where the pod behind a spike is linked: each bucket has an exemplar of its largest pod.
+// Exemplars are only exposed in the OpenMetrics format.
+type histogramFamily struct {
+	desc *prometheus.Desc
+}
+
+func newHistogramFamily(Options) family {
+	return &histogramFamily{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node", "pod_used_bytes"),
+			"Distribution of used bytes of the pods of the node, with an exemplar of the largest pod of each bucket",
+			[]string{"node_name"}, nil,
+		),
+	}
+}
+
+func (f *histogramFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *histogramFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		counts := make([]uint64, len(histogramBuckets))
+		largest := make([]*provider.PodStat, len(histogramBuckets)+1)
+		var sum float64
+		for i := range snapshot.Pods {
+			stat := &snapshot.Pods[i]
+			used := float64(stat.UsedBytes)
+			sum += used
+			bucket := len(histogramBuckets)
+			for j, bound := range histogramBuckets {
+				if used <= bound {
+					bucket = j
+					break
+				}
+			}
+			for j := bucket; j < len(counts); j++ {
+				counts[j]++
+			}
+			if largest[bucket] == nil || largest[bucket].UsedBytes < stat.UsedBytes {
+				largest[bucket] = stat
+			}
+		}
+		buckets := make(map[float64]uint64, len(histogramBuckets))
+		for i, bound := range histogramBuckets {
+			buckets[bound] = counts[i]
+		}
+		metric := prometheus.MustNewConstHistogram(f.desc, uint64(len(snapshot.Pods)), sum, buckets, snapshot.Node.NodeName)
+
+		var exemplars []prometheus.Exemplar
+		for _, stat := range largest {
+			if stat != nil {
+				exemplars = append(exemplars, podExemplar(stat, snapshot))
+			}
+		}
+		if len(exemplars) > 0 {
+			withExemplars, err := prometheus.NewMetricWithExemplars(metric, exemplars...)
+			if err != nil {
+				klog.V(4).Infof("Dropping exemplars of node %s: %v", snapshot.Node.NodeName, err)
+			} else {
+				metric = withExemplars
+			}
+		}
+		ch <- metric
+	}
+}
+
+// podExemplar links an observation to its pod. The pod name is left out if the labels would exceed
+// prometheus.ExemplarMaxRunes.
+func podExemplar(stat *provider.PodStat, snapshot *provider.Snapshot) prometheus.Exemplar {
+	labels := prometheus.Labels{"pod_uid": stat.UID}
+	pod := stat.Namespace + "/" + stat.PodName
+	if len("pod_uid")+len(stat.UID)+len("pod")+len(pod) <= prometheus.ExemplarMaxRunes {
+		labels["pod"] = pod
+	}
+	return prometheus.Exemplar{
+		Value:     float64(stat.UsedBytes),
+		Labels:    labels,
+		Timestamp: snapshot.SummaryTime,
+	}
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("host", false, false, newHostFamily)
+}
+
+// hostFamily exports who uses the node filesystem, since disk pressure often comes from outside any single pod.
+type hostFamily struct {
+	desc *prometheus.Desc
+}
+
+func newHostFamily(Options) family {
+	return &hostFamily{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node_fs", "owner_used_bytes"),
+			"Used bytes of the node filesystem by owner: pods, runtime (images, if the image filesystem is the node filesystem) or other",
+			[]string{"node_name", "owner"}, nil,
+		),
+	}
+}
+
+func (f *hostFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *hostFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		usage := snapshot.HostFs
+		if usage == nil {
+			continue
+		}
+		node := snapshot.Node.NodeName
+		ch <- prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, float64(usage.PodsBytes), node, "pods")
+		ch <- prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, float64(usage.RuntimeBytes), node, "runtime")
+		ch <- prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, float64(usage.OtherBytes), node, "other")
+	}
+}
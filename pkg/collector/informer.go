@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InformerHealth exports the health of the informers that pod labels, owners, node labels and namespaces are read
+// from, so that enrichment failures are observable rather than showing up as stale or missing labels.
+type InformerHealth struct {
+	watchErrors *prometheus.CounterVec
+	events      *prometheus.CounterVec
+	synced      *prometheus.Desc
+
+	lock      sync.Mutex
+	informers map[string]cache.Informer
+}
+
+var _ prometheus.Collector = &InformerHealth{}
+
+func NewInformerHealth() *InformerHealth {
+	return &InformerHealth{
+		watchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "informer_watch_errors_total",
+			Help:      "Failed list and watch requests of the informer of the resource",
+		}, []string{"resource"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "informer_events_total",
+			Help:      "Events delivered by the informer of the resource, by event: add, update, delete or resync",
+		}, []string{"resource", "event"}),
+		synced: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "informer", "synced"),
+			"1 if the informer of the resource has synced its cache, 0 otherwise",
+			[]string{"resource"}, nil,
+		),
+		informers: map[string]cache.Informer{},
+	}
+}
+
+// Watch instruments the informer of obj in c. It must be called before c is started, since the watch error
+// handler of a running informer cannot be replaced.
+func (h *InformerHealth) Watch(ctx context.Context, c cache.Cache, resource string, obj client.Object) error {
+	informer, err := c.GetInformer(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if shared, ok := informer.(toolscache.SharedIndexInformer); ok {
+		watchErrors := h.watchErrors.WithLabelValues(resource)
+		if err := shared.SetWatchErrorHandler(func(r *toolscache.Reflector, err error) {
+			watchErrors.Inc()
+			toolscache.DefaultWatchErrorHandler(r, err)
+		}); err != nil {
+			return fmt.Errorf("failed to set watch error handler of %s: %w", resource, err)
+		}
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { h.events.WithLabelValues(resource, "add").Inc() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			event := "update"
+			// Resyncs redeliver the cached object as an update.
+			if oldMeta, ok := oldObj.(metav1.Object); ok {
+				if newMeta, ok := newObj.(metav1.Object); ok && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+					event = "resync"
+				}
+			}
+			h.events.WithLabelValues(resource, event).Inc()
+		},
+		DeleteFunc: func(interface{}) { h.events.WithLabelValues(resource, "delete").Inc() },
+	})
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	h.informers[resource] = informer
+	h.lock.Unlock()
+	return nil
+}
+
+// Describe implements prometheus.Collector.
+func (h *InformerHealth) Describe(ch chan<- *prometheus.Desc) {
+	h.watchErrors.Describe(ch)
+	h.events.Describe(ch)
+	ch <- h.synced
+}
+
+// Collect implements prometheus.Collector.
+func (h *InformerHealth) Collect(ch chan<- prometheus.Metric) {
+	h.watchErrors.Collect(ch)
+	h.events.Collect(ch)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for resource, informer := range h.informers {
+		synced := 0.0
+		if informer.HasSynced() {
+			synced = 1
+		}
+		ch <- prometheus.MustNewConstMetric(h.synced, prometheus.GaugeValue, synced, resource)
+	}
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("inodes", false, false, newInodesFamily)
+}
+
+type inodesFamily struct {
+	opts        Options
+	podUsed     *prometheus.Desc
+	nodeFsUsed  *prometheus.Desc
+	nodeFsTotal *prometheus.Desc
+}
+
+func newInodesFamily(opts Options) family {
+	return &inodesFamily{
+		opts:        opts,
+		podUsed:     prometheus.NewDesc(prometheus.BuildFQName(namespace, "pod", "inodes_used"), "Used inodes of pod ephemeral storage", podLabelNames(opts), nil),
+		nodeFsUsed:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "node_fs", "inodes_used"), "Used inodes of the node filesystem", fsLabelNames(opts), nil),
+		nodeFsTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "node_fs", "inodes"), "Inodes of the node filesystem", fsLabelNames(opts), nil),
+	}
+}
+
+func (f *inodesFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.podUsed
+	ch <- f.nodeFsUsed
+	ch <- f.nodeFsTotal
+}
+
+func (f *inodesFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		podStats, others, _ := podSeries(snapshot.Pods, f.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			ch <- prometheus.MustNewConstMetric(f.podUsed, prometheus.GaugeValue, float64(stat.InodesUsed), podLabelValues(f.opts, stat)...)
+		}
+		if len(others) > 0 {
+			var sum uint64
+			for i := range others {
+				sum += others[i].InodesUsed
+			}
+			ch <- prometheus.MustNewConstMetric(f.podUsed, prometheus.GaugeValue, float64(sum), podLabelValues(f.opts, &provider.PodStat{NodeName: snapshot.Node.NodeName, PodName: OthersPodName})...)
+		}
+		if fs := snapshot.NodeFs; fs != nil {
+			labels := fsLabelValues(snapshot.Node.NodeName, fs, f.opts.MountLabels)
+			ch <- prometheus.MustNewConstMetric(f.nodeFsUsed, prometheus.GaugeValue, float64(fs.InodesUsed), labels...)
+			ch <- prometheus.MustNewConstMetric(f.nodeFsTotal, prometheus.GaugeValue, float64(fs.Inodes), labels...)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// PodLeaks detects pods whose used bytes have not decreased for a long time, e.g. a day, while growing. Slow leaks,
+// such as an unrotated file or a cache without eviction, grow too slowly for growth alerts but fill the disk over
+// weeks.
+type PodLeaks struct {
+	minDuration time.Duration
+	desc        *prometheus.Desc
+
+	lock sync.Mutex
+	pods map[string]*podGrowthRun
+}
+
+// podGrowthRun is the run of non-decreasing used bytes of a pod since start.
+type podGrowthRun struct {
+	key        podKey
+	start      time.Time
+	startBytes uint64
+	last       time.Time
+	lastBytes  uint64
+}
+
+var (
+	_ prometheus.Collector = &PodLeaks{}
+	_ provider.Observer    = &PodLeaks{}
+)
+
+// NewPodLeaks returns a detector of pods whose used bytes grew without decreasing for at least minDuration.
+func NewPodLeaks(minDuration time.Duration) *PodLeaks {
+	return &PodLeaks{
+		minDuration: minDuration,
+		pods:        map[string]*podGrowthRun{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "suspected_leak"),
+			"Growth rate in bytes per second of the used bytes of pod ephemeral storage, exported while they grew without decreasing for longer than -leak-min-duration",
+			[]string{"node_name", "namespace_name", "pod_name"}, nil,
+		),
+	}
+}
+
+// Observe implements provider.Observer. Pods are tracked by UID, pods missing in the stats are removed.
+func (l *PodLeaks) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	seen := make(map[string]*podGrowthRun, len(stats))
+	for i := range stats {
+		stat := &stats[i]
+		run, ok := l.pods[stat.UID]
+		if !ok || stat.UsedBytes < run.lastBytes {
+			run = &podGrowthRun{key: podKey{stat.NodeName, stat.Namespace, stat.PodName}, start: now, startBytes: stat.UsedBytes}
+		}
+		run.last, run.lastBytes = now, stat.UsedBytes
+		seen[stat.UID] = run
+	}
+	l.pods = seen
+}
+
+// Describe implements prometheus.Collector.
+func (l *PodLeaks) Describe(ch chan<- *prometheus.Desc) {
+	ch <- l.desc
+}
+
+// Collect implements prometheus.Collector.
+func (l *PodLeaks) Collect(ch chan<- prometheus.Metric) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, run := range l.pods {
+		elapsed := run.last.Sub(run.start)
+		if elapsed < l.minDuration || run.lastBytes <= run.startBytes {
+			continue
+		}
+		rate := float64(run.lastBytes-run.startBytes) / elapsed.Seconds()
+		ch <- prometheus.MustNewConstMetric(l.desc, prometheus.GaugeValue, rate, run.key.node, run.key.namespace, run.key.name)
+	}
+}
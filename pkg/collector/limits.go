@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+const listTimeout = 10 * time.Second
+
+func init() {
+	registerFamily("limits", false, true, newLimitsFamily)
+}
+
+// limitsFamily exports the ephemeral storage limits and requests of pods read from Options.Pods.
+type limitsFamily struct {
+	reader           client.Reader
+	podsWithoutLimit *prometheus.Desc
+	limit            *prometheus.Desc
+	request          *prometheus.Desc
+}
+
+func newLimitsFamily(opts Options) family {
+	podLabels := []string{"node_name", "namespace_name", "pod_name"}
+	return &limitsFamily{
+		reader: opts.Pods,
+		podsWithoutLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "pods_without_limit"),
+			"Number of running pods with at least one container without an ephemeral storage limit",
+			[]string{"node_name", "namespace_name"}, nil,
+		),
+		limit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "limit_bytes"),
+			"Ephemeral storage limit of the pod, the sum of its container limits. Only exported when every container has a limit",
+			podLabels, nil,
+		),
+		request: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "request_bytes"),
+			"Ephemeral storage request of the pod, the sum of its container requests",
+			podLabels, nil,
+		),
+	}
+}
+
+func (f *limitsFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.podsWithoutLimit
+	ch <- f.limit
+	ch <- f.request
+}
+
+func (f *limitsFamily) collect(ch chan<- prometheus.Metric, _ []*provider.Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	pods := &corev1.PodList{}
+	if err := f.reader.List(ctx, pods); err != nil {
+		klog.ErrorS(err, "Failed to list pods")
+		return
+	}
+
+	type nodeNamespace struct{ node, namespace string }
+	counts := map[nodeNamespace]int{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		key := nodeNamespace{pod.Spec.NodeName, pod.Namespace}
+		if _, ok := counts[key]; !ok {
+			counts[key] = 0
+		}
+
+		limit, hasLimit := provider.EphemeralStorageLimit(pod)
+		if hasLimit {
+			ch <- prometheus.MustNewConstMetric(f.limit, prometheus.GaugeValue, float64(limit), pod.Spec.NodeName, pod.Namespace, pod.Name)
+		} else {
+			counts[key]++
+		}
+		if request, ok := provider.EphemeralStorageRequest(pod); ok {
+			ch <- prometheus.MustNewConstMetric(f.request, prometheus.GaugeValue, float64(request), pod.Spec.NodeName, pod.Namespace, pod.Name)
+		}
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(f.podsWithoutLimit, prometheus.GaugeValue, float64(count), key.node, key.namespace)
+	}
+}
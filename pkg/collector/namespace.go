@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NamespaceInfo exports the configured labels of every namespace as an info metric, e.g. team or cost-center,
+// so that usage can be attributed to tenants with a join on namespace_name.
+type NamespaceInfo struct {
+	reader client.Reader
+	keys   []string
+	desc   *prometheus.Desc
+}
+
+var _ prometheus.Collector = &NamespaceInfo{}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// NamespaceLabelName returns the label name of the namespace label key, like kube-state-metrics does:
+// label_ followed by the key with invalid characters replaced by _.
+func NamespaceLabelName(key string) string {
+	return "label_" + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+// NewNamespaceInfo returns an info metric of the labels keys of the namespaces read from reader.
+func NewNamespaceInfo(reader client.Reader, keys []string) *NamespaceInfo {
+	labels := []string{"namespace_name"}
+	for _, key := range keys {
+		labels = append(labels, NamespaceLabelName(key))
+	}
+	return &NamespaceInfo{
+		reader: reader,
+		keys:   keys,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "namespace", "info"),
+			"Labels of the namespace, always 1",
+			labels, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (n *NamespaceInfo) Describe(ch chan<- *prometheus.Desc) {
+	ch <- n.desc
+}
+
+// Collect implements prometheus.Collector.
+func (n *NamespaceInfo) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	namespaces := &corev1.NamespaceList{}
+	if err := n.reader.List(ctx, namespaces); err != nil {
+		klog.ErrorS(err, "Failed to list namespaces")
+		return
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		values := []string{ns.Name}
+		for _, key := range n.keys {
+			values = append(values, ns.Labels[key])
+		}
+		ch <- prometheus.MustNewConstMetric(n.desc, prometheus.GaugeValue, 1, values...)
+	}
+}
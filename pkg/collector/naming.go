@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// Naming renames metrics to match a naming convention. It applies to every metric of the gatherer it wraps,
+// so the families, summaries and process metrics are renamed consistently.
+type Naming struct {
+	// Prefix replaces the ephemeral_storage_ prefix of the metric names, e.g. k8s_ephemeral_storage_.
+	Prefix *string `json:"prefix,omitempty"`
+	// Overrides set the name and help of a metric, by its name before renaming. Overrides win over Prefix.
+	Overrides map[string]MetricOverride `json:"overrides,omitempty"`
+}
+
+// MetricOverride replaces the name and/or help of a metric. Empty fields are kept.
+type MetricOverride struct {
+	Name string `json:"name,omitempty"`
+	Help string `json:"help,omitempty"`
+}
+
+const defaultPrefix = namespace + "_"
+
+// IsZero reports whether n renames nothing.
+func (n Naming) IsZero() bool {
+	return n.Prefix == nil && len(n.Overrides) == 0
+}
+
+// Validate checks the new names against the Prometheus naming rules and that no two metrics get the same name.
+func (n Naming) Validate() error {
+	if n.Prefix != nil && *n.Prefix != "" && !model.IsValidMetricName(model.LabelValue(*n.Prefix+"x")) {
+		return fmt.Errorf("prefix %q is not a valid metric name prefix", *n.Prefix)
+	}
+	names := make([]string, 0, len(n.Overrides))
+	for name := range n.Overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	targets := map[string]string{}
+	for _, name := range names {
+		override := n.Overrides[name]
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return fmt.Errorf("override of %q: not a valid metric name", name)
+		}
+		if override.Name == "" {
+			continue
+		}
+		if !model.IsValidMetricName(model.LabelValue(override.Name)) {
+			return fmt.Errorf("override of %q: name %q is not a valid metric name", name, override.Name)
+		}
+		if other, ok := targets[override.Name]; ok {
+			return fmt.Errorf("overrides of %q and %q have the same name %q", other, name, override.Name)
+		}
+		targets[override.Name] = name
+	}
+	return nil
+}
+
+func (n Naming) rename(name string) string {
+	if override, ok := n.Overrides[name]; ok && override.Name != "" {
+		return override.Name
+	}
+	if n.Prefix != nil && strings.HasPrefix(name, defaultPrefix) {
+		return *n.Prefix + strings.TrimPrefix(name, defaultPrefix)
+	}
+	return name
+}
+
+// Gatherer returns a gatherer renaming the metric families of g.
+func (n Naming) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if n.IsZero() {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		seen := make(map[string]bool, len(families))
+		for _, family := range families {
+			name := family.GetName()
+			if override, ok := n.Overrides[name]; ok && override.Help != "" {
+				family.Help = proto.String(override.Help)
+			}
+			family.Name = proto.String(n.rename(name))
+			if seen[family.GetName()] {
+				err = appendError(err, fmt.Errorf("metric %s is renamed to the name of another metric, %s", name, family.GetName()))
+			}
+			seen[family.GetName()] = true
+		}
+		sort.Slice(families, func(i, j int) bool {
+			return families[i].GetName() < families[j].GetName()
+		})
+		return families, err
+	})
+}
+
+func appendError(err, other error) error {
+	multi, ok := err.(prometheus.MultiError)
+	if !ok && err != nil {
+		multi = prometheus.MultiError{err}
+	}
+	return append(multi, other)
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("nodefs", true, false, func(opts Options) family {
+		return newFsFamily("node_fs", "node filesystem", opts, func(s *provider.Snapshot) *provider.FsUsage { return s.NodeFs })
+	})
+	registerFamily("imagefs", true, false, func(opts Options) family {
+		return newFsFamily("node_imagefs", "container runtime image filesystem", opts, func(s *provider.Snapshot) *provider.FsUsage { return s.ImageFs })
+	})
+}
+
+// fsFamily exports the bytes usage of a node filesystem.
+type fsFamily struct {
+	fs        func(*provider.Snapshot) *provider.FsUsage
+	skipZero  bool
+	mounts    bool
+	used      *prometheus.Desc
+	available *prometheus.Desc
+	capacity  *prometheus.Desc
+}
+
+func newFsFamily(prefix, description string, opts Options, fs func(*provider.Snapshot) *provider.FsUsage) *fsFamily {
+	labels := fsLabelNames(opts)
+	return &fsFamily{
+		fs:        fs,
+		skipZero:  opts.SkipZeroCapacity,
+		mounts:    opts.MountLabels,
+		used:      prometheus.NewDesc(prometheus.BuildFQName(namespace, prefix, "used_bytes"), "Used bytes of the "+description, labels, nil),
+		available: prometheus.NewDesc(prometheus.BuildFQName(namespace, prefix, "available_bytes"), "Available bytes of the "+description, labels, nil),
+		capacity:  prometheus.NewDesc(prometheus.BuildFQName(namespace, prefix, "capacity_bytes"), "Capacity bytes of the "+description, labels, nil),
+	}
+}
+
+func (f *fsFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.used
+	ch <- f.available
+	ch <- f.capacity
+}
+
+func (f *fsFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		fs := f.fs(snapshot)
+		if fs == nil {
+			continue
+		}
+		labels := fsLabelValues(snapshot.Node.NodeName, fs, f.mounts)
+		ch <- prometheus.MustNewConstMetric(f.used, prometheus.GaugeValue, float64(fs.UsedBytes), labels...)
+		if f.skipZero && fs.CapacityBytes == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(f.available, prometheus.GaugeValue, float64(fs.AvailableBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(f.capacity, prometheus.GaugeValue, float64(fs.CapacityBytes), labels...)
+	}
+}
+
+// fsLabelNames returns the labels of node filesystem metrics.
+func fsLabelNames(opts Options) []string {
+	if opts.MountLabels {
+		return []string{"node_name", "device", "mountpoint", "fstype"}
+	}
+	return []string{"node_name"}
+}
+
+// fsLabelValues returns the values of fsLabelNames for fs of node.
+func fsLabelValues(node string, fs *provider.FsUsage, mounts bool) []string {
+	if !mounts {
+		return []string{node}
+	}
+	if fs.Mount == nil {
+		return []string{node, "", "", ""}
+	}
+	return []string{node, fs.Mount.Device, fs.Mount.Mountpoint, fs.Mount.FsType}
+}
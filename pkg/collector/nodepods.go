@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("nodepods", true, false, newNodePodsFamily)
+}
+
+// nodePodsFamily exports the used bytes of all pods of every node, for dashboards and alerts that only need node
+// rollups and would otherwise sum pod series in a recording rule. With the pod collector disabled it exports a
+// single series per node.
+type nodePodsFamily struct {
+	desc *prometheus.Desc
+}
+
+func newNodePodsFamily(Options) family {
+	return &nodePodsFamily{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node", "pods_used_bytes_total"),
+			"Sum of the used bytes of the ephemeral storage of the pods of the node",
+			[]string{"node_name"}, nil,
+		),
+	}
+}
+
+func (f *nodePodsFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *nodePodsFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		var used uint64
+		for i := range snapshot.Pods {
+			used += snapshot.Pods[i].UsedBytes
+		}
+		ch <- prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, float64(used), snapshot.Node.NodeName)
+	}
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// LimitOvershoots counts the times the used bytes of every pod rose above its ephemeral storage limit. The kubelet
+// only evicts pods over their limit on its own housekeeping interval, so usage that crosses the limit and drops
+// back in between is a near miss that never shows up in events.
+type LimitOvershoots struct {
+	pods provider.PodLookup
+	desc *prometheus.Desc
+
+	lock      sync.Mutex
+	overshoot map[string]*podOvershoot
+}
+
+type podOvershoot struct {
+	key   podKey
+	above bool
+	count uint64
+}
+
+var (
+	_ prometheus.Collector = &LimitOvershoots{}
+	_ provider.Observer    = &LimitOvershoots{}
+)
+
+// NewLimitOvershoots returns a counter of the overshoots of the pods looked up in pods.
+func NewLimitOvershoots(pods provider.PodLookup) *LimitOvershoots {
+	return &LimitOvershoots{
+		pods:      pods,
+		overshoot: map[string]*podOvershoot{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "limit_exceeded_total"),
+			"Number of times the used bytes of pod ephemeral storage were observed to cross the limit of the pod",
+			[]string{"node_name", "namespace_name", "pod_name"}, nil,
+		),
+	}
+}
+
+// Observe implements provider.Observer. Pods are tracked by UID, pods missing in the stats are removed.
+func (o *LimitOvershoots) Observe(stats []provider.PodStat) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	seen := make(map[string]*podOvershoot, len(stats))
+	for i := range stats {
+		stat := &stats[i]
+		pod, ok := o.pods.Pod(context.Background(), stat.Namespace, stat.PodName)
+		if !ok || string(pod.UID) != stat.UID {
+			continue
+		}
+		limit, ok := provider.EphemeralStorageLimit(pod)
+		if !ok {
+			continue
+		}
+		overshoot, ok := o.overshoot[stat.UID]
+		if !ok {
+			overshoot = &podOvershoot{key: podKey{stat.NodeName, stat.Namespace, stat.PodName}}
+		}
+		above := stat.UsedBytes > uint64(limit)
+		if above && !overshoot.above {
+			overshoot.count++
+		}
+		overshoot.above = above
+		seen[stat.UID] = overshoot
+	}
+	o.overshoot = seen
+}
+
+// Describe implements prometheus.Collector.
+func (o *LimitOvershoots) Describe(ch chan<- *prometheus.Desc) {
+	ch <- o.desc
+}
+
+// Collect implements prometheus.Collector.
+func (o *LimitOvershoots) Collect(ch chan<- prometheus.Metric) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, overshoot := range o.overshoot {
+		key := overshoot.key
+		ch <- prometheus.MustNewConstMetric(o.desc, prometheus.CounterValue, float64(overshoot.count), key.node, key.namespace, key.name)
+	}
+}
@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("pod", true, false, newPodFamily)
+}
+
+// Reasons of the pods summed into OthersPodName, see podFamily.others.
+const (
+	othersTopN         = "top_n"
+	othersMinUsedBytes = "min_used_bytes"
+)
+
+type podFamily struct {
+	opts    Options
+	metrics []*ephemeralStorageMetric
+	descs   []*prometheus.Desc
+	// others is the number of pods currently summed into OthersPodName by reason, nil without
+	// Options.TopNPerNode and Options.MinUsedBytes.
+	others *prometheus.Desc
+}
+
+func newPodFamily(opts Options) family {
+	f := &podFamily{
+		opts: opts,
+		metrics: []*ephemeralStorageMetric{
+			{
+				name:      "ephemeral_storage_pod_used_bytes",
+				help:      "Used bytes to expose Ephemeral Storage metrics for pod",
+				valueType: prometheus.GaugeValue,
+				getValue: func(stat *provider.PodStat) float64 {
+					return float64(stat.UsedBytes)
+				},
+			},
+			{
+				name:      "ephemeral_storage_pod_available_bytes",
+				help:      "Available bytes of pod ephemeral storage",
+				valueType: prometheus.GaugeValue,
+				getValue: func(stat *provider.PodStat) float64 {
+					return float64(stat.AvailableBytes)
+				},
+				capacity: true,
+				max:      true,
+			},
+			{
+				name:      "ephemeral_storage_pod_capacity_bytes",
+				help:      "Capacity bytes of pod ephemeral storage",
+				valueType: prometheus.GaugeValue,
+				getValue: func(stat *provider.PodStat) float64 {
+					return float64(stat.CapacityBytes)
+				},
+				capacity: true,
+				max:      true,
+			},
+		},
+	}
+	if opts.MaxGrowth {
+		f.metrics = append(f.metrics, &ephemeralStorageMetric{
+			name:      "ephemeral_storage_pod_max_growth_bytes",
+			help:      "Max growth of used bytes between two consecutive kubelet summaries within the growth window",
+			valueType: prometheus.GaugeValue,
+			getValue: func(stat *provider.PodStat) float64 {
+				return float64(stat.MaxGrowthBytes)
+			},
+			max: true,
+		})
+	}
+	if opts.PeakUsage {
+		f.metrics = append(f.metrics, &ephemeralStorageMetric{
+			name:      "ephemeral_storage_pod_peak_used_bytes",
+			help:      "Max used bytes of pod ephemeral storage observed since the pod or the exporter started",
+			valueType: prometheus.GaugeValue,
+			getValue: func(stat *provider.PodStat) float64 {
+				return float64(stat.PeakUsedBytes)
+			},
+			max: true,
+		})
+	}
+	for _, metric := range f.metrics {
+		f.descs = append(f.descs, metric.desc(podLabelNames(opts)))
+	}
+	if opts.TopNPerNode > 0 || opts.MinUsedBytes > 0 {
+		f.others = prometheus.NewDesc(prometheus.BuildFQName(namespace, "others", "pods"),
+			"Number of pods summed into the series with pod_name=\"others\" instead of their own, by reason",
+			[]string{"node_name", "reason"}, nil)
+	}
+	return f
+}
+
+func (f *podFamily) describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range f.descs {
+		ch <- desc
+	}
+	if f.others != nil {
+		ch <- f.others
+	}
+}
+
+func (f *podFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		podStats, others, belowMin := podSeries(snapshot.Pods, f.opts)
+		if f.others != nil {
+			ch <- prometheus.MustNewConstMetric(f.others, prometheus.GaugeValue, float64(len(others)-belowMin), snapshot.Node.NodeName, othersTopN)
+			ch <- prometheus.MustNewConstMetric(f.others, prometheus.GaugeValue, float64(belowMin), snapshot.Node.NodeName, othersMinUsedBytes)
+		}
+		for i, metric := range f.metrics {
+			desc := f.descs[i]
+			skipZero := metric.capacity && f.opts.SkipZeroCapacity
+			for j := range podStats {
+				stat := &podStats[j]
+				if skipZero && stat.CapacityBytes == 0 {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(desc, metric.valueType, metric.getValue(stat), podLabelValues(f.opts, stat)...)
+			}
+			if value, ok := foldOthers(metric, others, skipZero); ok {
+				ch <- prometheus.MustNewConstMetric(desc, metric.valueType, value, podLabelValues(f.opts, &provider.PodStat{NodeName: snapshot.Node.NodeName, PodName: OthersPodName})...)
+			}
+		}
+	}
+}
+
+// foldOthers returns the value of metric for the pods summed into OthersPodName: the sum of the pods, or the
+// largest for the metrics marked max. ok is false without pods, or with skipZero when none reports a capacity.
+func foldOthers(metric *ephemeralStorageMetric, others []provider.PodStat, skipZero bool) (value float64, ok bool) {
+	for i := range others {
+		stat := &others[i]
+		if skipZero && stat.CapacityBytes == 0 {
+			continue
+		}
+		v := metric.getValue(stat)
+		switch {
+		case !ok:
+			value = v
+		case metric.max:
+			if v > value {
+				value = v
+			}
+		default:
+			value += v
+		}
+		ok = true
+	}
+	return value, ok
+}
+
+// podSeries splits the stats of a node into the pods with their own series and the others, summed into
+// OthersPodName: the pods below Options.MinUsedBytes, then those beyond the Options.TopNPerNode largest of the rest.
+// belowMin is the number of the others below Options.MinUsedBytes.
+func podSeries(podStats []provider.PodStat, opts Options) (kept, others []provider.PodStat, belowMin int) {
+	kept = podStats
+	if opts.MinUsedBytes > 0 {
+		kept = make([]provider.PodStat, 0, len(podStats))
+		for i := range podStats {
+			if podStats[i].UsedBytes < opts.MinUsedBytes {
+				others = append(others, podStats[i])
+			} else {
+				kept = append(kept, podStats[i])
+			}
+		}
+	}
+	belowMin = len(others)
+	kept, rest := topPods(kept, opts.TopNPerNode)
+	return kept, append(others, rest...), belowMin
+}
+
+// topPods splits the stats of a node into the n largest pods and the rest, see Options.TopNPerNode.
+func topPods(podStats []provider.PodStat, n int) ([]provider.PodStat, []provider.PodStat) {
+	if n <= 0 || len(podStats) <= n {
+		return podStats, nil
+	}
+
+	// Snapshots are shared, so sorting happens on a copy.
+	sorted := make([]provider.PodStat, len(podStats))
+	copy(sorted, podStats)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].UsedBytes > sorted[j].UsedBytes
+	})
+	return sorted[:n], sorted[n:]
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// familyCollector collects a family from fixed snapshots.
+type familyCollector struct {
+	family    family
+	snapshots []*provider.Snapshot
+}
+
+func (c familyCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.family.describe(ch)
+}
+
+func (c familyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.family.collect(ch, c.snapshots)
+}
+
+func podNames(stats []provider.PodStat) []string {
+	names := []string{}
+	for i := range stats {
+		names = append(names, stats[i].PodName)
+	}
+	return names
+}
+
+func TestPodSeries(t *testing.T) {
+	pods := []provider.PodStat{
+		{PodName: "a", UsedBytes: 30},
+		{PodName: "b", UsedBytes: 5},
+		{PodName: "c", UsedBytes: 20},
+		{PodName: "d", UsedBytes: 10},
+	}
+	tests := []struct {
+		name         string
+		opts         Options
+		wantKept     []string
+		wantOthers   []string
+		wantBelowMin int
+	}{
+		{
+			name:       "disabled",
+			wantKept:   []string{"a", "b", "c", "d"},
+			wantOthers: []string{},
+		},
+		{
+			name:       "top n",
+			opts:       Options{TopNPerNode: 2},
+			wantKept:   []string{"a", "c"},
+			wantOthers: []string{"d", "b"},
+		},
+		{
+			name:       "top n above the pods",
+			opts:       Options{TopNPerNode: 4},
+			wantKept:   []string{"a", "b", "c", "d"},
+			wantOthers: []string{},
+		},
+		{
+			name:         "min used bytes",
+			opts:         Options{MinUsedBytes: 10},
+			wantKept:     []string{"a", "c", "d"},
+			wantOthers:   []string{"b"},
+			wantBelowMin: 1,
+		},
+		{
+			name:         "both",
+			opts:         Options{TopNPerNode: 1, MinUsedBytes: 10},
+			wantKept:     []string{"a"},
+			wantOthers:   []string{"b", "c", "d"},
+			wantBelowMin: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, others, belowMin := podSeries(pods, tt.opts)
+			if got := podNames(kept); !reflect.DeepEqual(got, tt.wantKept) {
+				t.Errorf("kept = %v, want %v", got, tt.wantKept)
+			}
+			if got := podNames(others); !reflect.DeepEqual(got, tt.wantOthers) {
+				t.Errorf("others = %v, want %v", got, tt.wantOthers)
+			}
+			if belowMin != tt.wantBelowMin {
+				t.Errorf("belowMin = %d, want %d", belowMin, tt.wantBelowMin)
+			}
+		})
+	}
+	if got := podNames(pods); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("podSeries reordered the shared stats: %v", got)
+	}
+}
+
+func TestPodFamilyOthers(t *testing.T) {
+	snapshots := []*provider.Snapshot{{
+		Node: provider.NodeStatus{NodeName: "node-1"},
+		Pods: []provider.PodStat{
+			{NodeName: "node-1", Namespace: "ns", PodName: "a", UsedBytes: 30, AvailableBytes: 100, CapacityBytes: 200, MaxGrowthBytes: 5},
+			{NodeName: "node-1", Namespace: "ns", PodName: "b", UsedBytes: 10, AvailableBytes: 100, CapacityBytes: 200, MaxGrowthBytes: 7},
+			{NodeName: "node-1", Namespace: "ns", PodName: "c", UsedBytes: 20, AvailableBytes: 100, CapacityBytes: 200, MaxGrowthBytes: 3},
+			{NodeName: "node-1", Namespace: "ns", PodName: "d", UsedBytes: 1},
+		},
+	}}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "used bytes are summed, the others folded with the max",
+			opts: Options{TopNPerNode: 1, MaxGrowth: true},
+			want: `
+# HELP ephemeral_storage_pod_used_bytes Used bytes to expose Ephemeral Storage metrics for pod
+# TYPE ephemeral_storage_pod_used_bytes gauge
+ephemeral_storage_pod_used_bytes{namespace_name="",node_name="node-1",pod_name="others"} 31
+ephemeral_storage_pod_used_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 30
+# HELP ephemeral_storage_pod_available_bytes Available bytes of pod ephemeral storage
+# TYPE ephemeral_storage_pod_available_bytes gauge
+ephemeral_storage_pod_available_bytes{namespace_name="",node_name="node-1",pod_name="others"} 100
+ephemeral_storage_pod_available_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 100
+# HELP ephemeral_storage_pod_capacity_bytes Capacity bytes of pod ephemeral storage
+# TYPE ephemeral_storage_pod_capacity_bytes gauge
+ephemeral_storage_pod_capacity_bytes{namespace_name="",node_name="node-1",pod_name="others"} 200
+ephemeral_storage_pod_capacity_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 200
+# HELP ephemeral_storage_pod_max_growth_bytes Max growth of used bytes between two consecutive kubelet summaries within the growth window
+# TYPE ephemeral_storage_pod_max_growth_bytes gauge
+ephemeral_storage_pod_max_growth_bytes{namespace_name="",node_name="node-1",pod_name="others"} 7
+ephemeral_storage_pod_max_growth_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 5
+# HELP ephemeral_storage_others_pods Number of pods summed into the series with pod_name="others" instead of their own, by reason
+# TYPE ephemeral_storage_others_pods gauge
+ephemeral_storage_others_pods{node_name="node-1",reason="min_used_bytes"} 0
+ephemeral_storage_others_pods{node_name="node-1",reason="top_n"} 3
+`,
+		},
+		{
+			name: "pods without capacity are skipped",
+			opts: Options{MinUsedBytes: 15, SkipZeroCapacity: true},
+			want: `
+# HELP ephemeral_storage_pod_used_bytes Used bytes to expose Ephemeral Storage metrics for pod
+# TYPE ephemeral_storage_pod_used_bytes gauge
+ephemeral_storage_pod_used_bytes{namespace_name="",node_name="node-1",pod_name="others"} 11
+ephemeral_storage_pod_used_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 30
+ephemeral_storage_pod_used_bytes{namespace_name="ns",node_name="node-1",pod_name="c"} 20
+# HELP ephemeral_storage_pod_available_bytes Available bytes of pod ephemeral storage
+# TYPE ephemeral_storage_pod_available_bytes gauge
+ephemeral_storage_pod_available_bytes{namespace_name="",node_name="node-1",pod_name="others"} 100
+ephemeral_storage_pod_available_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 100
+ephemeral_storage_pod_available_bytes{namespace_name="ns",node_name="node-1",pod_name="c"} 100
+# HELP ephemeral_storage_pod_capacity_bytes Capacity bytes of pod ephemeral storage
+# TYPE ephemeral_storage_pod_capacity_bytes gauge
+ephemeral_storage_pod_capacity_bytes{namespace_name="",node_name="node-1",pod_name="others"} 200
+ephemeral_storage_pod_capacity_bytes{namespace_name="ns",node_name="node-1",pod_name="a"} 200
+ephemeral_storage_pod_capacity_bytes{namespace_name="ns",node_name="node-1",pod_name="c"} 200
+# HELP ephemeral_storage_others_pods Number of pods summed into the series with pod_name="others" instead of their own, by reason
+# TYPE ephemeral_storage_others_pods gauge
+ephemeral_storage_others_pods{node_name="node-1",reason="min_used_bytes"} 2
+ephemeral_storage_others_pods{node_name="node-1",reason="top_n"} 0
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := familyCollector{family: newPodFamily(tt.opts), snapshots: snapshots}
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPodFamiliesKeepTopN(t *testing.T) {
+	snapshots := []*provider.Snapshot{{
+		Node: provider.NodeStatus{NodeName: "node-1"},
+		Pods: []provider.PodStat{
+			{NodeName: "node-1", Namespace: "ns", PodName: "a", UsedBytes: 30, InodesUsed: 3, Containers: []provider.ContainerStat{{Name: "app", RootfsUsedBytes: 10}}},
+			{NodeName: "node-1", Namespace: "ns", PodName: "b", UsedBytes: 10, InodesUsed: 1, Containers: []provider.ContainerStat{{Name: "app", RootfsUsedBytes: 5}}},
+			{NodeName: "node-1", Namespace: "ns", PodName: "c", UsedBytes: 20, InodesUsed: 2, Containers: []provider.ContainerStat{{Name: "app", RootfsUsedBytes: 8}}},
+		},
+	}}
+	opts := Options{TopNPerNode: 1}
+	tests := []struct {
+		name   string
+		family family
+		metric string
+		want   string
+	}{
+		{
+			name:   "container",
+			family: newContainerFamily(opts),
+			metric: "ephemeral_storage_container_rootfs_used_bytes",
+			want: `
+# HELP ephemeral_storage_container_rootfs_used_bytes Used bytes of the container writable layer
+# TYPE ephemeral_storage_container_rootfs_used_bytes gauge
+ephemeral_storage_container_rootfs_used_bytes{container_name="app",namespace_name="ns",node_name="node-1",pod_name="a"} 10
+`,
+		},
+		{
+			name:   "inodes",
+			family: newInodesFamily(opts),
+			metric: "ephemeral_storage_pod_inodes_used",
+			want: `
+# HELP ephemeral_storage_pod_inodes_used Used inodes of pod ephemeral storage
+# TYPE ephemeral_storage_pod_inodes_used gauge
+ephemeral_storage_pod_inodes_used{namespace_name="",node_name="node-1",pod_name="others"} 3
+ephemeral_storage_pod_inodes_used{namespace_name="ns",node_name="node-1",pod_name="a"} 3
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := familyCollector{family: tt.family, snapshots: snapshots}
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want), tt.metric); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("podinfo", false, true, newPodInfoFamily)
+}
+
+// podInfoFamily exports the static attributes of every pod with its own series, and the labels of Options.Decorators, as an
+// info metric, so that they are stored once instead of on every value series, see Options.LeanPodLabels.
+type podInfoFamily struct {
+	opts       Options
+	reader     client.Reader
+	decorators []provider.Decorator
+	desc       *prometheus.Desc
+}
+
+func newPodInfoFamily(opts Options) family {
+	labels := []string{"namespace_name", "pod_name", "node_name", "uid", "workload_kind", "workload_name", "qos_class", "priority_class"}
+	return &podInfoFamily{
+		opts:       opts,
+		reader:     opts.Pods,
+		decorators: opts.Decorators,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "info"),
+			"Static attributes of the pod, always 1",
+			append(labels, provider.DecoratorLabelNames(opts.Decorators)...), nil,
+		),
+	}
+}
+
+func (f *podInfoFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *podInfoFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	list := &corev1.PodList{}
+	if err := f.reader.List(ctx, list); err != nil {
+		klog.ErrorS(err, "Failed to list pods")
+		return
+	}
+	pods := make(map[string]*corev1.Pod, len(list.Items))
+	for i := range list.Items {
+		pods[string(list.Items[i].UID)] = &list.Items[i]
+	}
+
+	for _, snapshot := range snapshots {
+		podStats, _, _ := podSeries(snapshot.Pods, f.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			var qosClass, priorityClass string
+			if pod, ok := pods[stat.UID]; ok {
+				qosClass = string(pod.Status.QOSClass)
+				priorityClass = pod.Spec.PriorityClassName
+			}
+			values := []string{stat.Namespace, stat.PodName, stat.NodeName, stat.UID, stat.WorkloadKind, stat.WorkloadName, qosClass, priorityClass}
+			ch <- prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, 1, appendDecorations(values, f.decorators, stat)...)
+		}
+	}
+}
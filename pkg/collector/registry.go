@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// family is a group of metrics that can be enabled with --collector.<name>.
+type family interface {
+	describe(ch chan<- *prometheus.Desc)
+	collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot)
+}
+
+type familyFactory struct {
+	defaultEnabled bool
+	// needsPods is set for families reading pod objects through Options.Pods.
+	needsPods bool
+	new       func(opts Options) family
+}
+
+var factories = map[string]familyFactory{}
+
+func registerFamily(name string, defaultEnabled, needsPods bool, new func(opts Options) family) {
+	factories[name] = familyFactory{defaultEnabled: defaultEnabled, needsPods: needsPods, new: new}
+}
+
+// FamilyNames returns the sorted names of all collector families.
+func FamilyNames() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Selection tells which collector families are enabled, by name.
+type Selection map[string]bool
+
+// DefaultSelection returns the families enabled by default.
+func DefaultSelection() Selection {
+	s := Selection{}
+	for name, factory := range factories {
+		s[name] = factory.defaultEnabled
+	}
+	return s
+}
+
+// RegisterFlags registers a --collector.<name> flag per family on fs.
+func (s Selection) RegisterFlags(fs *flag.FlagSet) {
+	for _, name := range FamilyNames() {
+		fs.Var(selectionFlag{s: s, name: name}, "collector."+name, fmt.Sprintf("Enable the %s collector.", name))
+	}
+}
+
+// NeedsPods reports whether an enabled family reads pod objects.
+func (s Selection) NeedsPods() bool {
+	for name, enabled := range s {
+		if enabled && factories[name].needsPods {
+			return true
+		}
+	}
+	return false
+}
+
+// Only returns the enabled families of names, e.g. of a query. Every name must be enabled in s.
+func (s Selection) Only(names []string) (Selection, error) {
+	only := Selection{}
+	for _, name := range names {
+		if _, ok := factories[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		if !s[name] {
+			return nil, fmt.Errorf("collector %q is not enabled", name)
+		}
+		only[name] = true
+	}
+	return only, nil
+}
+
+type selectionFlag struct {
+	s    Selection
+	name string
+}
+
+func (f selectionFlag) String() string {
+	return strconv.FormatBool(f.s[f.name])
+}
+
+func (f selectionFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.s[f.name] = enabled
+	return nil
+}
+
+func (f selectionFlag) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// UsageResets counts the sharp drops of the used bytes of every pod, by whether a container of the pod restarted
+// since the previous summary. A drop without restart is usually a cleanup by the workload, a drop with a restart
+// is the writable layer of a crashed container that was lost with it.
+type UsageResets struct {
+	pods provider.PodLookup
+	drop float64
+	desc *prometheus.Desc
+
+	lock   sync.Mutex
+	resets map[string]*podResets
+}
+
+type podResets struct {
+	key      podKey
+	used     uint64
+	restarts int32
+	// withRestart and withoutRestart are the drops with and without a restart.
+	withRestart, withoutRestart uint64
+}
+
+var (
+	_ prometheus.Collector = &UsageResets{}
+	_ provider.Observer    = &UsageResets{}
+)
+
+// NewUsageResets returns a counter of the drops of the used bytes of the pods looked up in pods by at least drop,
+// a fraction of the previous used bytes, e.g. 0.5.
+func NewUsageResets(pods provider.PodLookup, drop float64) *UsageResets {
+	return &UsageResets{
+		pods:   pods,
+		drop:   drop,
+		resets: map[string]*podResets{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "usage_reset_total"),
+			"Number of sharp drops of the used bytes of pod ephemeral storage between two stat summaries, by restart: whether a container of the pod restarted in between",
+			[]string{"node_name", "namespace_name", "pod_name", "restart"}, nil,
+		),
+	}
+}
+
+// Observe implements provider.Observer. Pods are tracked by UID, pods missing in the stats are removed. Pods missing
+// in the lookup, e.g. while the informer cache lags, keep their last state until they are found again.
+func (r *UsageResets) Observe(stats []provider.PodStat) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	seen := make(map[string]*podResets, len(stats))
+	for i := range stats {
+		stat := &stats[i]
+		pod, ok := r.pods.Pod(context.Background(), stat.Namespace, stat.PodName)
+		if !ok || string(pod.UID) != stat.UID {
+			if resets, ok := r.resets[stat.UID]; ok {
+				seen[stat.UID] = resets
+			}
+			continue
+		}
+		restarts := restartCount(pod)
+		resets, ok := r.resets[stat.UID]
+		if !ok {
+			resets = &podResets{key: podKey{stat.NodeName, stat.Namespace, stat.PodName}}
+		} else if float64(stat.UsedBytes) <= float64(resets.used)*(1-r.drop) && stat.UsedBytes < resets.used {
+			if restarts > resets.restarts {
+				resets.withRestart++
+			} else {
+				resets.withoutRestart++
+			}
+		}
+		resets.used, resets.restarts = stat.UsedBytes, restarts
+		seen[stat.UID] = resets
+	}
+	r.resets = seen
+}
+
+// restartCount returns the sum of the restart counts of the containers of pod.
+func restartCount(pod *corev1.Pod) int32 {
+	var count int32
+	for _, status := range pod.Status.ContainerStatuses {
+		count += status.RestartCount
+	}
+	return count
+}
+
+// Describe implements prometheus.Collector.
+func (r *UsageResets) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.desc
+}
+
+// Collect implements prometheus.Collector.
+func (r *UsageResets) Collect(ch chan<- prometheus.Metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, resets := range r.resets {
+		key := resets.key
+		ch <- prometheus.MustNewConstMetric(r.desc, prometheus.CounterValue, float64(resets.withRestart), key.node, key.namespace, key.name, "true")
+		ch <- prometheus.MustNewConstMetric(r.desc, prometheus.CounterValue, float64(resets.withoutRestart), key.node, key.namespace, key.name, "false")
+	}
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("source", false, false, newSourceFamily)
+}
+
+// Sources of the used bytes of a pod.
+const (
+	SourceRootfs   = "rootfs"
+	SourceLogs     = "logs"
+	SourceEmptyDir = "emptydir"
+)
+
+// sourceFamily exports the used bytes of every pod by where they live: the writable layers of its containers, their
+// logs or its node-local volumes. Full writable layers are fixed in the image or the app, logs by rotation and
+// volumes by the workload cleaning up, so the split tells what to do. It requires provider.Options.KeepContainers
+// and provider.Options.KeepVolumes.
+type sourceFamily struct {
+	opts Options
+	used *prometheus.Desc
+}
+
+func newSourceFamily(opts Options) family {
+	return &sourceFamily{
+		opts: opts,
+		used: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "used_bytes_by_source"),
+			"Used bytes of pod ephemeral storage by source: rootfs for the writable layers of the containers, logs "+
+				"for their logs and emptydir for the volumes on the node filesystem",
+			append(podLabelNames(opts), "source"), nil,
+		),
+	}
+}
+
+func (f *sourceFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.used
+}
+
+func (f *sourceFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		podStats, others, _ := podSeries(snapshot.Pods, f.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			f.collectSources(ch, podLabelValues(f.opts, stat), podSources(stat, [3]uint64{}))
+		}
+		if len(others) == 0 {
+			continue
+		}
+		var sum [3]uint64
+		for i := range others {
+			sum = podSources(&others[i], sum)
+		}
+		f.collectSources(ch, podLabelValues(f.opts, &provider.PodStat{NodeName: snapshot.Node.NodeName, PodName: OthersPodName}), sum)
+	}
+}
+
+func (f *sourceFamily) collectSources(ch chan<- prometheus.Metric, labels []string, sources [3]uint64) {
+	for i, source := range []string{SourceRootfs, SourceLogs, SourceEmptyDir} {
+		ch <- prometheus.MustNewConstMetric(f.used, prometheus.GaugeValue, float64(sources[i]), append(labels, source)...)
+	}
+}
+
+// podSources adds the rootfs, logs and emptydir bytes of stat to sum. Volumes backed by a claim, generic ephemeral
+// ones included, are not on the node filesystem and are skipped; configMap, secret and downward API volumes are
+// counted as emptydir, like the kubelet does.
+func podSources(stat *provider.PodStat, sum [3]uint64) [3]uint64 {
+	for _, container := range stat.Containers {
+		sum[0] += container.RootfsUsedBytes
+		sum[1] += container.LogsUsedBytes
+	}
+	for _, volume := range stat.Volumes {
+		if volume.PVCName == "" && !volume.GenericEphemeral {
+			sum[2] += volume.UsedBytes
+		}
+	}
+	return sum
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// SparseGatherer re-exposes gauges and counters whose value did not change beyond a relative delta with the value and
+// timestamp of their last change. Prometheus drops samples it already has, so unchanged series are neither stored
+// again nor remote-written. Series are exposed with their current timestamp at least every heartbeat, which must
+// be shorter than the 5m lookback of queries, so that they do not go stale.
+//
+// Every exposed gauge and counter has a timestamp, so Prometheus does not mark series that disappear as stale;
+// they vanish from queries after the lookback instead. The state is shared by all scrapers, so a single Prometheus
+// should scrape the exporter.
+type SparseGatherer struct {
+	gatherer  prometheus.Gatherer
+	delta     float64
+	heartbeat time.Duration
+
+	lock   sync.Mutex
+	series map[string]sample
+}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+var _ prometheus.Gatherer = &SparseGatherer{}
+
+// NewSparseGatherer returns a sparse gatherer of g. A value changed if it differs from the last exposed one by more
+// than delta times its absolute value, so a delta of 0 exposes every change.
+func NewSparseGatherer(g prometheus.Gatherer, delta float64, heartbeat time.Duration) *SparseGatherer {
+	return &SparseGatherer{
+		gatherer:  g,
+		delta:     delta,
+		heartbeat: heartbeat,
+		series:    map[string]sample{},
+	}
+}
+
+// Gather implements prometheus.Gatherer.
+func (s *SparseGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := s.gatherer.Gather()
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seen := make(map[string]sample, len(s.series))
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_GAUGE && family.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, metric := range family.Metric {
+			value := metric.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_COUNTER {
+				value = metric.GetCounter().GetValue()
+			}
+			key := seriesKey(family.GetName(), metric.Label)
+			last, ok := s.series[key]
+			if !ok || s.changed(last.value, value) || now.Sub(last.time) >= s.heartbeat {
+				last = sample{value: value, time: now}
+			}
+			seen[key] = last
+			setSample(family.GetType(), metric, last)
+		}
+	}
+	s.series = seen
+	return families, err
+}
+
+func (s *SparseGatherer) changed(last, value float64) bool {
+	if math.IsNaN(last) || math.IsNaN(value) {
+		return math.IsNaN(last) != math.IsNaN(value)
+	}
+	return math.Abs(value-last) > s.delta*math.Abs(last)
+}
+
+// setSample replaces the value and timestamp of metric. Gathered metrics are not shared, so they can be modified.
+func setSample(t dto.MetricType, metric *dto.Metric, last sample) {
+	if t == dto.MetricType_COUNTER {
+		metric.Counter.Value = proto.Float64(last.value)
+	} else {
+		metric.Gauge.Value = proto.Float64(last.value)
+	}
+	metric.TimestampMs = proto.Int64(last.time.UnixMilli())
+}
+
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, label := range labels {
+		b.WriteByte(0xff)
+		b.WriteString(label.GetName())
+		b.WriteByte(0xff)
+		b.WriteString(label.GetValue())
+	}
+	return b.String()
+}
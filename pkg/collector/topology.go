@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// TopologyAggregates exports the ephemeral storage of the nodes of a cluster summed by zone and instance type, for
+// capacity planning dashboards that would otherwise join node series with the node labels of kube-state-metrics.
+type TopologyAggregates struct {
+	cluster  *provider.ClusterManager
+	skipZero bool
+	nodes    *prometheus.Desc
+	used     *prometheus.Desc
+	capacity *prometheus.Desc
+	pods     *prometheus.Desc
+}
+
+var _ prometheus.Collector = &TopologyAggregates{}
+
+type topologyTotals struct {
+	nodes                int
+	used, capacity, pods uint64
+}
+
+// NewTopologyAggregates returns aggregates of the nodes of cluster that have stats. With skipZeroCapacity, nodes
+// whose node filesystem reports a capacity of 0 are left out, see Options.SkipZeroCapacity.
+func NewTopologyAggregates(cluster *provider.ClusterManager, skipZeroCapacity bool) *TopologyAggregates {
+	labels := []string{"zone", "instance_type"}
+	return &TopologyAggregates{
+		cluster:  cluster,
+		skipZero: skipZeroCapacity,
+		nodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "topology", "nodes"),
+			"Number of nodes with stats in the zone of the instance type",
+			labels, nil,
+		),
+		used: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "topology", "node_fs_used_bytes"),
+			"Sum of the used bytes of the node filesystems of the nodes in the zone of the instance type",
+			labels, nil,
+		),
+		capacity: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "topology", "node_fs_capacity_bytes"),
+			"Sum of the capacity bytes of the node filesystems of the nodes in the zone of the instance type",
+			labels, nil,
+		),
+		pods: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "topology", "pods_used_bytes"),
+			"Sum of the used bytes of the ephemeral storage of the pods of the nodes in the zone of the instance type",
+			labels, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *TopologyAggregates) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.nodes
+	ch <- t.used
+	ch <- t.capacity
+	ch <- t.pods
+}
+
+// Collect implements prometheus.Collector.
+func (t *TopologyAggregates) Collect(ch chan<- prometheus.Metric) {
+	totals := map[provider.Topology]*topologyTotals{}
+	for _, snapshot := range t.cluster.Snapshots() {
+		// Nodes whose kubelet never responded have no stats to sum.
+		if snapshot.NodeFs == nil || (t.skipZero && snapshot.NodeFs.CapacityBytes == 0) {
+			continue
+		}
+		topology := t.cluster.Topology(snapshot.Node.NodeName)
+		total, ok := totals[topology]
+		if !ok {
+			total = &topologyTotals{}
+			totals[topology] = total
+		}
+		total.nodes++
+		total.used += snapshot.NodeFs.UsedBytes
+		total.capacity += snapshot.NodeFs.CapacityBytes
+		for i := range snapshot.Pods {
+			total.pods += snapshot.Pods[i].UsedBytes
+		}
+	}
+	for topology, total := range totals {
+		ch <- prometheus.MustNewConstMetric(t.nodes, prometheus.GaugeValue, float64(total.nodes), topology.Zone, topology.InstanceType)
+		ch <- prometheus.MustNewConstMetric(t.used, prometheus.GaugeValue, float64(total.used), topology.Zone, topology.InstanceType)
+		ch <- prometheus.MustNewConstMetric(t.capacity, prometheus.GaugeValue, float64(total.capacity), topology.Zone, topology.InstanceType)
+		ch <- prometheus.MustNewConstMetric(t.pods, prometheus.GaugeValue, float64(total.pods), topology.Zone, topology.InstanceType)
+	}
+}
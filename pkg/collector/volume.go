@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+func init() {
+	registerFamily("volume", false, false, newVolumeFamily)
+}
+
+// volumeFamily exports the usage of pod volumes. It requires provider.Options.KeepVolumes.
+type volumeFamily struct {
+	opts Options
+	used *prometheus.Desc
+}
+
+func newVolumeFamily(opts Options) family {
+	return &volumeFamily{
+		opts: opts,
+		used: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pod", "volume_used_bytes"),
+			"Used bytes of a pod volume. pvc_name is set for volumes backed by a persistent volume claim, "+
+				"generic_ephemeral is true for generic ephemeral volumes, which are not on the node filesystem",
+			append(podLabelNames(opts), "volume_name", "pvc_name", "generic_ephemeral"), nil,
+		),
+	}
+}
+
+func (f *volumeFamily) describe(ch chan<- *prometheus.Desc) {
+	ch <- f.used
+}
+
+func (f *volumeFamily) collect(ch chan<- prometheus.Metric, snapshots []*provider.Snapshot) {
+	for _, snapshot := range snapshots {
+		podStats, _, _ := podSeries(snapshot.Pods, f.opts)
+		for i := range podStats {
+			stat := &podStats[i]
+			for _, volume := range stat.Volumes {
+				labels := append(podLabelValues(f.opts, stat), volume.Name, volume.PVCName, strconv.FormatBool(volume.GenericEphemeral))
+				ch <- prometheus.MustNewConstMetric(f.used, prometheus.GaugeValue, float64(volume.UsedBytes), labels...)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// WorkloadSummaries maintains streaming quantiles of pod used bytes per workload, so that large
+// ReplicaSets can be observed without per-pod series. Pods without a controller are not summarized.
+type WorkloadSummaries struct {
+	maxAge    time.Duration
+	summaries *prometheus.SummaryVec
+	lastSeen  map[workloadKey]time.Time
+}
+
+type workloadKey struct {
+	namespace, kind, name string
+}
+
+var (
+	_ prometheus.Collector = &WorkloadSummaries{}
+	_ provider.Observer    = &WorkloadSummaries{}
+)
+
+// NewWorkloadSummaries returns summaries whose quantiles cover observations of the last maxAge.
+func NewWorkloadSummaries(maxAge time.Duration) *WorkloadSummaries {
+	return &WorkloadSummaries{
+		maxAge:   maxAge,
+		lastSeen: map[workloadKey]time.Time{},
+		summaries: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:  namespace,
+			Name:       "workload_pod_used_bytes",
+			Help:       "Quantiles of used bytes of the pods of a workload",
+			Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.01, 0.99: 0.001},
+			MaxAge:     maxAge,
+		}, []string{"namespace_name", "workload_kind", "workload_name"}),
+	}
+}
+
+// Observe implements provider.Observer.
+// Summaries of workloads without pods for maxAge are removed.
+func (w *WorkloadSummaries) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	for _, stat := range stats {
+		if stat.WorkloadKind == "" {
+			continue
+		}
+		w.summaries.WithLabelValues(stat.Namespace, stat.WorkloadKind, stat.WorkloadName).Observe(float64(stat.UsedBytes))
+		w.lastSeen[workloadKey{stat.Namespace, stat.WorkloadKind, stat.WorkloadName}] = now
+	}
+	for key, seen := range w.lastSeen {
+		if now.Sub(seen) > w.maxAge {
+			w.summaries.DeleteLabelValues(key.namespace, key.kind, key.name)
+			delete(w.lastSeen, key)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (w *WorkloadSummaries) Describe(ch chan<- *prometheus.Desc) {
+	w.summaries.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (w *WorkloadSummaries) Collect(ch chan<- prometheus.Metric) {
+	w.summaries.Collect(ch)
+}
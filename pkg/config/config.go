@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+)
+
+// Config is the content of the file given with -config. Flags configure everything that fits on a command line;
+// the file holds the settings that do not.
+type Config struct {
+	// Metrics renames the exported metrics.
+	Metrics collector.Naming `json:"metrics"`
+	// NamespaceLabels are the keys of the namespace labels exported by ephemeral_storage_namespace_info,
+	// e.g. team or cost-center.
+	NamespaceLabels []string `json:"namespaceLabels,omitempty"`
+	// Cost prices ephemeral storage for ephemeral_storage_pod_estimated_cost_per_hour.
+	Cost Cost `json:"cost,omitempty"`
+	// Derived are pod metrics computed from expressions over the stats of the pod, e.g. used / capacity.
+	Derived []collector.DerivedMetric `json:"derived,omitempty"`
+	// MaintenanceWindows are the recurring time ranges during which no events are recorded.
+	MaintenanceWindows MaintenanceWindows `json:"maintenanceWindows,omitempty"`
+}
+
+// Load reads and validates the config file at path.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate returns the first invalid setting.
+func (c *Config) Validate() error {
+	if err := c.Metrics.Validate(); err != nil {
+		return fmt.Errorf("metrics: %v", err)
+	}
+	seen := map[string]string{}
+	for _, key := range c.NamespaceLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("namespaceLabels: %q is not a label key: %s", key, strings.Join(errs, ", "))
+		}
+		name := collector.NamespaceLabelName(key)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("namespaceLabels: %q and %q both map to the label %s", other, key, name)
+		}
+		seen[name] = key
+	}
+	if err := c.Cost.validate(); err != nil {
+		return fmt.Errorf("cost: %v", err)
+	}
+	if err := collector.ValidateDerived(c.Derived); err != nil {
+		return fmt.Errorf("derived: %v", err)
+	}
+	if err := c.MaintenanceWindows.compile(); err != nil {
+		return fmt.Errorf("maintenanceWindows: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+)
+
+// Cost prices the ephemeral storage of nodes. Pods of nodes without a price are not exported.
+type Cost struct {
+	// PricePerGiBHour is the price of nodes without a price in Prices.
+	PricePerGiBHour float64 `json:"pricePerGiBHour,omitempty"`
+	// NodeLabel is the key of the node label, e.g. node.kubernetes.io/instance-type, whose value selects the
+	// price of a node in Prices.
+	NodeLabel string `json:"nodeLabel,omitempty"`
+	// Prices are prices per GiB-hour by value of NodeLabel.
+	Prices map[string]float64 `json:"prices,omitempty"`
+}
+
+// Enabled reports whether any node has a price.
+func (c Cost) Enabled() bool {
+	return c.PricePerGiBHour > 0 || len(c.Prices) > 0
+}
+
+func (c Cost) validate() error {
+	if c.PricePerGiBHour < 0 {
+		return fmt.Errorf("pricePerGiBHour must not be negative, got %v", c.PricePerGiBHour)
+	}
+	if len(c.Prices) > 0 && c.NodeLabel == "" {
+		return errors.New("prices need a nodeLabel")
+	}
+	for value, price := range c.Prices {
+		if price < 0 {
+			return fmt.Errorf("price of %s must not be negative, got %v", value, price)
+		}
+	}
+	return nil
+}
+
+// PriceFunc returns the price of nodes. Nodes are read from reader if NodeLabel is set.
+func (c Cost) PriceFunc(reader client.Reader) collector.PriceFunc {
+	if c.NodeLabel == "" {
+		return func(string) (float64, bool) {
+			return c.PricePerGiBHour, c.PricePerGiBHour > 0
+		}
+	}
+	return func(name string) (float64, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		node := &corev1.Node{}
+		if err := reader.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+			klog.V(1).Infof("Using the default price, failed to get node %s: %v", name, err)
+		} else if price, ok := c.Prices[node.Labels[c.NodeLabel]]; ok {
+			return price, true
+		}
+		return c.PricePerGiBHour, c.PricePerGiBHour > 0
+	}
+}
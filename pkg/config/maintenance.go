@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// maxMaintenanceDuration bounds windows, which are matched by walking back their duration minute by minute.
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+// MaintenanceWindow is a recurring time range, e.g. of planned batch jobs that legitimately fill scratch disks,
+// during which no events are recorded. Metrics are still exported.
+type MaintenanceWindow struct {
+	// Schedule is the start of the window in cron notation: minute, hour, day of month, month and day of week,
+	// e.g. "0 2 * * 6" for Saturdays at 02:00.
+	Schedule string `json:"schedule"`
+	// Duration is the length of the window, e.g. 4h.
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone of Schedule, e.g. Europe/Berlin. UTC if empty.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	schedule *cronSchedule
+	location *time.Location
+}
+
+// MaintenanceWindows are the maintenance windows of the config file.
+type MaintenanceWindows []MaintenanceWindow
+
+// compile parses the schedule and time zone of every window.
+func (ws MaintenanceWindows) compile() error {
+	for i := range ws {
+		w := &ws[i]
+		schedule, err := parseCron(w.Schedule)
+		if err != nil {
+			return fmt.Errorf("schedule %q: %v", w.Schedule, err)
+		}
+		if w.Duration.Duration < time.Minute || w.Duration.Duration > maxMaintenanceDuration {
+			return fmt.Errorf("duration of %q must be between 1m and %v, got %v", w.Schedule, maxMaintenanceDuration, w.Duration.Duration)
+		}
+		location, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return fmt.Errorf("timeZone of %q: %v", w.Schedule, err)
+		}
+		w.schedule, w.location = schedule, location
+	}
+	return nil
+}
+
+// Active reports whether t is within any window.
+func (ws MaintenanceWindows) Active(t time.Time) bool {
+	for _, w := range ws {
+		if w.schedule == nil {
+			continue
+		}
+		local := t.In(w.location)
+		for start := local.Truncate(time.Minute); local.Sub(start) < w.Duration.Duration; start = start.Add(-time.Minute) {
+			if w.schedule.matches(start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ActiveGauge returns ephemeral_storage_maintenance_window_active, 1 while a window is active, so that alerts on the
+// exported metrics can be inhibited during the windows as well.
+func (ws MaintenanceWindows) ActiveGauge() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "maintenance_window_active",
+		Help:      "1 while a maintenance window of the config file is active, during which no events are recorded",
+	}, func() float64 {
+		if ws.Active(time.Now()) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Recorder returns a recorder dropping the events of recorder during the windows.
+func (ws MaintenanceWindows) Recorder(recorder record.EventRecorder) record.EventRecorder {
+	if len(ws) == 0 {
+		return recorder
+	}
+	return &maintenanceRecorder{EventRecorder: recorder, windows: ws}
+}
+
+type maintenanceRecorder struct {
+	record.EventRecorder
+	windows MaintenanceWindows
+}
+
+func (r *maintenanceRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if !r.windows.Active(time.Now()) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *maintenanceRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !r.windows.Active(time.Now()) {
+		r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *maintenanceRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !r.windows.Active(time.Now()) {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// cronSchedule holds the matching values of the fields of a cron expression.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday are set for a * day of month or day of week. Like cron, a time matches either
+	// restricted field if both are restricted.
+	anyDay, anyWeekday bool
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// parseCron parses the five fields of a cron expression. Fields are *, values, ranges and steps, e.g. 1-5 or */15,
+// separated by commas. Day of week 7 is Sunday like 0.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	s := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	for _, f := range []struct {
+		name     string
+		field    string
+		min, max int
+		values   *map[int]bool
+	}{
+		{"minute", fields[0], 0, 59, &s.minutes},
+		{"hour", fields[1], 0, 23, &s.hours},
+		{"day of month", fields[2], 1, 31, &s.days},
+		{"month", fields[3], 1, 12, &s.months},
+		{"day of week", fields[4], 0, 7, &s.weekdays},
+	} {
+		values, err := parseCronField(f.field, f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		*f.values = values
+	}
+	if s.weekdays[7] {
+		s.weekdays[0] = true
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// History retains the pod stats of a node for a duration, so that usage can be compared with a past point in time.
+type History struct {
+	retention time.Duration
+
+	lock    sync.RWMutex
+	entries []entry
+}
+
+type entry struct {
+	time time.Time
+	pods []provider.PodStat
+}
+
+var _ provider.Observer = &History{}
+
+// NewHistory returns a history retaining pod stats for the given duration.
+func NewHistory(retention time.Duration) *History {
+	return &History{retention: retention}
+}
+
+// Observe implements provider.Observer. The stats are retained as is since they are never modified.
+func (h *History) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	drop := 0
+	for drop < len(h.entries) && now.Sub(h.entries[drop].time) > h.retention {
+		drop++
+	}
+	h.entries = append(h.entries[drop:], entry{time: now, pods: stats})
+}
+
+// Diff is the change of pod used bytes between two retained stats of a node.
+type Diff struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Grown and Shrunk are sorted by descending absolute change. Pods that appeared grew from 0 and pods that
+	// disappeared shrank to 0.
+	Grown  []Change `json:"grown"`
+	Shrunk []Change `json:"shrunk"`
+}
+
+// Change is the change of used bytes of a pod.
+type Change struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	FromBytes int64  `json:"fromBytes"`
+	ToBytes   int64  `json:"toBytes"`
+	// DeltaBytes is ToBytes - FromBytes.
+	DeltaBytes int64 `json:"deltaBytes"`
+}
+
+// Since compares the last retained stats with the last ones retained at or before since, or the oldest ones if
+// none is that old. At most limit pods are reported in each direction, all if limit is 0.
+// It reports false if no stats were retained yet.
+func (h *History) Since(since time.Time, limit int) (*Diff, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if len(h.entries) == 0 {
+		return nil, false
+	}
+	from := h.entries[0]
+	for _, e := range h.entries {
+		if e.time.After(since) {
+			break
+		}
+		from = e
+	}
+	to := h.entries[len(h.entries)-1]
+	return compare(from, to, limit), true
+}
+
+type podKey struct {
+	namespace, name string
+}
+
+func compare(from, to entry, limit int) *Diff {
+	before := make(map[podKey]int64, len(from.pods))
+	for i := range from.pods {
+		stat := &from.pods[i]
+		before[podKey{stat.Namespace, stat.PodName}] += int64(stat.UsedBytes)
+	}
+	after := make(map[podKey]int64, len(to.pods))
+	for i := range to.pods {
+		stat := &to.pods[i]
+		after[podKey{stat.Namespace, stat.PodName}] += int64(stat.UsedBytes)
+	}
+
+	d := &Diff{From: from.time, To: to.time, Grown: []Change{}, Shrunk: []Change{}}
+	add := func(key podKey, fromBytes, toBytes int64) {
+		c := Change{Namespace: key.namespace, Name: key.name, FromBytes: fromBytes, ToBytes: toBytes, DeltaBytes: toBytes - fromBytes}
+		switch {
+		case c.DeltaBytes > 0:
+			d.Grown = append(d.Grown, c)
+		case c.DeltaBytes < 0:
+			d.Shrunk = append(d.Shrunk, c)
+		}
+	}
+	for key, toBytes := range after {
+		add(key, before[key], toBytes)
+	}
+	for key, fromBytes := range before {
+		if _, ok := after[key]; !ok {
+			add(key, fromBytes, 0)
+		}
+	}
+
+	sortByChange(d.Grown)
+	sortByChange(d.Shrunk)
+	if limit > 0 {
+		if len(d.Grown) > limit {
+			d.Grown = d.Grown[:limit]
+		}
+		if len(d.Shrunk) > limit {
+			d.Shrunk = d.Shrunk[:limit]
+		}
+	}
+	return d
+}
+
+// sortByChange sorts changes by descending absolute delta, then by pod, so that the order is stable.
+func sortByChange(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := abs(changes[i].DeltaBytes), abs(changes[j].DeltaBytes)
+		if a != b {
+			return a > b
+		}
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
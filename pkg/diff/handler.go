@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultLimit is the number of pods reported in each direction if the request has no limit.
+const DefaultLimit = 10
+
+// Handler serves the change of pod usage retained by a History.
+//
+//	GET /debug/diff?from=-5m&limit=10&format=json|text
+//
+// from is the duration back from now to compare with, 5m if not set. The leading minus is optional.
+// format is json unless set to text, which is a table for kubectl port-forward and curl.
+type Handler struct {
+	history *History
+}
+
+func NewHandler(h *History) *Handler {
+	return &Handler{history: h}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	from := 5 * time.Minute
+	if v := query.Get("from"); v != "" {
+		d, err := time.ParseDuration(strings.TrimPrefix(v, "-"))
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("invalid from %q, expected a duration such as -5m", v), http.StatusBadRequest)
+			return
+		}
+		from = d
+	}
+	limit := DefaultLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "text" {
+		http.Error(w, fmt.Sprintf("invalid format %q, expected json or text", format), http.StatusBadRequest)
+		return
+	}
+
+	d, ok := h.history.Since(time.Now().Add(-from), limit)
+	if !ok {
+		http.Error(w, "no stats retained yet", http.StatusServiceUnavailable)
+		return
+	}
+	var err error
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = writeTable(w, d)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(d)
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to write snapshot diff")
+	}
+}
+
+func writeTable(w http.ResponseWriter, d *Diff) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FROM %s TO %s (%s)\n\n", d.From.Format(time.RFC3339), d.To.Format(time.RFC3339), d.To.Sub(d.From).Round(time.Second))
+	fmt.Fprintln(tw, "NAMESPACE\tPOD\tFROM BYTES\tTO BYTES\tDELTA BYTES")
+	for _, changes := range [][]Change{d.Grown, d.Shrunk} {
+		for _, c := range changes {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%+d\n", c.Namespace, c.Name, c.FromBytes, c.ToBytes, c.DeltaBytes)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,130 @@
+package eviction
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// SignalNodeFsAvailable is the kubelet eviction signal of the available bytes of the node filesystem, which
+// holds the ephemeral storage of pods.
+const SignalNodeFsAvailable = "nodefs.available"
+
+// DefaultThreshold is the kubelet default hard eviction threshold of SignalNodeFsAvailable.
+const DefaultThreshold = "10%"
+
+// Simulation is the outcome of a simulated nodefs eviction of a node.
+type Simulation struct {
+	Node      string `json:"node"`
+	Signal    string `json:"signal"`
+	Threshold string `json:"threshold"`
+	// ThresholdBytes is the threshold resolved against the capacity of the node filesystem.
+	ThresholdBytes int64 `json:"thresholdBytes"`
+	AvailableBytes int64 `json:"availableBytes"`
+	CapacityBytes  int64 `json:"capacityBytes"`
+	UnderPressure  bool  `json:"underPressure"`
+	// ReclaimBytes is the number of bytes to free until the signal is above the threshold again.
+	ReclaimBytes int64 `json:"reclaimBytes"`
+	// Pods are ranked in the order the kubelet would evict them.
+	Pods []Pod `json:"pods"`
+}
+
+// Pod is a ranked pod of a Simulation.
+type Pod struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	UsedBytes    int64  `json:"usedBytes"`
+	RequestBytes int64  `json:"requestBytes"`
+	Priority     int32  `json:"priority"`
+	// ExceedsRequest pods are evicted before any pod within its request.
+	ExceedsRequest bool `json:"exceedsRequest"`
+	// ExceedsLimit pods are evicted by the kubelet regardless of disk pressure.
+	ExceedsLimit bool `json:"exceedsLimit"`
+	// Evicted is set for the pods the kubelet would evict to reclaim Simulation.ReclaimBytes.
+	Evicted bool `json:"evicted"`
+}
+
+// Simulate ranks the pods of snapshot like the kubelet does under nodefs pressure: pods whose usage exceeds their
+// request first, then by ascending priority, then by descending usage above request. Pod objects are resolved with
+// pods; pods unknown to it are ranked without request and with priority 0.
+func Simulate(snapshot *provider.Snapshot, pods func(namespace, name string) (*corev1.Pod, bool), threshold string) (*Simulation, error) {
+	if snapshot.NodeFs == nil {
+		return nil, fmt.Errorf("stat summary of node %s has no node filesystem", snapshot.Node.NodeName)
+	}
+	capacity := int64(snapshot.NodeFs.CapacityBytes)
+	thresholdBytes, err := parseThreshold(threshold, capacity)
+	if err != nil {
+		return nil, err
+	}
+	sim := &Simulation{
+		Node:           snapshot.Node.NodeName,
+		Signal:         SignalNodeFsAvailable,
+		Threshold:      threshold,
+		ThresholdBytes: thresholdBytes,
+		AvailableBytes: int64(snapshot.NodeFs.AvailableBytes),
+		CapacityBytes:  capacity,
+	}
+	if sim.AvailableBytes < thresholdBytes {
+		sim.UnderPressure = true
+		sim.ReclaimBytes = thresholdBytes - sim.AvailableBytes
+	}
+
+	for i := range snapshot.Pods {
+		stat := &snapshot.Pods[i]
+		p := Pod{Namespace: stat.Namespace, Name: stat.PodName, UsedBytes: int64(stat.UsedBytes)}
+		if pod, ok := pods(stat.Namespace, stat.PodName); ok {
+			p.RequestBytes, _ = provider.EphemeralStorageRequest(pod)
+			if limit, ok := provider.EphemeralStorageLimit(pod); ok {
+				p.ExceedsLimit = p.UsedBytes > limit
+			}
+			if pod.Spec.Priority != nil {
+				p.Priority = *pod.Spec.Priority
+			}
+		}
+		p.ExceedsRequest = p.UsedBytes > p.RequestBytes
+		sim.Pods = append(sim.Pods, p)
+	}
+	sort.SliceStable(sim.Pods, func(i, j int) bool {
+		a, b := &sim.Pods[i], &sim.Pods[j]
+		if a.ExceedsRequest != b.ExceedsRequest {
+			return a.ExceedsRequest
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.UsedBytes-a.RequestBytes > b.UsedBytes-b.RequestBytes
+	})
+
+	// The kubelet evicts one pod at a time until the signal recovers, freeing the usage of the evicted pod.
+	reclaimed := int64(0)
+	for i := range sim.Pods {
+		if reclaimed >= sim.ReclaimBytes {
+			break
+		}
+		sim.Pods[i].Evicted = true
+		reclaimed += sim.Pods[i].UsedBytes
+	}
+	return sim, nil
+}
+
+// parseThreshold resolves a kubelet threshold, a percentage of capacity or a quantity, to bytes.
+func parseThreshold(threshold string, capacity int64) (int64, error) {
+	if strings.HasSuffix(threshold, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return 0, fmt.Errorf("invalid threshold percentage %q", threshold)
+		}
+		return int64(float64(capacity) * percentage / 100), nil
+	}
+	quantity, err := resource.ParseQuantity(threshold)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold %q: %v", threshold, err)
+	}
+	return quantity.Value(), nil
+}
@@ -0,0 +1,111 @@
+package eviction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Handler serves simulations of the most recent snapshots of a provider.
+//
+//	GET /api/v1/simulate-eviction?node=<node>&threshold=<threshold>
+//
+// node defaults to the only node of the provider. threshold overrides the nodefs.available hard eviction
+// threshold read from the kubelet configuration, e.g. 15% or 10Gi.
+type Handler struct {
+	provider provider.Provider
+	pods     provider.PodLookup
+	cli      kubernetes.Interface
+}
+
+func NewHandler(p provider.Provider, pods provider.PodLookup, cli kubernetes.Interface) *Handler {
+	return &Handler{provider: p, pods: pods, cli: cli}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	snapshot, err := h.snapshot(r.URL.Query().Get("node"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	threshold := r.URL.Query().Get("threshold")
+	if threshold == "" {
+		threshold = h.threshold(ctx, snapshot.Node.NodeName)
+	}
+	sim, err := Simulate(snapshot, func(namespace, name string) (*corev1.Pod, bool) {
+		return h.pods.Pod(ctx, namespace, name)
+	}, threshold)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sim); err != nil {
+		klog.ErrorS(err, "Failed to write eviction simulation")
+	}
+}
+
+func (h *Handler) snapshot(node string) (*provider.Snapshot, error) {
+	snapshots := h.provider.Snapshots()
+	if node == "" && len(snapshots) == 1 {
+		return snapshots[0], nil
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Node.NodeName == node {
+			return snapshot, nil
+		}
+	}
+	if node == "" {
+		return nil, fmt.Errorf("no stats of a single node, set the node parameter")
+	}
+	return nil, fmt.Errorf("no stats of node %s", node)
+}
+
+// threshold returns the nodefs.available hard eviction threshold from the configz endpoint of the kubelet, or
+// DefaultThreshold if it cannot be read.
+func (h *Handler) threshold(ctx context.Context, node string) string {
+	threshold, err := kubeletThreshold(ctx, h.cli, node)
+	if err != nil {
+		klog.V(1).Infof("Using default eviction threshold, %v", err)
+		return DefaultThreshold
+	}
+	return threshold
+}
+
+// kubeletThreshold returns the nodefs.available hard eviction threshold from the configz endpoint of the kubelet
+// of node, DefaultThreshold if the kubelet configuration does not set it.
+func kubeletThreshold(ctx context.Context, cli kubernetes.Interface, node string) (string, error) {
+	content, err := cli.CoreV1().RESTClient().Get().AbsPath(fmt.Sprintf("/api/v1/nodes/%s/proxy/configz", node)).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get kubelet configuration of node %s: %v", node, err)
+	}
+	configz := struct {
+		KubeletConfig struct {
+			EvictionHard map[string]string `json:"evictionHard"`
+		} `json:"kubeletconfig"`
+	}{}
+	if err := json.Unmarshal(content, &configz); err != nil {
+		return "", fmt.Errorf("failed to decode kubelet configuration of node %s: %v", node, err)
+	}
+	if threshold, ok := configz.KubeletConfig.EvictionHard[SignalNodeFsAvailable]; ok {
+		return threshold, nil
+	}
+	return DefaultThreshold, nil
+}
@@ -0,0 +1,178 @@
+package eviction
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// saturationRateWindow is the window over which the growth rate of the pods of a node is computed.
+const saturationRateWindow = 15 * time.Minute
+
+// Saturation exports a 0 to 1 saturation score of the node filesystem of every node, like the pressure stall
+// information of the kernel, so that SLO burn alerts need a single series instead of combining available bytes,
+// growth and eviction thresholds in PromQL. The score is the highest of:
+//
+//   - the used fraction of the bytes available to pods before the nodefs.available hard eviction threshold,
+//   - how close the growth rate of all pods of the node brings it to the threshold, 0 if it reaches it after
+//     the horizon or never, 1 if it reaches it now.
+//
+// It is 1 once the node is under pressure.
+type Saturation struct {
+	provider provider.Provider
+	cli      kubernetes.Interface
+	horizon  time.Duration
+	desc     *prometheus.Desc
+
+	lock       sync.Mutex
+	nodes      map[string]*nodeGrowth
+	thresholds map[string]string
+}
+
+// nodeGrowth are the samples of the used bytes of all pods of a node within saturationRateWindow.
+type nodeGrowth struct {
+	times []time.Time
+	bytes []uint64
+}
+
+var (
+	_ prometheus.Collector = &Saturation{}
+	_ provider.Observer    = &Saturation{}
+)
+
+// NewSaturation returns the saturation of the nodes of p, whose eviction thresholds are read with cli.
+func NewSaturation(p provider.Provider, cli kubernetes.Interface, horizon time.Duration) *Saturation {
+	return &Saturation{
+		provider:   p,
+		cli:        cli,
+		horizon:    horizon,
+		nodes:      map[string]*nodeGrowth{},
+		thresholds: map[string]string{},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("ephemeral_storage", "node", "saturation"),
+			"Saturation of the node filesystem from 0 to 1, combining available bytes, the growth of the pods and the eviction threshold, 1 under disk pressure",
+			[]string{"node_name"}, nil,
+		),
+	}
+}
+
+// Observe implements provider.Observer. Nodes missing in the stats are removed.
+func (s *Saturation) Observe(stats []provider.PodStat) {
+	now := time.Now()
+	totals := map[string]uint64{}
+	for i := range stats {
+		totals[stats[i].NodeName] += stats[i].UsedBytes
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seen := make(map[string]*nodeGrowth, len(totals))
+	for node, total := range totals {
+		growth, ok := s.nodes[node]
+		if !ok {
+			growth = &nodeGrowth{}
+		}
+		growth.add(now, total)
+		seen[node] = growth
+	}
+	s.nodes = seen
+}
+
+func (g *nodeGrowth) add(now time.Time, bytes uint64) {
+	drop := 0
+	for drop < len(g.times) && now.Sub(g.times[drop]) > saturationRateWindow {
+		drop++
+	}
+	g.times = append(g.times[:0], g.times[drop:]...)
+	g.bytes = append(g.bytes[:0], g.bytes[drop:]...)
+	g.times = append(g.times, now)
+	g.bytes = append(g.bytes, bytes)
+}
+
+// rate returns the growth in bytes per second over the samples, 0 with fewer than two samples.
+func (g *nodeGrowth) rate() float64 {
+	if g == nil || len(g.times) < 2 {
+		return 0
+	}
+	last := len(g.times) - 1
+	elapsed := g.times[last].Sub(g.times[0]).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (float64(g.bytes[last]) - float64(g.bytes[0])) / elapsed
+}
+
+// Describe implements prometheus.Collector.
+func (s *Saturation) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.desc
+}
+
+// Collect implements prometheus.Collector.
+func (s *Saturation) Collect(ch chan<- prometheus.Metric) {
+	for _, snapshot := range s.provider.Snapshots() {
+		if snapshot.NodeFs == nil || snapshot.NodeFs.CapacityBytes == 0 {
+			continue
+		}
+		node := snapshot.Node.NodeName
+		threshold := s.threshold(node)
+		thresholdBytes, err := parseThreshold(threshold, int64(snapshot.NodeFs.CapacityBytes))
+		if err != nil {
+			klog.ErrorS(err, "Failed to resolve eviction threshold", "node", node)
+			continue
+		}
+		s.lock.Lock()
+		rate := s.nodes[node].rate()
+		s.lock.Unlock()
+		ch <- prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, saturation(snapshot.NodeFs, thresholdBytes, rate, s.horizon), node)
+	}
+}
+
+// threshold returns the eviction threshold of node, read once from its kubelet. DefaultThreshold is used until it
+// is read.
+func (s *Saturation) threshold(node string) string {
+	s.lock.Lock()
+	threshold, ok := s.thresholds[node]
+	s.lock.Unlock()
+	if ok {
+		return threshold
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	threshold, err := kubeletThreshold(ctx, s.cli, node)
+	if err != nil {
+		klog.V(1).Infof("Using default eviction threshold for saturation, %v", err)
+		return DefaultThreshold
+	}
+	s.lock.Lock()
+	s.thresholds[node] = threshold
+	s.lock.Unlock()
+	return threshold
+}
+
+// saturation scores fs from 0 to 1 given its eviction threshold in bytes and the growth rate of its pods in
+// bytes per second.
+func saturation(fs *provider.FsUsage, thresholdBytes int64, rate float64, horizon time.Duration) float64 {
+	usable := float64(int64(fs.CapacityBytes) - thresholdBytes)
+	headroom := float64(int64(fs.AvailableBytes) - thresholdBytes)
+	if usable <= 0 || headroom <= 0 {
+		return 1
+	}
+	score := 1 - headroom/usable
+	if score < 0 {
+		score = 0
+	}
+	if rate > 0 {
+		if eta := headroom / rate; eta < horizon.Seconds() {
+			if urgency := 1 - eta/horizon.Seconds(); urgency > score {
+				score = urgency
+			}
+		}
+	}
+	return score
+}
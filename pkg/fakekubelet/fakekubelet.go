@@ -0,0 +1,205 @@
+package fakekubelet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+const (
+	DefaultNodeName = "fake-node"
+
+	summaryPath     = "/stats/summary"
+	nodeProxyPrefix = "/api/v1/nodes/"
+	nodeProxySuffix = "/proxy" + summaryPath
+
+	gib = 1 << 30
+	mib = 1 << 20
+)
+
+// Options controls the size and shape of the synthetic summary served by the fake kubelet.
+type Options struct {
+	// NodeName is reported in the summary and accepted in the api server proxy path.
+	NodeName string
+	// Pods is the number of pods in the summary.
+	Pods int
+	// ContainersPerPod is the number of containers reported per pod. Defaults to 1.
+	ContainersPerPod int
+	// VolumesPerPod is the number of volumes reported per pod.
+	VolumesPerPod int
+	// Namespaces is the number of namespaces pods are spread over. Defaults to 1.
+	Namespaces int
+}
+
+func (o Options) withDefaults() Options {
+	if o.NodeName == "" {
+		o.NodeName = DefaultNodeName
+	}
+	if o.ContainersPerPod <= 0 {
+		o.ContainersPerPod = 1
+	}
+	if o.Namespaces <= 0 {
+		o.Namespaces = 1
+	}
+	return o
+}
+
+// Server is a fake kubelet serving /stats/summary both directly and through the api server node proxy path,
+// so it can be used as the host of a rest.Config as well as a kubelet endpoint.
+type Server struct {
+	*httptest.Server
+
+	nodeName string
+	requests atomic.Int64
+
+	lock    sync.RWMutex
+	payload []byte
+	source  func() ([]byte, error)
+}
+
+// NewServer starts a fake kubelet serving a summary generated from opts.
+func NewServer(opts Options) *Server {
+	opts = opts.withDefaults()
+	s := &Server{nodeName: opts.NodeName}
+	s.SetSummary(GenerateSummary(opts))
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NodeName returns the node name the fake kubelet reports.
+func (s *Server) NodeName() string {
+	return s.nodeName
+}
+
+// Requests returns the number of summary requests served so far.
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// SetSummary replaces the summary served by the fake kubelet.
+func (s *Server) SetSummary(summary *stats.Summary) {
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		panic(fmt.Errorf("failed to marshal summary: %v", err))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.payload = payload
+}
+
+// SetPayloadSource makes the fake kubelet serve the payload source returns on each summary request instead of the
+// summary, e.g. to replay recorded payloads as is. Requests are answered with a 500 if it fails.
+func (s *Server) SetPayloadSource(source func() ([]byte, error)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.source = source
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != summaryPath && r.URL.Path != nodeProxyPrefix+s.nodeName+nodeProxySuffix {
+		if strings.HasPrefix(r.URL.Path, nodeProxyPrefix) {
+			http.Error(w, fmt.Sprintf("nodes %q not found", r.URL.Path), http.StatusNotFound)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	s.requests.Add(1)
+
+	s.lock.RLock()
+	payload, source := s.payload, s.source
+	s.lock.RUnlock()
+	if source != nil {
+		var err error
+		if payload, err = source(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(payload)
+}
+
+// GenerateSummary builds a deterministic synthetic summary. Usage values vary per pod so that
+// sorting and aggregation behave like they would on a real node.
+func GenerateSummary(opts Options) *stats.Summary {
+	opts = opts.withDefaults()
+	now := metav1.NewTime(time.Now())
+
+	summary := &stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  opts.NodeName,
+			StartTime: now,
+			Fs:        fsStats(now, 100*gib, uint64(opts.Pods)*mib),
+			Runtime: &stats.RuntimeStats{
+				ImageFs: fsStats(now, 100*gib, 10*gib),
+			},
+		},
+		Pods: make([]stats.PodStats, 0, opts.Pods),
+	}
+
+	for i := 0; i < opts.Pods; i++ {
+		podUsed := uint64(0)
+		pod := stats.PodStats{
+			PodRef: stats.PodReference{
+				Name:      fmt.Sprintf("pod-%d", i),
+				Namespace: fmt.Sprintf("namespace-%d", i%opts.Namespaces),
+				UID:       fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			},
+			StartTime:  now,
+			Containers: make([]stats.ContainerStats, 0, opts.ContainersPerPod),
+		}
+		for c := 0; c < opts.ContainersPerPod; c++ {
+			rootfs := uint64(i+c+1) * mib
+			logs := uint64(c+1) * 64 * 1024
+			podUsed += rootfs + logs
+			pod.Containers = append(pod.Containers, stats.ContainerStats{
+				Name:      fmt.Sprintf("container-%d", c),
+				StartTime: now,
+				Rootfs:    fsStats(now, 100*gib, rootfs),
+				Logs:      fsStats(now, 100*gib, logs),
+			})
+		}
+		for v := 0; v < opts.VolumesPerPod; v++ {
+			used := uint64(v+1) * mib
+			podUsed += used
+			pod.VolumeStats = append(pod.VolumeStats, stats.VolumeStats{
+				Name:    fmt.Sprintf("volume-%d", v),
+				FsStats: *fsStats(now, 100*gib, used),
+			})
+		}
+		pod.EphemeralStorage = fsStats(now, 100*gib, podUsed)
+		summary.Pods = append(summary.Pods, pod)
+	}
+	return summary
+}
+
+func fsStats(now metav1.Time, capacity, used uint64) *stats.FsStats {
+	available := capacity - used
+	inodes := capacity / 4096
+	inodesUsed := used / 4096
+	inodesFree := inodes - inodesUsed
+	return &stats.FsStats{
+		Time:           now,
+		AvailableBytes: &available,
+		CapacityBytes:  &capacity,
+		UsedBytes:      &used,
+		InodesFree:     &inodesFree,
+		Inodes:         &inodes,
+		InodesUsed:     &inodesUsed,
+	}
+}
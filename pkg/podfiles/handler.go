@@ -0,0 +1,78 @@
+package podfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultK is the number of files and directories reported if the request has no k.
+	DefaultK = 10
+	// walkTimeout bounds the walk of a pod with many files; the report is then truncated.
+	walkTimeout = 30 * time.Second
+)
+
+// Handler serves the largest files and directories of a pod of the node:
+//
+//	GET /api/v1/pods/<uid>/largest-files?k=10
+//
+// It is meant to be registered for /api/v1/pods/ behind web.WithBearerToken.
+type Handler struct {
+	hostRoot string
+}
+
+// NewHandler returns a handler walking the host filesystem mounted at hostRoot.
+func NewHandler(hostRoot string) *Handler {
+	return &Handler{hostRoot: hostRoot}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/pods/")
+	uid := strings.TrimSuffix(path, "/largest-files")
+	if uid == path || uid == "" || strings.Contains(uid, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	k := DefaultK
+	if v := r.URL.Query().Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid k %q", v), http.StatusBadRequest)
+			return
+		}
+		k = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), walkTimeout)
+	defer cancel()
+	report, err := Largest(ctx, h.hostRoot, uid, k)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrInvalidUID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		klog.ErrorS(err, "Failed to walk pod files", "uid", uid)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		klog.ErrorS(err, "Failed to write largest files")
+	}
+}
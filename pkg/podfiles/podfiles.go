@@ -0,0 +1,169 @@
+package podfiles
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// validUID matches pod UIDs, so that a UID cannot escape the pod directories.
+var validUID = regexp.MustCompile(`^[0-9a-fA-F-]+$`)
+
+// ErrInvalidUID is returned for UIDs that are not pod UIDs.
+var ErrInvalidUID = errors.New("invalid pod uid")
+
+// Entry is a file or a directory and its apparent size, including its content for directories.
+type Entry struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Report lists the largest files and directories of the ephemeral storage of a pod. Paths are host paths.
+type Report struct {
+	UID         string   `json:"uid"`
+	Roots       []string `json:"roots"`
+	Files       []Entry  `json:"files"`
+	Directories []Entry  `json:"directories"`
+	// Truncated is set if the walk was interrupted, e.g. by the request timeout; sizes are then partial.
+	Truncated bool `json:"truncated"`
+}
+
+// Roots returns the host directories of the ephemeral storage of the pod that are walked: its emptyDir volumes
+// and its logs. hostRoot is where the host filesystem is mounted. Container writable layers are managed by the
+// container runtime and are not included.
+func Roots(hostRoot, uid string) ([]string, error) {
+	if !validUID.MatchString(uid) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidUID, uid)
+	}
+	roots := []string{filepath.Join(hostRoot, "var/lib/kubelet/pods", uid, "volumes/kubernetes.io~empty-dir")}
+	logs, err := filepath.Glob(filepath.Join(hostRoot, "var/log/pods", "*_"+uid))
+	if err != nil {
+		return nil, err
+	}
+	return append(roots, logs...), nil
+}
+
+// Largest walks the ephemeral storage of the pod and returns its k largest files and directories. Symbolic links
+// are not followed. It returns os.ErrNotExist if the pod has no directory on the host.
+func Largest(ctx context.Context, hostRoot, uid string, k int) (*Report, error) {
+	roots, err := Roots(hostRoot, uid)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{UID: uid, Files: []Entry{}, Directories: []Entry{}}
+	files := &entryHeap{}
+	dirs := map[string]int64{}
+	for _, root := range roots {
+		if _, err := os.Lstat(root); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		report.Roots = append(report.Roots, hostPath(hostRoot, root))
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				// Files removed during the walk and unreadable directories are skipped.
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			size := info.Size()
+			files.push(Entry{Path: path, Bytes: size}, k)
+			// Every walked path is below root.
+			for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+				dirs[dir] += size
+				if dir == root || dir == filepath.Dir(dir) {
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			report.Truncated = true
+			break
+		}
+	}
+	if len(report.Roots) == 0 {
+		return nil, fmt.Errorf("no ephemeral storage of pod %s on this node: %w", uid, os.ErrNotExist)
+	}
+
+	report.Files = files.sorted()
+	for dir, size := range dirs {
+		report.Directories = append(report.Directories, Entry{Path: dir, Bytes: size})
+	}
+	sortEntries(report.Directories)
+	if k > 0 && len(report.Directories) > k {
+		report.Directories = report.Directories[:k]
+	}
+	for i := range report.Files {
+		report.Files[i].Path = hostPath(hostRoot, report.Files[i].Path)
+	}
+	for i := range report.Directories {
+		report.Directories[i].Path = hostPath(hostRoot, report.Directories[i].Path)
+	}
+	return report, nil
+}
+
+// hostPath returns path relative to the host filesystem.
+func hostPath(hostRoot, path string) string {
+	rel, err := filepath.Rel(hostRoot, path)
+	if err != nil {
+		return path
+	}
+	return "/" + rel
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// entryHeap is a min-heap by size that keeps the k largest entries.
+type entryHeap []Entry
+
+func (h entryHeap) Len() int            { return len(h) }
+func (h entryHeap) Less(i, j int) bool  { return h[i].Bytes < h[j].Bytes }
+func (h entryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) { *h = append(*h, x.(Entry)) }
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// push adds e, keeping only the k largest entries, all if k is 0.
+func (h *entryHeap) push(e Entry, k int) {
+	if k > 0 && h.Len() == k {
+		if (*h)[0].Bytes >= e.Bytes {
+			return
+		}
+		heap.Pop(h)
+	}
+	heap.Push(h, e)
+}
+
+func (h *entryHeap) sorted() []Entry {
+	entries := append([]Entry{}, *h...)
+	sortEntries(entries)
+	return entries
+}
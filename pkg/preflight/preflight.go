@@ -0,0 +1,138 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// PermissionsOK is 1 for each permission the last access review allowed, 0 if it was denied.
+var PermissionsOK = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "permissions_ok",
+	Help:      "1 if the access review at startup allowed the permission, 0 if it was denied",
+}, []string{"verb", "resource"})
+
+// ErrDenied is wrapped by the errors of permissions the access review denied.
+var ErrDenied = errors.New("denied")
+
+// Result is the outcome of a single check. Hint tells how to fix a failed check.
+type Result struct {
+	Name string
+	Err  error
+	Hint string
+}
+
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// Permission is an api server permission the exporter needs.
+type Permission struct {
+	Verb        string
+	Resource    string
+	Subresource string
+	// Name restricts the permission to an object, e.g. the scraped node.
+	Name string
+}
+
+func (p Permission) String() string {
+	resource := p.resource()
+	if p.Name != "" {
+		resource += " " + p.Name
+	}
+	return p.Verb + " " + resource
+}
+
+func (p Permission) resource() string {
+	if p.Subresource != "" {
+		return p.Resource + "/" + p.Subresource
+	}
+	return p.Resource
+}
+
+// RequiredPermissions returns the permissions needed to scrape node, through the api server node proxy or, if
+// direct is set, from the kubelet, and to watch pods if pods is set.
+func RequiredPermissions(node string, pods, direct bool) []Permission {
+	perms := []Permission{{Verb: "get", Resource: "nodes", Subresource: "proxy", Name: node}}
+	if direct {
+		// The kubelet authorizes stat summary requests on nodes/stats. The node is read for its addresses.
+		perms = []Permission{
+			{Verb: "get", Resource: "nodes", Name: node},
+			{Verb: "get", Resource: "nodes", Subresource: "stats", Name: node},
+		}
+	}
+	if pods {
+		perms = append(perms,
+			Permission{Verb: "list", Resource: "pods"},
+			Permission{Verb: "watch", Resource: "pods"},
+		)
+	}
+	return perms
+}
+
+// ClusterPermissions returns the permissions needed to scrape every node of a cluster.
+func ClusterPermissions() []Permission {
+	return []Permission{
+		{Verb: "list", Resource: "nodes"},
+		{Verb: "get", Resource: "nodes", Subresource: "proxy"},
+	}
+}
+
+// CheckAccess reviews each permission with a SelfSubjectAccessReview and records the outcome in PermissionsOK.
+func CheckAccess(ctx context.Context, cli kubernetes.Interface, perms []Permission) []Result {
+	results := make([]Result, 0, len(perms))
+	for _, perm := range perms {
+		result := Result{
+			Name: "permission " + perm.String(),
+			Hint: fmt.Sprintf("grant %q on %q to the service account of the exporter in its ClusterRole", perm.Verb, perm.Resource),
+		}
+		review, err := cli.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:        perm.Verb,
+					Resource:    perm.Resource,
+					Subresource: perm.Subresource,
+					Name:        perm.Name,
+				},
+			},
+		}, metav1.CreateOptions{})
+		switch {
+		case err != nil:
+			result.Err = fmt.Errorf("failed to review access: %v", err)
+		case !review.Status.Allowed:
+			result.Err = fmt.Errorf("%w: %s", ErrDenied, review.Status.Reason)
+			PermissionsOK.WithLabelValues(perm.Verb, perm.resource()).Set(0)
+		default:
+			PermissionsOK.WithLabelValues(perm.Verb, perm.resource()).Set(1)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// CheckKubelet fetches the stat summary of node once, like FetchSummary, and reports the source of its pod stats.
+func CheckKubelet(ctx context.Context, cli kubernetes.Interface, kubelet *provider.KubeletClient, node string) Result {
+	result := Result{
+		Name: "kubelet stat summary of node " + node,
+		Hint: "check that the node exists, its kubelet is running and the api server can reach it",
+	}
+	summary, err := FetchSummary(ctx, cli, kubelet, node)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	details := fmt.Sprintf("%d pods", len(summary.Pods))
+	if source := provider.DetectSource(summary, ""); source != "" {
+		details += ", " + source + " stats"
+	}
+	result.Name = fmt.Sprintf("%s (%s)", result.Name, details)
+	return result
+}
@@ -0,0 +1,127 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// FetchSummary fetches the stat summary of node once from kubelet, or through the api server node proxy if kubelet
+// is nil.
+func FetchSummary(ctx context.Context, cli kubernetes.Interface, kubelet *provider.KubeletClient, node string) (*stats.Summary, error) {
+	var content []byte
+	var err error
+	if kubelet != nil {
+		content, err = kubelet.Summary(ctx, node)
+	} else {
+		content, err = cli.CoreV1().RESTClient().Get().AbsPath(fmt.Sprintf("/api/v1/nodes/%s/proxy/stats/summary", node)).DoRaw(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	summary := &stats.Summary{}
+	if err := json.Unmarshal(content, summary); err != nil {
+		return nil, fmt.Errorf("failed to decode stat summary: %v", err)
+	}
+	return summary, nil
+}
+
+// Fields lists the fields of the stat summary the exporter reads that are missing in an object of the summary.
+// Fields are named by their JSON path below the object, e.g. "containers[app].logs.usedBytes".
+type Fields struct {
+	// Object is "node" or "pod <namespace>/<name>".
+	Object  string
+	Missing []string
+	// Skipped is set if the exporter exports no stats of a pod because of the missing fields.
+	Skipped bool
+}
+
+// ValidateSummary returns the missing fields of the node and of every pod of summary, in the order of the summary.
+// The ephemeral-storage field of a pod is not required if source is provider.SourceContainers and the pod has
+// container stats to compute it from.
+func ValidateSummary(summary *stats.Summary, source string) []Fields {
+	node := Fields{Object: "node"}
+	node.Missing = append(node.Missing, missingFs("fs", summary.Node.Fs, true)...)
+	if summary.Node.Runtime == nil {
+		node.Missing = append(node.Missing, "runtime")
+	} else {
+		node.Missing = append(node.Missing, missingFs("runtime.imageFs", summary.Node.Runtime.ImageFs, true)...)
+	}
+	results := []Fields{node}
+
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		fields := Fields{Object: fmt.Sprintf("pod %s/%s", pod.PodRef.Namespace, pod.PodRef.Name)}
+		if pod.PodRef.UID == "" {
+			fields.Missing = append(fields.Missing, "podRef.uid")
+		}
+		if pod.EphemeralStorage == nil {
+			fields.Missing = append(fields.Missing, "ephemeral-storage")
+			fields.Skipped = source != provider.SourceContainers || len(pod.Containers) == 0
+		} else {
+			fields.Missing = append(fields.Missing, missingFs("ephemeral-storage", pod.EphemeralStorage, false)...)
+		}
+		if len(pod.Containers) == 0 {
+			fields.Missing = append(fields.Missing, "containers")
+		}
+		for _, container := range pod.Containers {
+			prefix := fmt.Sprintf("containers[%s]", container.Name)
+			if container.Rootfs == nil {
+				fields.Missing = append(fields.Missing, prefix+".rootfs")
+			} else {
+				if container.Rootfs.UsedBytes == nil {
+					fields.Missing = append(fields.Missing, prefix+".rootfs.usedBytes")
+				}
+				if container.Rootfs.InodesUsed == nil {
+					fields.Missing = append(fields.Missing, prefix+".rootfs.inodesUsed")
+				}
+			}
+			if container.Logs == nil {
+				fields.Missing = append(fields.Missing, prefix+".logs")
+			} else if container.Logs.UsedBytes == nil {
+				fields.Missing = append(fields.Missing, prefix+".logs.usedBytes")
+			}
+		}
+		for _, volume := range pod.VolumeStats {
+			prefix := fmt.Sprintf("volume[%s]", volume.Name)
+			if volume.UsedBytes == nil {
+				fields.Missing = append(fields.Missing, prefix+".usedBytes")
+			}
+			if volume.InodesUsed == nil {
+				fields.Missing = append(fields.Missing, prefix+".inodesUsed")
+			}
+		}
+		results = append(results, fields)
+	}
+	return results
+}
+
+// missingFs returns the missing fields of fs named after prefix. Total inodes are only read from node filesystems.
+func missingFs(prefix string, fs *stats.FsStats, node bool) []string {
+	if fs == nil {
+		return []string{prefix}
+	}
+	var missing []string
+	for _, field := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"usedBytes", fs.UsedBytes},
+		{"availableBytes", fs.AvailableBytes},
+		{"capacityBytes", fs.CapacityBytes},
+		{"inodesUsed", fs.InodesUsed},
+	} {
+		if field.value == nil {
+			missing = append(missing, prefix+"."+field.name)
+		}
+	}
+	if node && fs.Inodes == nil {
+		missing = append(missing, prefix+".inodes")
+	}
+	return missing
+}
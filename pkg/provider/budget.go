@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"time"
+)
+
+// SuccessWindow is the window of NodeStatus.SuccessRatio.
+const SuccessWindow = 5 * time.Minute
+
+// outcomes are the times and results of the stat summary requests of a node within SuccessWindow.
+type outcomes struct {
+	times []time.Time
+	ok    []bool
+}
+
+func (o *outcomes) add(now time.Time, ok bool) {
+	drop := 0
+	for drop < len(o.times) && now.Sub(o.times[drop]) > SuccessWindow {
+		drop++
+	}
+	o.times = append(o.times[:0], o.times[drop:]...)
+	o.ok = append(o.ok[:0], o.ok[drop:]...)
+	o.times = append(o.times, now)
+	o.ok = append(o.ok, ok)
+}
+
+// ratio returns the fraction of successful requests, 1 without requests.
+func (o *outcomes) ratio() float64 {
+	if len(o.ok) == 0 {
+		return 1
+	}
+	succeeded := 0
+	for _, ok := range o.ok {
+		if ok {
+			succeeded++
+		}
+	}
+	return float64(succeeded) / float64(len(o.ok))
+}
+
+// budgetBackoff returns the interval after the failures-th consecutive failed request while the error budget is
+// exhausted: interval doubled per failure, capped at SuccessWindow.
+func budgetBackoff(interval time.Duration, failures int) time.Duration {
+	backoff := interval
+	for i := 1; i < failures && backoff < SuccessWindow; i++ {
+		backoff *= 2
+	}
+	if backoff > SuccessWindow {
+		return SuccessWindow
+	}
+	return backoff
+}
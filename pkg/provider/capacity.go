@@ -0,0 +1,30 @@
+package provider
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ZeroCapacityReports counts the filesystems reported with a capacity of 0 in stat summaries, by the fs they belong
+// to: node, image or pod. Some container runtimes briefly report 0 while a filesystem is being set up.
+var ZeroCapacityReports = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "zero_capacity_reports_total",
+	Help:      "Number of filesystems reported with a capacity of 0 in stat summaries, by fs: node, image or pod",
+}, []string{"fs"})
+
+// countZeroCapacity counts the filesystems of snapshot that report a capacity of 0 in ZeroCapacityReports.
+func countZeroCapacity(snapshot *Snapshot) {
+	if snapshot.NodeFs != nil && snapshot.NodeFs.CapacityBytes == 0 {
+		ZeroCapacityReports.WithLabelValues("node").Inc()
+	}
+	if snapshot.ImageFs != nil && snapshot.ImageFs.CapacityBytes == 0 {
+		ZeroCapacityReports.WithLabelValues("image").Inc()
+	}
+	pods := 0
+	for i := range snapshot.Pods {
+		if snapshot.Pods[i].CapacityBytes == 0 {
+			pods++
+		}
+	}
+	if pods > 0 {
+		ZeroCapacityReports.WithLabelValues("pod").Add(float64(pods))
+	}
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrChaos is the error of the stat summary requests failed by Chaos.
+var ErrChaos = errors.New("stat summary request failed by fault injection")
+
+// Spike is an increase of the used bytes injected by Chaos until Until.
+type Spike struct {
+	// Namespace and Pod are the pod whose used bytes are increased, the node filesystem if empty.
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Bytes     uint64    `json:"bytes"`
+	Until     time.Time `json:"until"`
+}
+
+// ChaosState are the faults Chaos injects.
+type ChaosState struct {
+	// FailUntil is the end of the failed requests, nil if requests are not failed.
+	FailUntil *time.Time `json:"failUntil,omitempty"`
+	Spikes    []Spike    `json:"spikes"`
+}
+
+// Chaos injects faults into the managers it is set in, failed stat summary requests and spikes of used bytes, so
+// that alert rules and runbooks are tested end to end in staging. Every fault expires, so that a forgotten one does
+// not page forever.
+type Chaos struct {
+	lock      sync.Mutex
+	failUntil time.Time
+	spikes    []Spike
+}
+
+func NewChaos() *Chaos {
+	return &Chaos{}
+}
+
+// FailUntil fails the stat summary requests until t.
+func (c *Chaos) FailUntil(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failUntil = t
+}
+
+// AddSpike adds the bytes of spike to the used bytes of its pod, or of the node filesystem, until it expires.
+func (c *Chaos) AddSpike(spike Spike) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.spikes = append(c.spikes, spike)
+}
+
+// Reset removes every fault.
+func (c *Chaos) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failUntil, c.spikes = time.Time{}, nil
+}
+
+// State returns the faults that have not expired at now.
+func (c *Chaos) State(now time.Time) ChaosState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := ChaosState{Spikes: []Spike{}}
+	if now.Before(c.failUntil) {
+		failUntil := c.failUntil
+		state.FailUntil = &failUntil
+	}
+	c.expire(now)
+	state.Spikes = append(state.Spikes, c.spikes...)
+	return state
+}
+
+// Active reports whether a fault is injected at now.
+func (c *Chaos) Active(now time.Time) bool {
+	state := c.State(now)
+	return state.FailUntil != nil || len(state.Spikes) > 0
+}
+
+// expire drops the spikes that expired at now. It is called with lock held.
+func (c *Chaos) expire(now time.Time) {
+	spikes := c.spikes[:0]
+	for _, spike := range c.spikes {
+		if now.Before(spike.Until) {
+			spikes = append(spikes, spike)
+		}
+	}
+	c.spikes = spikes
+}
+
+// failure returns ErrChaos if the requests are failed at now.
+func (c *Chaos) failure(now time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now.Before(c.failUntil) {
+		return ErrChaos
+	}
+	return nil
+}
+
+// spiked returns the bytes added at now to the pod namespace/pod, or to the node filesystem if pod is empty.
+func (c *Chaos) spiked(namespace, pod string, now time.Time) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire(now)
+	var bytes uint64
+	for _, spike := range c.spikes {
+		if spike.Namespace == namespace && spike.Pod == pod {
+			bytes += spike.Bytes
+		}
+	}
+	return bytes
+}
+
+// spikePod adds the spikes of the pod of stat to its used bytes, taken from its available bytes.
+func (c *Chaos) spikePod(stat *PodStat, now time.Time) {
+	if bytes := c.spiked(stat.Namespace, stat.PodName, now); bytes > 0 {
+		stat.UsedBytes += bytes
+		stat.AvailableBytes = subtract(stat.AvailableBytes, bytes)
+	}
+}
+
+// spikeNode adds the spikes of the node filesystem to its used bytes, taken from its available bytes.
+func (c *Chaos) spikeNode(fs *FsUsage, now time.Time) {
+	if bytes := c.spiked("", "", now); bytes > 0 {
+		fs.UsedBytes += bytes
+		fs.AvailableBytes = subtract(fs.AvailableBytes, bytes)
+	}
+}
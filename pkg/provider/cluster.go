@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// clusterConcurrency bounds the stat summary requests a ClusterManager has in flight.
+const clusterConcurrency = 16
+
+// ClusterManager periodically fetches the stat summaries of every node of a cluster. It is used where the
+// exporter cannot run on each node, e.g. to aggregate remote clusters from a central one.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type ClusterManager struct {
+	cli  kubernetes.Interface
+	opts Options
+
+	lock     sync.RWMutex
+	nodes    map[string]*Manager
+	topology map[string]Topology
+}
+
+// Topology is where a node of a cluster runs, from its well-known labels. Fields are empty if the node does not
+// have the labels.
+type Topology struct {
+	Zone         string
+	InstanceType string
+}
+
+// topologyOf returns the topology of node, falling back to the deprecated beta labels.
+func topologyOf(node *corev1.Node) Topology {
+	label := func(key, beta string) string {
+		if value, ok := node.Labels[key]; ok {
+			return value
+		}
+		return node.Labels[beta]
+	}
+	return Topology{
+		Zone:         label(corev1.LabelTopologyZone, corev1.LabelFailureDomainBetaZone),
+		InstanceType: label(corev1.LabelInstanceTypeStable, corev1.LabelInstanceType),
+	}
+}
+
+var _ Provider = &ClusterManager{}
+
+// NewClusterManager returns a manager for all nodes of the cluster of cli. Options.NodeName is ignored.
+func NewClusterManager(cli kubernetes.Interface, opts Options) *ClusterManager {
+	return &ClusterManager{
+		cli:      cli,
+		opts:     opts,
+		nodes:    map[string]*Manager{},
+		topology: map[string]Topology{},
+	}
+}
+
+// Start runs the collection loop until ctx is done.
+func (c *ClusterManager) Start(ctx context.Context) error {
+	if c.opts.WatchdogIntervals > 0 {
+		watch(ctx, time.Duration(c.opts.WatchdogIntervals)*c.opts.Interval, c.run)
+		return nil
+	}
+	c.run(ctx, func() {})
+	return nil
+}
+
+// run is the collection loop of Start. It calls beat after every cycle.
+func (c *ClusterManager) run(ctx context.Context, beat func()) {
+	timer := time.NewTimer(0 * time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		// A loop restarted by the watchdog may see its timer fire along with the cancellation.
+		if ctx.Err() != nil {
+			return
+		}
+		start := time.Now()
+		c.Update(ctx)
+		beat()
+		duration := time.Since(start)
+		klog.V(3).Infof("Taking time to get cluster stat summaries duration:%v", duration)
+
+		timer.Reset(c.opts.Interval - duration)
+	}
+}
+
+// Update lists the nodes of the cluster and fetches their stat summaries once. Nodes that were removed from
+// the cluster are forgotten. If listing fails, the known nodes are fetched.
+func (c *ClusterManager) Update(ctx context.Context) {
+	nodes, err := c.cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to list nodes")
+	} else {
+		c.lock.Lock()
+		known := make(map[string]*Manager, len(nodes.Items))
+		topology := make(map[string]Topology, len(nodes.Items))
+		for i := range nodes.Items {
+			node := &nodes.Items[i]
+			topology[node.Name] = topologyOf(node)
+			m, ok := c.nodes[node.Name]
+			if !ok {
+				opts := c.opts
+				opts.NodeName = node.Name
+				m = NewManager(c.cli, opts)
+			}
+			known[node.Name] = m
+		}
+		c.nodes = known
+		c.topology = topology
+		c.lock.Unlock()
+	}
+
+	c.lock.RLock()
+	managers := make([]*Manager, 0, len(c.nodes))
+	for _, m := range c.nodes {
+		managers = append(managers, m)
+	}
+	c.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, clusterConcurrency)
+	now := time.Now()
+	for _, m := range managers {
+		if !m.due(now) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m *Manager) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.Update(ctx)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// Nodes returns the names of the nodes of the cluster as of the last listing, sorted. Nodes that were not
+// fetched yet have no snapshot.
+func (c *ClusterManager) Nodes() []string {
+	c.lock.RLock()
+	nodes := make([]string, 0, len(c.nodes))
+	for node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	c.lock.RUnlock()
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Node returns the manager of the node name, if the node was listed.
+func (c *ClusterManager) Node(name string) (*Manager, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	m, ok := c.nodes[name]
+	return m, ok
+}
+
+// Topology returns the topology of node as of the last listing.
+func (c *ClusterManager) Topology(node string) Topology {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.topology[node]
+}
+
+// Snapshots implements Provider. Snapshots are sorted by node name.
+func (c *ClusterManager) Snapshots() []*Snapshot {
+	c.lock.RLock()
+	snapshots := make([]*Snapshot, 0, len(c.nodes))
+	for _, m := range c.nodes {
+		if snapshot := m.Snapshot(); snapshot != nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	c.lock.RUnlock()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Node.NodeName < snapshots[j].Node.NodeName
+	})
+	return snapshots
+}
@@ -0,0 +1,51 @@
+package provider
+
+import corev1 "k8s.io/api/core/v1"
+
+// Decorator attaches extra labels to the series of pods from their pod objects, e.g. the CMDB ID or cost center
+// of an organization, so that forks and embedders do not need to patch the collectors.
+type Decorator interface {
+	// LabelNames returns the names of the labels. They must not change and not collide with the labels of the
+	// exporter.
+	LabelNames() []string
+	// LabelValues returns the values of the labels for pod, in the order of LabelNames. Missing values are empty.
+	LabelValues(pod *corev1.Pod) []string
+}
+
+var decorators []Decorator
+
+// RegisterDecorator registers a decorator applied by the exporter, usually from an init function of a package
+// imported by a fork. It must be called before flags are parsed. Embedders set Options.Decorators instead.
+func RegisterDecorator(d Decorator) {
+	decorators = append(decorators, d)
+}
+
+// Decorators returns the registered decorators, in the order of registration.
+func Decorators() []Decorator {
+	return decorators
+}
+
+// DecoratorLabelNames returns the label names of ds, in order.
+func DecoratorLabelNames(ds []Decorator) []string {
+	var names []string
+	for _, d := range ds {
+		names = append(names, d.LabelNames()...)
+	}
+	return names
+}
+
+// decorate returns the label values of ds for pod, padded or truncated to the label names of every decorator.
+func decorate(ds []Decorator, pod *corev1.Pod) []string {
+	var values []string
+	for _, d := range ds {
+		names, v := d.LabelNames(), d.LabelValues(pod)
+		for i := range names {
+			value := ""
+			if i < len(v) {
+				value = v[i]
+			}
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,27 @@
+package provider
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Reasons of SeriesDropped.
+const (
+	DropTerminating      = "terminating"
+	DropCompleted        = "completed"
+	DropMissingStats     = "missing_stats"
+	DropGenericEphemeral = "generic_ephemeral_volume"
+	DropStaleStats       = "stale_stats"
+)
+
+// SeriesDropped counts the pods and volumes left out of the exported series, so that filters and caps that drop
+// more than intended show up in the metrics. They are counted on every stat summary fetch. Pods summed into others
+// by the collector are not dropped, they are exported as ephemeral_storage_others_pods.
+var SeriesDropped = func() *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "series_dropped_total",
+		Help:      "Number of pods and volumes left out of the exported series, by reason",
+	}, []string{"reason"})
+	for _, reason := range []string{DropTerminating, DropCompleted, DropMissingStats, DropGenericEphemeral, DropStaleStats} {
+		c.WithLabelValues(reason)
+	}
+	return c
+}()
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages of a stat summary fetch that can fail.
+const (
+	StageRequest = "request"
+	StageDecode  = "decode"
+)
+
+// CollectionError is a failed stat summary fetch of a node.
+type CollectionError struct {
+	Time  time.Time `json:"time"`
+	Node  string    `json:"node"`
+	Stage string    `json:"stage"`
+	Cause string    `json:"cause"`
+}
+
+// ErrorLog keeps the last collection errors of the managers it is set in, to diagnose gaps in the metrics without
+// the logs of every exporter.
+type ErrorLog struct {
+	lock    sync.Mutex
+	entries []CollectionError
+	// next is the index of the oldest entry once entries is full.
+	next int
+}
+
+// NewErrorLog returns a log of the last size errors.
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{entries: make([]CollectionError, 0, size)}
+}
+
+// Record adds an error, dropping the oldest one if the log is full.
+func (l *ErrorLog) Record(e CollectionError) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, e)
+		return
+	}
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// Errors returns the recorded errors, newest first.
+func (l *ErrorLog) Errors() []CollectionError {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	errs := make([]CollectionError, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		errs = append(errs, l.entries[(l.next+i)%len(l.entries)])
+	}
+	return errs
+}
@@ -0,0 +1,29 @@
+package provider
+
+// FilterPods returns a provider of the snapshots of p with the pods keep returns true for only, e.g. to serve the
+// series of some namespaces. Node stats are kept.
+func FilterPods(p Provider, keep func(*PodStat) bool) Provider {
+	return filteredProvider{provider: p, keep: keep}
+}
+
+type filteredProvider struct {
+	provider Provider
+	keep     func(*PodStat) bool
+}
+
+// Snapshots implements Provider. Snapshots are copied, since they are shared with other readers.
+func (f filteredProvider) Snapshots() []*Snapshot {
+	snapshots := f.provider.Snapshots()
+	filtered := make([]*Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		s := *snapshot
+		s.Pods = nil
+		for i := range snapshot.Pods {
+			if f.keep(&snapshot.Pods[i]) {
+				s.Pods = append(s.Pods, snapshot.Pods[i])
+			}
+		}
+		filtered = append(filtered, &s)
+	}
+	return filtered
+}
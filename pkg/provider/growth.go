@@ -0,0 +1,74 @@
+package provider
+
+import "time"
+
+type growthSample struct {
+	at     time.Time
+	growth uint64
+}
+
+type podGrowth struct {
+	lastUsed uint64
+	samples  []growthSample
+}
+
+// growthTracker keeps the growth between consecutive samples of each pod for a sliding window,
+// so bursts shorter than the prometheus scrape interval remain visible.
+type growthTracker struct {
+	window time.Duration
+	pods   map[string]*podGrowth
+}
+
+func newGrowthTracker(window time.Duration) *growthTracker {
+	return &growthTracker{
+		window: window,
+		pods:   map[string]*podGrowth{},
+	}
+}
+
+// observe records the used bytes of the pod and returns the max growth within the window.
+func (t *growthTracker) observe(uid string, now time.Time, used uint64) uint64 {
+	pg, ok := t.pods[uid]
+	if !ok {
+		t.pods[uid] = &podGrowth{lastUsed: used}
+		return 0
+	}
+
+	if used > pg.lastUsed {
+		pg.samples = append(pg.samples, growthSample{at: now, growth: used - pg.lastUsed})
+	}
+	pg.lastUsed = used
+	return t.max(uid, now)
+}
+
+// max returns the max growth of the pod within the window without recording its used bytes, e.g. of stats fetched
+// out of band, whose shorter interval would split the growth of the tick.
+func (t *growthTracker) max(uid string, now time.Time) uint64 {
+	pg, ok := t.pods[uid]
+	if !ok {
+		return 0
+	}
+	cutoff := now.Add(-t.window)
+	kept := pg.samples[:0]
+	var max uint64
+	for _, sample := range pg.samples {
+		if sample.at.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, sample)
+		if sample.growth > max {
+			max = sample.growth
+		}
+	}
+	pg.samples = kept
+	return max
+}
+
+// retain forgets pods that are not in seen.
+func (t *growthTracker) retain(seen map[string]struct{}) {
+	for uid := range t.pods {
+		if _, ok := seen[uid]; !ok {
+			delete(t.pods, uid)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// KubeletOptions configures a KubeletClient.
+type KubeletOptions struct {
+	// Port is the port of the kubelet API.
+	Port int
+	// AddressTypes are the node address types to reach the kubelet at, in order of preference.
+	AddressTypes []corev1.NodeAddressType
+	// HostOverrides maps node names to the host, or host:port, of their kubelet, e.g. where node names are not
+	// resolvable. Overridden nodes are not looked up.
+	HostOverrides map[string]string
+	// InsecureSkipVerify skips the verification of the serving certificate of the kubelet, which is self-signed
+	// unless the kubelet bootstraps its serving certificate.
+	InsecureSkipVerify bool
+}
+
+// KubeletClient requests stat summaries from kubelets directly instead of through the api server node proxy, for
+// api servers that are overloaded by the proxied requests or cannot reach the kubelets.
+// Requests are authenticated with the credentials of the api server client.
+type KubeletClient struct {
+	cli    kubernetes.Interface
+	client *http.Client
+	opts   KubeletOptions
+
+	lock      sync.Mutex
+	addresses map[string]string
+}
+
+// NewKubeletClient returns a client of the kubelets of the nodes of cli, authenticated like cfg.
+func NewKubeletClient(cli kubernetes.Interface, cfg *rest.Config, opts KubeletOptions) (*KubeletClient, error) {
+	kubeletCfg := rest.CopyConfig(cfg)
+	// The TLS server name of the api server does not match the kubelets.
+	kubeletCfg.TLSClientConfig.ServerName = ""
+	if opts.InsecureSkipVerify {
+		kubeletCfg.TLSClientConfig.Insecure = true
+		kubeletCfg.TLSClientConfig.CAFile = ""
+		kubeletCfg.TLSClientConfig.CAData = nil
+	}
+	client, err := rest.HTTPClientFor(kubeletCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KubeletClient{cli: cli, client: client, opts: opts, addresses: map[string]string{}}, nil
+}
+
+// Address returns the host:port of the kubelet of node: its override, or its first address of the preferred
+// types. Addresses are looked up once until Forget.
+func (k *KubeletClient) Address(ctx context.Context, node string) (string, error) {
+	port := strconv.Itoa(k.opts.Port)
+	if host, ok := k.opts.HostOverrides[node]; ok {
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			return host, nil
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+
+	k.lock.Lock()
+	address, ok := k.addresses[node]
+	k.lock.Unlock()
+	if ok {
+		return address, nil
+	}
+	obj, err := k.cli.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node: %v", err)
+	}
+	for _, addressType := range k.opts.AddressTypes {
+		for _, a := range obj.Status.Addresses {
+			if a.Type == addressType && a.Address != "" {
+				address = net.JoinHostPort(a.Address, port)
+				k.lock.Lock()
+				k.addresses[node] = address
+				k.lock.Unlock()
+				return address, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s has no address of the types %v", node, k.opts.AddressTypes)
+}
+
+// Forget drops the address of node, so that it is looked up again, e.g. after a failed request.
+func (k *KubeletClient) Forget(node string) {
+	k.lock.Lock()
+	delete(k.addresses, node)
+	k.lock.Unlock()
+}
+
+// Summary fetches the stat summary of node from its kubelet.
+func (k *KubeletClient) Summary(ctx context.Context, node string) ([]byte, error) {
+	address, err := k.Address(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+address+"/stats/summary", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		k.Forget(node)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return content, fmt.Errorf("kubelet %s responded %s", address, resp.Status)
+	}
+	return content, nil
+}
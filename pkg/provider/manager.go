@@ -0,0 +1,627 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// Observer is notified with the pod stats of every successful stat summary fetch.
+// The stats are shared and must not be modified.
+type Observer interface {
+	Observe(stats []PodStat)
+}
+
+// Options configures a Manager.
+type Options struct {
+	// NodeName is the node whose kubelet stat summary is fetched.
+	NodeName string
+	// Interval is the interval between two stat summary fetches.
+	Interval time.Duration
+	// Pods resolves pod objects of summary entries. Pod phases are only known when it is set.
+	Pods PodLookup
+	// ExcludeCompleted drops pods in the Succeeded or Failed phase.
+	ExcludeCompleted bool
+	// ExcludeTerminating drops pods that have a deletion timestamp.
+	ExcludeTerminating bool
+	// ExcludeGenericEphemeralVolumes drops generic ephemeral volumes from PodStat.Volumes.
+	ExcludeGenericEphemeralVolumes bool
+	// NamespaceShard keeps the pods of the namespaces of the shard only. Node stats are kept on every shard.
+	NamespaceShard NamespaceShard
+	// PodLabels are the keys of the pod labels kept in PodStat.Labels.
+	PodLabels []string
+	// Decorators fill PodStat.Decorations from the pod objects of Pods.
+	Decorators []Decorator
+	// MaxGrowthWindow enables tracking of PodStat.MaxGrowthBytes over the given sliding window.
+	MaxGrowthWindow time.Duration
+	// TrackPeaks enables tracking of PodStat.PeakUsedBytes.
+	TrackPeaks bool
+	// DedupeEmptyDir corrects the ephemeral storage of pods whose kubelet counted their emptyDir volumes twice, in
+	// the ephemeral-storage of the pod and in its volume stats, so that it agrees with the sum of its components.
+	// Only nodes whose runtime has QuirkEmptyDirDoubleCounted are corrected.
+	DedupeEmptyDir bool
+	// MaxStatsAge drops the pod and node filesystem stats whose FsStats time is older than this at the time of the
+	// request, so that stale kubelet disk stats are not mistaken for live data. Disabled when 0.
+	MaxStatsAge time.Duration
+	// KubeletRestartGrace is the duration after a detected kubelet restart during which pods the kubelet reports
+	// without stats keep their previous stats. Disabled when 0.
+	KubeletRestartGrace time.Duration
+	// KeepContainers and KeepVolumes keep the container and volume breakdown in PodStat.
+	KeepContainers bool
+	KeepVolumes    bool
+	// HotInterval replaces Interval while the node has a hot pod, i.e. a pod using at least HotUsedBytes or matching
+	// HotSelector, or is under pressure, see HotNodeAvailableBytes. The summary always has every pod, so the interval
+	// is per node. Disabled when 0.
+	HotInterval  time.Duration
+	HotUsedBytes uint64
+	// HotSelector is matched against the labels of pod objects, so it requires Pods.
+	HotSelector labels.Selector
+	// HotNodeAvailableBytes and HotNodeAvailablePercent make the node hot as a whole while the available bytes of its
+	// node filesystem are below the given bytes or percentage of its capacity, to capture fast-filling pods at high
+	// resolution wherever they run. Disabled when 0.
+	HotNodeAvailableBytes   uint64
+	HotNodeAvailablePercent float64
+	// Kubelet requests the stat summary from the kubelet directly if set, instead of through the api server node
+	// proxy.
+	Kubelet *KubeletClient
+	// Errors records the failed stat summary fetches if set.
+	Errors *ErrorLog
+	// WatchdogIntervals restarts the collection loop of Start if it did not complete a cycle in this many
+	// intervals, e.g. because a request hangs. Disabled when 0.
+	WatchdogIntervals int
+	// ErrorBudget is the fraction of the stat summary requests of the last SuccessWindow that may fail. Beyond, the
+	// budget is exhausted and failed requests are retried with an exponential backoff from the interval instead of
+	// at the interval, or the hot interval, so that a struggling kubelet or api server is not flooded with
+	// requests. Disabled when 0.
+	ErrorBudget float64
+	// KeepRawSummary keeps the content of the last successful stat summary request, see Manager.RawSummary.
+	KeepRawSummary bool
+	// Chaos injects failed requests and spikes of used bytes if set, see Chaos.
+	Chaos *Chaos
+	// Recorder writes the content of every successful stat summary request if set, including those that fail to
+	// decode.
+	Recorder *Recorder
+	// MountsFile is the mount table of the host of the node, e.g. /proc/1/mounts with the PID namespace of the host,
+	// read on every request to set the mounts of the node filesystems. Only valid for the node the exporter runs on.
+	MountsFile string
+}
+
+// Manager periodically fetches the node stat summary through the api server node proxy.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Manager struct {
+	node           string
+	cli            kubernetes.Interface
+	scrapeInterval time.Duration
+	opts           Options
+	growth         *growthTracker
+	peaks          map[string]uint64
+	source         string
+	fields         string
+	runtime        *ContainerRuntime
+	kubeletVersion string
+	observers      []Observer
+	tickObservers  []Observer
+	snapshot       atomic.Pointer[Snapshot]
+	rawSummary     atomic.Pointer[RawSummary]
+	paused         atomic.Bool
+	hot            atomic.Bool
+	// backoff is the interval while the error budget is exhausted, see Options.ErrorBudget, 0 otherwise.
+	// backoffUntil is the time of the next request then, in Unix nanoseconds.
+	backoff      atomic.Int64
+	backoffUntil atomic.Int64
+
+	// summary is reused between updates so that decoding reuses its slices. It is guarded by updateLock.
+	summary    stats.Summary
+	seen       map[string]struct{}
+	updateLock sync.Mutex
+
+	// kubeletStart is the start time of the kubelet reported by the last summary. graceUntil is the end of the
+	// grace period after the last restart. They are guarded by updateLock.
+	kubeletStart time.Time
+	graceUntil   time.Time
+	restarts     uint64
+
+	// outcomes are the results of the requests of the last SuccessWindow and failures the number of consecutive
+	// failed requests. They are guarded by updateLock.
+	outcomes outcomes
+	failures int
+
+	// dedupeLogged is set once a pod was corrected by Options.DedupeEmptyDir. It is guarded by updateLock.
+	dedupeLogged bool
+}
+
+var _ Provider = &Manager{}
+
+func NewManager(cli kubernetes.Interface, opts Options) *Manager {
+	m := &Manager{
+		node:           opts.NodeName,
+		cli:            cli,
+		scrapeInterval: opts.Interval,
+		opts:           opts,
+	}
+	if opts.MaxGrowthWindow > 0 {
+		m.growth = newGrowthTracker(opts.MaxGrowthWindow)
+	}
+	if opts.TrackPeaks {
+		m.peaks = map[string]uint64{}
+	}
+	return m
+}
+
+// AddObserver registers an observer. It must be called before Start.
+func (m *Manager) AddObserver(o Observer) {
+	m.observers = append(m.observers, o)
+}
+
+// AddTickObserver registers an observer of the stats of the collection loop only, not of those fetched out of band
+// with UpdateNow, e.g. an observer of rates or averages per tick. It must be called before Start.
+func (m *Manager) AddTickObserver(o Observer) {
+	m.tickObservers = append(m.tickObservers, o)
+}
+
+// Start runs the collection loop until ctx is done. Until the first stat summary request succeeds, requests are
+// retried with a backoff capped at the interval.
+func (m *Manager) Start(ctx context.Context) error {
+	if m.opts.WatchdogIntervals > 0 {
+		watch(ctx, time.Duration(m.opts.WatchdogIntervals)*m.scrapeInterval, m.run, "node", m.node)
+		return nil
+	}
+	m.run(ctx, func() {})
+	return nil
+}
+
+// run is the collection loop of Start. It calls beat after every cycle.
+func (m *Manager) run(ctx context.Context, beat func()) {
+	timer := time.NewTimer(0 * time.Second)
+	defer timer.Stop()
+	startup := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: m.scrapeInterval}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		// A loop restarted by the watchdog may see its timer fire along with the cancellation.
+		if ctx.Err() != nil {
+			return
+		}
+		if m.paused.Load() {
+			beat()
+			timer.Reset(m.scrapeInterval)
+			continue
+		}
+		start := time.Now()
+		err := m.Update(ctx)
+		beat()
+		end := time.Now()
+		duration := end.Sub(start)
+		klog.V(3).Infof("Taking time to get node stat summary start:%v, end:%v, duration:%v", start, end, duration)
+
+		if err != nil && !m.Ready() {
+			// The kubelet of a booting node refuses stats for a while, so it is polled faster until it responds.
+			timer.Reset(startup.Step())
+			continue
+		}
+		timer.Reset(m.interval() - duration)
+	}
+}
+
+// interval returns the interval until the next stat summary request.
+func (m *Manager) interval() time.Duration {
+	if backoff := m.backoff.Load(); backoff > 0 {
+		return time.Duration(backoff)
+	}
+	if m.opts.HotInterval > 0 && m.hot.Load() {
+		return m.opts.HotInterval
+	}
+	return m.scrapeInterval
+}
+
+// Pause stops the stat summary requests of Start until Resume, e.g. to relieve a struggling kubelet. The stats of
+// the last request are kept.
+func (m *Manager) Pause() {
+	if !m.paused.Swap(true) {
+		klog.InfoS("Paused stat summary requests", "node", m.node)
+	}
+}
+
+// Resume restarts the stat summary requests at the next interval.
+func (m *Manager) Resume() {
+	if m.paused.Swap(false) {
+		klog.InfoS("Resumed stat summary requests", "node", m.node)
+	}
+}
+
+// Paused reports whether stat summary requests are paused.
+func (m *Manager) Paused() bool {
+	return m.paused.Load()
+}
+
+// RawSummary is the content of a stat summary response of the kubelet.
+type RawSummary struct {
+	// Time is the time of the request.
+	Time    time.Time
+	Content []byte
+}
+
+// RawSummary returns the last successfully decoded stat summary as the kubelet responded it, with
+// Options.KeepRawSummary. It is nil until a request succeeded. Content must not be modified.
+func (m *Manager) RawSummary() *RawSummary {
+	return m.rawSummary.Load()
+}
+
+// Ready reports whether a stat summary request succeeded.
+func (m *Manager) Ready() bool {
+	snapshot := m.snapshot.Load()
+	return snapshot != nil && !snapshot.SummaryTime.IsZero()
+}
+
+// Update fetches the node stat summary once and replaces the recent stats. It returns the error of the request.
+func (m *Manager) Update(ctx context.Context) error {
+	return m.update(ctx, true)
+}
+
+// UpdateNow is Update out of band of the collection loop, e.g. on demand. The stats are not recorded by the tick
+// observers and the growth tracking of Options.MaxGrowthWindow, whose rates the shorter interval would skew.
+func (m *Manager) UpdateNow(ctx context.Context) error {
+	return m.update(ctx, false)
+}
+
+func (m *Manager) update(ctx context.Context, tick bool) error {
+	m.updateLock.Lock()
+	defer m.updateLock.Unlock()
+
+	start := time.Now()
+	content, err := m.fetch(ctx)
+	if err == nil && m.opts.Chaos != nil {
+		// The kubelet is still requested, the failure is only seen by the exporter.
+		if err = m.opts.Chaos.failure(start); err != nil {
+			content = nil
+		}
+	}
+	switch {
+	case err == nil:
+	case !m.Ready():
+		klog.V(1).InfoS("Kubelet is not ready yet", "node", m.node, "err", err)
+	case m.opts.Kubelet != nil:
+		klog.ErrorS(err, "Failed to request kubelet", "node", m.node, "content", content)
+	default:
+		klog.ErrorS(err, "Failed to request api server", "node", m.node, "content", content)
+	}
+	if err != nil {
+		m.recordError(start, StageRequest, err)
+	} else if m.opts.Recorder != nil {
+		if recordErr := m.opts.Recorder.Record(m.node, start, content); recordErr != nil {
+			klog.ErrorS(recordErr, "Failed to record stat summary", "node", m.node)
+		}
+	}
+	klog.V(4).Infof("Fetched proxy stats from node : %s", m.node)
+
+	latency := time.Since(start)
+
+	raw := &m.summary
+	raw.Node = stats.NodeStats{}
+	// encoding/json decodes into the elements beyond the length as is, so fields missing in the new summary
+	// would keep the values of the previous one.
+	raw.Pods = raw.Pods[:cap(raw.Pods)]
+	for i := range raw.Pods {
+		raw.Pods[i] = stats.PodStats{}
+	}
+	raw.Pods = raw.Pods[:0]
+	var parseDuration time.Duration
+	if err == nil {
+		parseStart := time.Now()
+		err = json.Unmarshal(content, raw)
+		parseDuration = time.Since(parseStart)
+		if err != nil {
+			klog.ErrorS(err, "Failed to decode stat summary", "node", m.node)
+			m.recordError(start, StageDecode, err)
+		}
+	}
+
+	nodeName := raw.Node.NodeName
+	if err == nil {
+		if source := DetectSource(raw, m.source); source != m.source {
+			if source == SourceNone {
+				klog.Warningf("The stat summary of node %s has no storage stats of pods, they are not exported", m.node)
+			} else {
+				klog.InfoS("Detected kubelet stats source", "node", m.node, "source", source)
+			}
+			m.source = source
+		}
+		if fields := SummaryFields(raw); fields != m.fields {
+			klog.InfoS("Detected stat summary fields", "node", m.node, "fields", fields, "previous", m.fields)
+			m.fields = fields
+		}
+		if m.runtime == nil {
+			// A transient failure, e.g. of the api server, is not kept and retried on the next request.
+			if detected, version, ok := m.detectRuntime(ctx); ok {
+				m.runtime, m.kubeletVersion = &detected, version
+			}
+		}
+	}
+	// The previous slice may still be read by collectors, so a new one is allocated.
+	podStats := make([]PodStat, 0, len(raw.Pods))
+	hot := false
+
+	for i := range raw.Pods {
+		podStat := &raw.Pods[i]
+		if !m.opts.NamespaceShard.Owns(podStat.PodRef.Namespace) {
+			continue
+		}
+		if m.source == SourceContainers && podStat.EphemeralStorage == nil && len(podStat.Containers) > 0 {
+			podStat.EphemeralStorage = containersEphemeralStorage(podStat, raw.Node.Fs)
+		} else if m.opts.DedupeEmptyDir && m.runtime != nil && m.runtime.Has(QuirkEmptyDirDoubleCounted) && dedupeEmptyDir(podStat) {
+			EmptyDirCorrections.Inc()
+			if !m.dedupeLogged {
+				m.dedupeLogged = true
+				klog.InfoS("Correcting the ephemeral storage of pods for emptyDir volumes counted twice by the kubelet", "node", m.node, "pod", klog.KRef(podStat.PodRef.Namespace, podStat.PodRef.Name), "runtime", m.runtime.Name)
+			}
+		}
+		// A pod that has just been created may not have a field below.
+		if podStat.EphemeralStorage == nil {
+			SeriesDropped.WithLabelValues(DropMissingStats).Inc()
+		} else if isStale(podStat.EphemeralStorage, start, m.opts.MaxStatsAge) {
+			SeriesDropped.WithLabelValues(DropStaleStats).Inc()
+		} else {
+			stat := newPodStat(nodeName, podStat, m.opts.KeepContainers, m.opts.KeepVolumes)
+			if m.opts.Chaos != nil {
+				m.opts.Chaos.spikePod(&stat, start)
+			}
+			pod, dropped := m.enrich(ctx, &stat)
+			if dropped != "" {
+				SeriesDropped.WithLabelValues(dropped).Inc()
+				continue
+			}
+			if m.opts.HotInterval > 0 && !hot {
+				hot = m.isHot(&stat, pod)
+			}
+			if m.opts.ExcludeGenericEphemeralVolumes {
+				volumes := len(stat.Volumes)
+				stat.Volumes = withoutGenericEphemeral(stat.Volumes)
+				SeriesDropped.WithLabelValues(DropGenericEphemeral).Add(float64(volumes - len(stat.Volumes)))
+			}
+			if m.growth != nil && podStat.EphemeralStorage.UsedBytes != nil {
+				if tick {
+					stat.MaxGrowthBytes = m.growth.observe(stat.UID, start, stat.UsedBytes)
+				} else {
+					stat.MaxGrowthBytes = m.growth.max(stat.UID, start)
+				}
+			}
+			if m.peaks != nil {
+				stat.PeakUsedBytes = m.observePeak(stat.UID, stat.UsedBytes)
+			}
+			podStats = append(podStats, stat)
+		}
+	}
+	if err == nil {
+		if started := kubeletStartTime(raw); !started.IsZero() {
+			if !m.kubeletStart.IsZero() && !started.Equal(m.kubeletStart) {
+				m.restarts++
+				m.graceUntil = start.Add(m.opts.KubeletRestartGrace)
+				klog.InfoS("Detected kubelet restart", "node", m.node, "startTime", started)
+				// The kubelet may have been upgraded, its version and runtime are read again.
+				m.runtime = nil
+			}
+			m.kubeletStart = started
+		}
+		if previous := m.snapshot.Load(); previous != nil && start.Before(m.graceUntil) {
+			podStats = holdPods(podStats, previous.Pods)
+		}
+	}
+	if (m.growth != nil || m.peaks != nil) && err == nil {
+		if m.seen == nil {
+			m.seen = make(map[string]struct{}, len(podStats))
+		}
+		for uid := range m.seen {
+			delete(m.seen, uid)
+		}
+		for i := range podStats {
+			m.seen[podStats[i].UID] = struct{}{}
+		}
+		if m.growth != nil {
+			m.growth.retain(m.seen)
+		}
+		for uid := range m.peaks {
+			if _, ok := m.seen[uid]; !ok {
+				delete(m.peaks, uid)
+			}
+		}
+	}
+
+	if err == nil && m.opts.HotInterval > 0 && !hot {
+		hot = m.underPressure(raw.Node.Fs)
+	}
+	if err == nil && m.opts.HotInterval > 0 && m.hot.Swap(hot) != hot {
+		klog.V(1).InfoS("Changed stat summary interval", "node", m.node, "hot", hot, "interval", m.interval())
+	}
+
+	ratio, exhausted := m.updateBudget(start, err == nil)
+
+	var snapshot *Snapshot
+	if err == nil {
+		runtime, kubeletVersion := ContainerRuntime{Name: RuntimeUnknown}, ""
+		if m.runtime != nil {
+			runtime, kubeletVersion = *m.runtime, m.kubeletVersion
+		}
+		snapshot = &Snapshot{Time: start, SummaryTime: start, Pods: podStats, Source: m.source, SummaryFields: m.fields, KubeletVersion: kubeletVersion,
+			Runtime: runtime, StatsAge: statsAge(raw, start)}
+		if raw.Node.Fs != nil && !isStale(raw.Node.Fs, start, m.opts.MaxStatsAge) {
+			snapshot.NodeFs = newFsUsage(raw.Node.Fs)
+			if m.opts.Chaos != nil {
+				m.opts.Chaos.spikeNode(snapshot.NodeFs, start)
+			}
+			snapshot.HostFs = newHostUsage(raw)
+		}
+		if raw.Node.Runtime != nil && raw.Node.Runtime.ImageFs != nil && !isStale(raw.Node.Runtime.ImageFs, start, m.opts.MaxStatsAge) {
+			snapshot.ImageFs = newFsUsage(raw.Node.Runtime.ImageFs)
+		}
+		snapshot.Node = NodeStatus{NodeName: m.node, Up: true, Latency: latency, PayloadBytes: len(content), ParseDuration: parseDuration, Interval: m.interval(), KubeletRestarts: m.restarts,
+			SuccessRatio: ratio, ErrorBudgetExhausted: exhausted, ConsecutiveFailures: m.failures}
+		if m.opts.MountsFile != "" {
+			if mounts, err := ReadMounts(m.opts.MountsFile); err != nil {
+				klog.ErrorS(err, "Failed to read mount table", "node", m.node)
+			} else {
+				setMounts(snapshot, mounts)
+			}
+		}
+		countZeroCapacity(snapshot)
+		if m.opts.KeepRawSummary {
+			m.rawSummary.Store(&RawSummary{Time: start, Content: content})
+		}
+	} else {
+		// The stats of the last successful request are kept, so that series do not disappear on a transient error.
+		snapshot = &Snapshot{}
+		if previous := m.snapshot.Load(); previous != nil {
+			*snapshot = *previous
+		}
+		snapshot.Time = start
+		snapshot.Node = NodeStatus{NodeName: m.node, Up: false, Latency: latency, Error: err.Error(), PayloadBytes: len(content), ParseDuration: parseDuration, Interval: m.interval(), KubeletRestarts: m.restarts,
+			SuccessRatio: ratio, ErrorBudgetExhausted: exhausted, ConsecutiveFailures: m.failures}
+	}
+	m.snapshot.Store(snapshot)
+
+	if err == nil {
+		for _, o := range m.observers {
+			o.Observe(podStats)
+		}
+		if tick {
+			for _, o := range m.tickObservers {
+				o.Observe(podStats)
+			}
+		}
+	}
+	return err
+}
+
+// updateBudget records the result of a request at start and returns the success ratio of the last SuccessWindow
+// and whether the error budget is exhausted. While it is, failed requests back off, see Options.ErrorBudget.
+// Requests before the first success have the backoff of Start instead.
+func (m *Manager) updateBudget(start time.Time, ok bool) (float64, bool) {
+	m.outcomes.add(start, ok)
+	if ok {
+		m.failures = 0
+	} else {
+		m.failures++
+	}
+	ratio := m.outcomes.ratio()
+	exhausted := m.opts.ErrorBudget > 0 && 1-ratio > m.opts.ErrorBudget
+	if exhausted && !ok && m.Ready() {
+		backoff := budgetBackoff(m.scrapeInterval, m.failures)
+		if m.backoff.Swap(int64(backoff)) == 0 {
+			klog.InfoS("Error budget of stat summary requests exhausted, backing off", "node", m.node, "successRatio", ratio, "backoff", backoff)
+		}
+		m.backoffUntil.Store(start.Add(backoff).UnixNano())
+	} else if m.backoff.Swap(0) != 0 {
+		klog.InfoS("Stopped backing off stat summary requests", "node", m.node, "successRatio", ratio)
+	}
+	return ratio, exhausted
+}
+
+// due reports whether the next request is due at now, i.e. the manager is not backing off, see Options.ErrorBudget.
+func (m *Manager) due(now time.Time) bool {
+	return m.backoff.Load() == 0 || now.UnixNano() >= m.backoffUntil.Load()
+}
+
+// recordError records a failed fetch in the error log of the options, if any.
+func (m *Manager) recordError(start time.Time, stage string, err error) {
+	if m.opts.Errors != nil {
+		m.opts.Errors.Record(CollectionError{Time: start, Node: m.node, Stage: stage, Cause: err.Error()})
+	}
+}
+
+// fetch requests the stat summary of the node.
+func (m *Manager) fetch(ctx context.Context) ([]byte, error) {
+	if m.opts.Kubelet != nil {
+		return m.opts.Kubelet.Summary(ctx, m.node)
+	}
+	return m.cli.CoreV1().RESTClient().Get().AbsPath(fmt.Sprintf("/api/v1/nodes/%s/proxy/stats/summary", m.node)).DoRaw(ctx)
+}
+
+// enrich fills the pod attributes of stat from Options.Pods. It returns the pod object, nil if unknown, and the
+// reason the phase filters drop the pod, empty if it is kept. Pods unknown to the lookup are never filtered out.
+func (m *Manager) enrich(ctx context.Context, stat *PodStat) (*corev1.Pod, string) {
+	if m.opts.Pods == nil {
+		return nil, ""
+	}
+	pod, found := m.opts.Pods.Pod(ctx, stat.Namespace, stat.PodName)
+	if !found {
+		stat.Phase = string(corev1.PodUnknown)
+		return nil, ""
+	}
+	stat.Phase = podPhase(pod)
+	markGenericEphemeral(pod, stat.Volumes)
+	stat.WorkloadKind, stat.WorkloadName = workloadOf(pod)
+	if len(m.opts.PodLabels) > 0 {
+		stat.Labels = make([]string, len(m.opts.PodLabels))
+		for i, key := range m.opts.PodLabels {
+			stat.Labels[i] = pod.Labels[key]
+		}
+	}
+	if len(m.opts.Decorators) > 0 {
+		stat.Decorations = decorate(m.opts.Decorators, pod)
+	}
+	switch {
+	case m.opts.ExcludeTerminating && stat.Phase == PhaseTerminating:
+		return pod, DropTerminating
+	case m.opts.ExcludeCompleted && (pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed):
+		return pod, DropCompleted
+	}
+	return pod, ""
+}
+
+// isHot reports whether the pod of stat, nil if unknown, is hot.
+func (m *Manager) isHot(stat *PodStat, pod *corev1.Pod) bool {
+	if m.opts.HotUsedBytes > 0 && stat.UsedBytes >= m.opts.HotUsedBytes {
+		return true
+	}
+	return pod != nil && m.opts.HotSelector != nil && m.opts.HotSelector.Matches(labels.Set(pod.Labels))
+}
+
+// underPressure reports whether the available bytes of the node filesystem fs are below the hot margin. A node
+// filesystem without available bytes is never under pressure.
+func (m *Manager) underPressure(fs *stats.FsStats) bool {
+	if fs == nil || fs.AvailableBytes == nil {
+		return false
+	}
+	available := *fs.AvailableBytes
+	if m.opts.HotNodeAvailableBytes > 0 && available < m.opts.HotNodeAvailableBytes {
+		return true
+	}
+	return m.opts.HotNodeAvailablePercent > 0 && float64(available) < float64(valueOf(fs.CapacityBytes))*m.opts.HotNodeAvailablePercent/100
+}
+
+// Snapshot returns the snapshot published by the last Update, or nil before the first Update.
+func (m *Manager) Snapshot() *Snapshot {
+	return m.snapshot.Load()
+}
+
+// observePeak records the used bytes of the pod and returns the max used bytes observed for it. Peaks are kept by
+// UID, so a pod recreated with the same name starts over.
+func (m *Manager) observePeak(uid string, used uint64) uint64 {
+	if used > m.peaks[uid] {
+		m.peaks[uid] = used
+	}
+	return m.peaks[uid]
+}
+
+// Snapshots implements Provider.
+func (m *Manager) Snapshots() []*Snapshot {
+	snapshot := m.snapshot.Load()
+	if snapshot == nil {
+		return nil
+	}
+	return []*Snapshot{snapshot}
+}
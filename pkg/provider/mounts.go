@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NodeFsPath is the directory of the kubelet on the host, which the node filesystem of the summary is the
+// filesystem of.
+const NodeFsPath = "/var/lib/kubelet"
+
+// imageFsPaths are the default directories of the container runtimes on the host, which the image filesystem of
+// the summary is the filesystem of.
+var imageFsPaths = map[string]string{
+	RuntimeContainerd: "/var/lib/containerd",
+	RuntimeCRIO:       "/var/lib/containers/storage",
+	RuntimeDocker:     "/var/lib/docker",
+}
+
+// Mount is the mount of a node filesystem in the mount table of the host, so that disks of different classes,
+// e.g. a root disk and a local NVMe for the images, can be told apart.
+type Mount struct {
+	// Device is the mounted device, e.g. /dev/nvme1n1, or the source of filesystems without one, e.g. overlay.
+	Device     string
+	Mountpoint string
+	// FsType is the filesystem type, e.g. ext4 or xfs.
+	FsType string
+}
+
+// ReadMounts reads a mount table in the format of /proc/mounts, e.g. /proc/1/mounts of a pod sharing the PID
+// namespace of the host.
+func ReadMounts(file string) ([]Mount, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []Mount
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected device, mountpoint and filesystem type, got %q", file, line, scanner.Text())
+		}
+		mounts = append(mounts, Mount{Device: unescapeMount(fields[0]), Mountpoint: unescapeMount(fields[1]), FsType: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMount decodes the octal escapes of the mount table, e.g. \040 for a space.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountOf returns the mount path is on, the one with the longest mountpoint containing it and mounted last, nil if
+// none contains it.
+func mountOf(mounts []Mount, path string) *Mount {
+	var found *Mount
+	for i := range mounts {
+		mountpoint := mounts[i].Mountpoint
+		if path != mountpoint && !strings.HasPrefix(path, strings.TrimSuffix(mountpoint, "/")+"/") {
+			continue
+		}
+		if found == nil || len(mountpoint) >= len(found.Mountpoint) {
+			found = &mounts[i]
+		}
+	}
+	return found
+}
+
+// setMounts sets the mounts of the node filesystems of snapshot from mounts. The image filesystem is found from the
+// directory of the runtime, or is the node filesystem if the summary reports the same usage for both, as kubelets
+// do when the runtime has no filesystem of its own.
+func setMounts(snapshot *Snapshot, mounts []Mount) {
+	if snapshot.NodeFs != nil {
+		snapshot.NodeFs.Mount = mountOf(mounts, NodeFsPath)
+	}
+	if snapshot.ImageFs == nil {
+		return
+	}
+	if path, ok := imageFsPaths[snapshot.Runtime.Name]; ok {
+		snapshot.ImageFs.Mount = mountOf(mounts, path)
+	} else if nodeFs := snapshot.NodeFs; nodeFs != nil && nodeFs.CapacityBytes == snapshot.ImageFs.CapacityBytes &&
+		nodeFs.AvailableBytes == snapshot.ImageFs.AvailableBytes {
+		snapshot.ImageFs.Mount = nodeFs.Mount
+	}
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// PhaseTerminating is reported as the phase of pods that have a deletion timestamp, like kubectl does.
+const PhaseTerminating = "Terminating"
+
+// RecommendedLabels are the Kubernetes recommended labels most dashboards are keyed on.
+// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
+var RecommendedLabels = []string{"app.kubernetes.io/name", "app.kubernetes.io/instance", "app.kubernetes.io/component"}
+
+// PodLookup resolves the pod object of a stat summary entry.
+type PodLookup interface {
+	Pod(ctx context.Context, namespace, name string) (*corev1.Pod, bool)
+}
+
+// CachePodLookup looks pods up in a controller-runtime informer cache.
+type CachePodLookup struct {
+	cache cache.Cache
+}
+
+func NewCachePodLookup(c cache.Cache) *CachePodLookup {
+	return &CachePodLookup{cache: c}
+}
+
+func (l *CachePodLookup) Pod(ctx context.Context, namespace, name string) (*corev1.Pod, bool) {
+	pod := &corev1.Pod{}
+	if err := l.cache.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, pod); err != nil {
+		klog.V(4).Infof("Pod %s/%s is not found in cache: %v", namespace, name, err)
+		return nil, false
+	}
+	return pod, true
+}
+
+// podPhase returns the phase of the pod, or PhaseTerminating if it is being deleted.
+func podPhase(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return PhaseTerminating
+	}
+	if pod.Status.Phase == "" {
+		return string(corev1.PodUnknown)
+	}
+	return string(pod.Status.Phase)
+}
+
+// workloadOf returns the kind and name of the workload controlling the pod. Pods of a ReplicaSet created by
+// a Deployment are attributed to the Deployment. Pods without a controller have no workload.
+func workloadOf(pod *corev1.Pod) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", ""
+	}
+	if owner.Kind == "ReplicaSet" {
+		if hash, ok := pod.Labels["pod-template-hash"]; ok && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return owner.Kind, owner.Name
+}
+
+// EphemeralStorageLimit returns the sum of the container ephemeral storage limits and whether every container has
+// a limit, which is when the kubelet enforces a pod level limit.
+// Ephemeral storage is not resizable in place, so the spec limits are the ones the kubelet enforces.
+func EphemeralStorageLimit(pod *corev1.Pod) (int64, bool) {
+	if len(pod.Spec.Containers) == 0 {
+		return 0, false
+	}
+	var sum int64
+	for _, container := range pod.Spec.Containers {
+		limit, ok := container.Resources.Limits[corev1.ResourceEphemeralStorage]
+		if !ok {
+			return 0, false
+		}
+		sum += limit.Value()
+	}
+	return sum, true
+}
+
+// EphemeralStorageRequest returns the sum of the container ephemeral storage requests and whether any container
+// has one.
+func EphemeralStorageRequest(pod *corev1.Pod) (int64, bool) {
+	var sum int64
+	found := false
+	for _, container := range pod.Spec.Containers {
+		if request, ok := container.Resources.Requests[corev1.ResourceEphemeralStorage]; ok {
+			sum += request.Value()
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// markGenericEphemeral sets VolumeStat.GenericEphemeral of volumes from the pod spec.
+func markGenericEphemeral(pod *corev1.Pod, volumes []VolumeStat) {
+	if len(volumes) == 0 {
+		return
+	}
+	ephemeral := make(map[string]bool, len(pod.Spec.Volumes))
+	for _, volume := range pod.Spec.Volumes {
+		ephemeral[volume.Name] = volume.Ephemeral != nil
+	}
+	for i := range volumes {
+		if generic, ok := ephemeral[volumes[i].Name]; ok {
+			volumes[i].GenericEphemeral = generic
+		}
+	}
+}
+
+// withoutGenericEphemeral filters generic ephemeral volumes out of volumes in place.
+func withoutGenericEphemeral(volumes []VolumeStat) []VolumeStat {
+	kept := volumes[:0]
+	for _, volume := range volumes {
+		if !volume.GenericEphemeral {
+			kept = append(kept, volume)
+		}
+	}
+	return kept
+}
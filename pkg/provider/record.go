@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recordTimeFormat names the recorded files, so that their names sort in the order they were recorded.
+const recordTimeFormat = "20060102T150405.000000000Z"
+
+// Recorder writes the stat summaries of the managers it is set in to files as the kubelet responded them, so that
+// a metric bug is reproduced by replaying them, see RecordedSummaries, without access to the cluster.
+type Recorder struct {
+	dir      string
+	maxFiles int
+}
+
+// NewRecorder returns a recorder writing to dir, which keeps the last maxFiles summaries of each node, all if 0.
+func NewRecorder(dir string, maxFiles int) *Recorder {
+	return &Recorder{dir: dir, maxFiles: maxFiles}
+}
+
+// Record writes content, the stat summary of node requested at at, to <dir>/<node>/<time>.json. The file is
+// renamed into place once written, so that the directory can be copied while recording.
+func (r *Recorder) Record(node string, at time.Time, content []byte) error {
+	dir := filepath.Join(r.dir, node)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, at.UTC().Format(recordTimeFormat)+".json")
+	if err := os.WriteFile(name+".tmp", content, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	if r.maxFiles == 0 {
+		return nil
+	}
+	files, err := RecordedSummaries(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > r.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// RecordedSummaries returns the files of the stat summaries a Recorder wrote to dir, the directory of a node, in
+// the order they were recorded.
+func RecordedSummaries(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"time"
+
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// kubeletStartTime returns the start time of the kubelet system container of summary, or zero if the kubelet does
+// not report it.
+func kubeletStartTime(summary *stats.Summary) time.Time {
+	for _, container := range summary.Node.SystemContainers {
+		if container.Name == stats.SystemContainerKubelet {
+			return container.StartTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// holdPods returns pods with the stats of previous for the pods missing in pods or whose used bytes dropped to 0.
+// Right after a restart, the kubelet lists running pods without stats until its first housekeeping, which would
+// show up as pods vanishing or freeing their storage.
+func holdPods(pods, previous []PodStat) []PodStat {
+	held := make(map[string]*PodStat, len(previous))
+	for i := range previous {
+		held[previous[i].UID] = &previous[i]
+	}
+	for i := range pods {
+		stat := &pods[i]
+		if old, ok := held[stat.UID]; ok {
+			if stat.UsedBytes == 0 && old.UsedBytes > 0 {
+				*stat = *old
+			}
+			delete(held, stat.UID)
+		}
+	}
+	for i := range previous {
+		if _, ok := held[previous[i].UID]; ok {
+			pods = append(pods, previous[i])
+		}
+	}
+	return pods
+}
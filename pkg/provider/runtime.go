@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Container runtimes of nodes, from the scheme of their containerRuntimeVersion.
+const (
+	RuntimeContainerd = "containerd"
+	RuntimeCRIO       = "cri-o"
+	RuntimeDocker     = "docker"
+	// RuntimeUnknown is the runtime of nodes that could not be read.
+	RuntimeUnknown = "unknown"
+)
+
+// Quirks of the stat summaries of container runtimes.
+const (
+	// QuirkEmptyDirDoubleCounted is set for runtimes whose kubelets count the usage of emptyDir volumes both in the
+	// ephemeral-storage of the pod and in its volume stats.
+	QuirkEmptyDirDoubleCounted = "emptydir-double-counted"
+)
+
+// runtimeQuirks are the known quirks by runtime. Kubelets that omit the ephemeral-storage of pods need no entry,
+// they are detected from the summary, see DetectSource.
+var runtimeQuirks = map[string][]string{
+	// Dockershim-era kubelets, before Kubernetes 1.24, and cri-dockerd are reported to roll emptyDir volumes up
+	// twice.
+	RuntimeDocker: {QuirkEmptyDirDoubleCounted},
+}
+
+// ContainerRuntime is the container runtime of a node.
+type ContainerRuntime struct {
+	// Name is one of the Runtime constants or the scheme of an other runtime, e.g. RuntimeContainerd.
+	Name    string
+	Version string
+	// Quirks are the known quirks of the runtime, sorted.
+	Quirks []string
+}
+
+// Has reports whether quirk is a known quirk of the runtime.
+func (r ContainerRuntime) Has(quirk string) bool {
+	for _, q := range r.Quirks {
+		if q == quirk {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseContainerRuntime parses the containerRuntimeVersion of a node status, e.g. containerd://1.6.8.
+func ParseContainerRuntime(containerRuntimeVersion string) ContainerRuntime {
+	name, version := containerRuntimeVersion, ""
+	if i := strings.Index(containerRuntimeVersion, "://"); i >= 0 {
+		name, version = containerRuntimeVersion[:i], containerRuntimeVersion[i+3:]
+	}
+	if name == "" {
+		return ContainerRuntime{Name: RuntimeUnknown}
+	}
+	runtime := ContainerRuntime{Name: name, Version: version}
+	runtime.Quirks = append(runtime.Quirks, runtimeQuirks[name]...)
+	sort.Strings(runtime.Quirks)
+	return runtime
+}
+
+// detectRuntime reads the container runtime and the kubelet version of the node. It is called until it succeeds,
+// and again after a kubelet restart. If the node could not be read, the runtime is RuntimeUnknown and the version
+// empty, and ok is false unless the error is permanent, i.e. without access to the node when it is only scraped
+// through nodes/proxy or without a node object, so that it is not read again on every request.
+func (m *Manager) detectRuntime(ctx context.Context) (runtime ContainerRuntime, kubeletVersion string, ok bool) {
+	node, err := m.cli.CoreV1().Nodes().Get(ctx, m.node, metav1.GetOptions{})
+	if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+		klog.InfoS("Failed to read the container runtime, not retrying until the kubelet restarts", "node", m.node, "err", err)
+		return ContainerRuntime{Name: RuntimeUnknown}, "", true
+	}
+	if err != nil {
+		klog.V(1).InfoS("Failed to read the container runtime, retrying on the next request", "node", m.node, "err", err)
+		return ContainerRuntime{Name: RuntimeUnknown}, "", false
+	}
+	runtime = ParseContainerRuntime(node.Status.NodeInfo.ContainerRuntimeVersion)
+	klog.InfoS("Detected container runtime", "node", m.node, "runtime", runtime.Name, "version", runtime.Version, "kubeletVersion", node.Status.NodeInfo.KubeletVersion)
+	for _, quirk := range runtime.Quirks {
+		klog.InfoS("Detected a known quirk of the container runtime", "node", m.node, "runtime", runtime.Name, "quirk", quirk)
+	}
+	return runtime, node.Status.NodeInfo.KubeletVersion, true
+}
@@ -0,0 +1,20 @@
+package provider
+
+import "hash/fnv"
+
+// NamespaceShard selects the namespaces of one of Count replicas, so that each scrapes the pods of its tenants only.
+// A namespace belongs to shard fnv32a(namespace) % Count. The zero value selects every namespace.
+type NamespaceShard struct {
+	Index int
+	Count int
+}
+
+// Owns reports whether the pods of namespace belong to the shard.
+func (s NamespaceShard) Owns(namespace string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index
+}
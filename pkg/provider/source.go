@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// Sources of the pod ephemeral storage stats of a stat summary.
+const (
+	// SourceSummary is the ephemeral-storage field of the pods, computed by the kubelet.
+	SourceSummary = "summary"
+	// SourceContainers sums the container writable layers and logs and the node-local volumes of the pods, for
+	// kubelets that omit the ephemeral-storage field, e.g. with some CRI stats providers.
+	SourceContainers = "containers"
+	// SourceNone is set for summaries whose pods have containers but no storage stats at all, only CPU and memory.
+	// Their pods are dropped as missing stats rather than exported with 0 used bytes.
+	SourceNone = "none"
+)
+
+// DetectSource returns the source of the pod stats of summary, or previous if the summary has no pod to tell.
+func DetectSource(summary *stats.Summary, previous string) string {
+	if len(summary.Pods) == 0 {
+		return previous
+	}
+	containers := false
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		if pod.EphemeralStorage != nil {
+			return SourceSummary
+		}
+		containers = containers || len(pod.Containers) > 0
+	}
+	if !containers {
+		return previous
+	}
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		if len(pod.VolumeStats) > 0 {
+			return SourceContainers
+		}
+		for _, container := range pod.Containers {
+			if container.Rootfs != nil || container.Logs != nil {
+				return SourceContainers
+			}
+		}
+	}
+	return SourceNone
+}
+
+// Storage fields of stat summaries, see SummaryFields.
+const (
+	FieldPodEphemeralStorage = "pod-ephemeral-storage"
+	FieldContainerRootfs     = "container-rootfs"
+	FieldContainerLogs       = "container-logs"
+	FieldVolumes             = "volumes"
+	FieldNodeFs              = "nodefs"
+	FieldImageFs             = "imagefs"
+)
+
+// SummaryFields returns the storage fields present in summary, sorted and comma separated, e.g.
+// "container-logs,container-rootfs,imagefs,nodefs,pod-ephemeral-storage,volumes". A field is present if any pod or
+// container of the summary has it, so that a kubelet upgrade moving or dropping one shows up as a changed set.
+func SummaryFields(summary *stats.Summary) string {
+	present := map[string]bool{
+		FieldNodeFs:  summary.Node.Fs != nil,
+		FieldImageFs: summary.Node.Runtime != nil && summary.Node.Runtime.ImageFs != nil,
+	}
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		present[FieldPodEphemeralStorage] = present[FieldPodEphemeralStorage] || pod.EphemeralStorage != nil
+		present[FieldVolumes] = present[FieldVolumes] || len(pod.VolumeStats) > 0
+		for _, container := range pod.Containers {
+			present[FieldContainerRootfs] = present[FieldContainerRootfs] || container.Rootfs != nil
+			present[FieldContainerLogs] = present[FieldContainerLogs] || container.Logs != nil
+		}
+	}
+	fields := make([]string, 0, len(present))
+	for field, ok := range present {
+		if ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+// containersEphemeralStorage computes the ephemeral storage of pod like the kubelet does: the writable layers and
+// logs of its containers and its volumes not backed by a claim. Available and capacity bytes are the ones of fs.
+func containersEphemeralStorage(pod *stats.PodStats, fs *stats.FsStats) *stats.FsStats {
+	var used, inodes uint64
+	for _, container := range pod.Containers {
+		if container.Rootfs != nil {
+			used += valueOf(container.Rootfs.UsedBytes)
+			inodes += valueOf(container.Rootfs.InodesUsed)
+		}
+		if container.Logs != nil {
+			used += valueOf(container.Logs.UsedBytes)
+			inodes += valueOf(container.Logs.InodesUsed)
+		}
+	}
+	for _, volume := range pod.VolumeStats {
+		if volume.PVCRef == nil {
+			used += valueOf(volume.UsedBytes)
+			inodes += valueOf(volume.InodesUsed)
+		}
+	}
+	result := &stats.FsStats{UsedBytes: &used, InodesUsed: &inodes}
+	if fs != nil {
+		result.AvailableBytes = fs.AvailableBytes
+		result.CapacityBytes = fs.CapacityBytes
+	}
+	return result
+}
+
+// EmptyDirCorrections counts the pods whose ephemeral storage was corrected for emptyDir volumes counted twice, see
+// Options.DedupeEmptyDir.
+var EmptyDirCorrections = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "emptydir_double_count_corrections_total",
+	Help:      "Number of pod stats whose ephemeral storage was corrected for node-local volumes counted twice by the kubelet",
+})
+
+// dedupeEmptyDir subtracts the node-local volumes of pod, which include its emptyDir volumes, from its
+// ephemeral-storage if the kubelet counted them twice: the used bytes are then closer to the writable layers and logs
+// of the containers plus twice the volumes than plus once. It reports whether the pod was corrected. Pods without
+// container stats are never corrected, their rollup cannot be checked.
+func dedupeEmptyDir(pod *stats.PodStats) bool {
+	if pod.EphemeralStorage == nil || pod.EphemeralStorage.UsedBytes == nil || len(pod.Containers) == 0 {
+		return false
+	}
+	var containers, volumes uint64
+	for _, container := range pod.Containers {
+		if container.Rootfs != nil {
+			containers += valueOf(container.Rootfs.UsedBytes)
+		}
+		if container.Logs != nil {
+			containers += valueOf(container.Logs.UsedBytes)
+		}
+	}
+	for _, volume := range pod.VolumeStats {
+		if volume.PVCRef == nil {
+			volumes += valueOf(volume.UsedBytes)
+		}
+	}
+	used := *pod.EphemeralStorage.UsedBytes
+	if volumes == 0 || used < volumes || distance(used, containers+2*volumes) >= distance(used, containers+volumes) {
+		return false
+	}
+	corrected := used - volumes
+	pod.EphemeralStorage.UsedBytes = &corrected
+	return true
+}
+
+func distance(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
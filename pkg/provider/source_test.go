@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+func uint64p(v uint64) *uint64 {
+	return &v
+}
+
+// newPodStats returns the stats of a pod using used bytes, with a container of rootfs and logs bytes and the given
+// volumes, the ones named claim-* backed by a claim.
+func newPodStats(used *uint64, rootfs, logs uint64, volumes map[string]uint64) stats.PodStats {
+	pod := stats.PodStats{
+		Containers: []stats.ContainerStats{{
+			Name:   "app",
+			Rootfs: &stats.FsStats{UsedBytes: uint64p(rootfs)},
+			Logs:   &stats.FsStats{UsedBytes: uint64p(logs)},
+		}},
+	}
+	if used != nil {
+		pod.EphemeralStorage = &stats.FsStats{UsedBytes: used}
+	}
+	for name, bytes := range volumes {
+		volume := stats.VolumeStats{Name: name, FsStats: stats.FsStats{UsedBytes: uint64p(bytes)}}
+		if strings.HasPrefix(name, "claim-") {
+			volume.PVCRef = &stats.PVCReference{Name: name}
+		}
+		pod.VolumeStats = append(pod.VolumeStats, volume)
+	}
+	return pod
+}
+
+func TestDedupeEmptyDir(t *testing.T) {
+	tests := []struct {
+		name          string
+		pod           stats.PodStats
+		wantCorrected bool
+		wantUsed      uint64
+	}{
+		{
+			name:          "volumes counted twice",
+			pod:           newPodStats(uint64p(10+5+2*100), 10, 5, map[string]uint64{"scratch": 100}),
+			wantCorrected: true,
+			wantUsed:      10 + 5 + 100,
+		},
+		{
+			name:     "volumes counted once",
+			pod:      newPodStats(uint64p(10+5+100), 10, 5, map[string]uint64{"scratch": 100}),
+			wantUsed: 10 + 5 + 100,
+		},
+		{
+			name:     "closer to once than twice",
+			pod:      newPodStats(uint64p(10+5+140), 10, 5, map[string]uint64{"scratch": 100}),
+			wantUsed: 10 + 5 + 140,
+		},
+		{
+			name:     "claims are not node-local",
+			pod:      newPodStats(uint64p(10+5+100), 10, 5, map[string]uint64{"claim-data": 100}),
+			wantUsed: 10 + 5 + 100,
+		},
+		{
+			name:     "no volumes",
+			pod:      newPodStats(uint64p(15), 10, 5, nil),
+			wantUsed: 15,
+		},
+		{
+			name:     "used below the volumes",
+			pod:      newPodStats(uint64p(50), 0, 0, map[string]uint64{"scratch": 100}),
+			wantUsed: 50,
+		},
+		{
+			name: "no containers",
+			pod: stats.PodStats{
+				EphemeralStorage: &stats.FsStats{UsedBytes: uint64p(200)},
+				VolumeStats:      []stats.VolumeStats{{Name: "scratch", FsStats: stats.FsStats{UsedBytes: uint64p(100)}}},
+			},
+			wantUsed: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := tt.pod
+			if got := dedupeEmptyDir(&pod); got != tt.wantCorrected {
+				t.Errorf("dedupeEmptyDir() = %v, want %v", got, tt.wantCorrected)
+			}
+			if got := *pod.EphemeralStorage.UsedBytes; got != tt.wantUsed {
+				t.Errorf("used bytes = %d, want %d", got, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestDetectSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		pods     []stats.PodStats
+		previous string
+		want     string
+	}{
+		{
+			name: "summary",
+			pods: []stats.PodStats{newPodStats(uint64p(15), 10, 5, nil)},
+			want: SourceSummary,
+		},
+		{
+			name: "containers",
+			pods: []stats.PodStats{newPodStats(nil, 10, 5, nil)},
+			want: SourceContainers,
+		},
+		{
+			name: "none",
+			pods: []stats.PodStats{{Containers: []stats.ContainerStats{{Name: "app"}}}},
+			want: SourceNone,
+		},
+		{
+			name:     "no pods",
+			previous: SourceSummary,
+			want:     SourceSummary,
+		},
+		{
+			name:     "pods without containers",
+			pods:     []stats.PodStats{{}},
+			previous: SourceContainers,
+			want:     SourceContainers,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectSource(&stats.Summary{Pods: tt.pods}, tt.previous); got != tt.want {
+				t.Errorf("DetectSource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
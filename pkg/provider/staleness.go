@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"time"
+
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// Filesystems of Snapshot.StatsAge.
+const (
+	StatsNodeFs  = "nodefs"
+	StatsImageFs = "imagefs"
+	// StatsPods is the oldest ephemeral storage stat of the pods.
+	StatsPods = "pods"
+)
+
+// statsAge returns the age of the FsStats of summary at start, by filesystem. Stats without a time are left out.
+// The kubelet refreshes disk stats in the background and serves the last ones, which can be minutes old under
+// load.
+func statsAge(summary *stats.Summary, start time.Time) map[string]time.Duration {
+	ages := map[string]time.Duration{}
+	add := func(fs string, stat *stats.FsStats) {
+		if stat == nil || stat.Time.IsZero() {
+			return
+		}
+		age := start.Sub(stat.Time.Time)
+		if oldest, ok := ages[fs]; !ok || age > oldest {
+			ages[fs] = age
+		}
+	}
+	add(StatsNodeFs, summary.Node.Fs)
+	if summary.Node.Runtime != nil {
+		add(StatsImageFs, summary.Node.Runtime.ImageFs)
+	}
+	for i := range summary.Pods {
+		add(StatsPods, summary.Pods[i].EphemeralStorage)
+	}
+	return ages
+}
+
+// isStale reports whether stat is older than maxAge at start. Stats without a time are never stale.
+func isStale(stat *stats.FsStats, start time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && stat != nil && !stat.Time.IsZero() && start.Sub(stat.Time.Time) > maxAge
+}
@@ -0,0 +1,268 @@
+package provider
+
+import (
+	"time"
+
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// Provider provides the most recent ephemeral storage stats, one snapshot per node.
+type Provider interface {
+	Snapshots() []*Snapshot
+}
+
+// Snapshot is the immutable result of one stat summary fetch. It is published atomically and never modified,
+// so readers never block the collection loop and vice versa.
+type Snapshot struct {
+	// Time is the time of the stat summary request.
+	Time time.Time
+	// SummaryTime is the time of the last successful request, which Pods, NodeFs and ImageFs come from. It is
+	// before Time if the request failed, and zero if no request succeeded yet.
+	SummaryTime time.Time
+	Pods        []PodStat
+	// Source is how the pod stats were computed, SourceSummary, SourceContainers or SourceNone. Empty until a
+	// summary with pods is fetched.
+	Source string
+	// SummaryFields are the storage fields present in the last summary, see SummaryFields.
+	SummaryFields string
+	// KubeletVersion is the kubelet version of the node status, empty without access to the node.
+	KubeletVersion string
+	// Runtime is the container runtime of the node. Empty until the first successful request.
+	Runtime ContainerRuntime
+	Node    NodeStatus
+	// NodeFs and ImageFs are the node filesystems, nil if missing in the summary.
+	NodeFs  *FsUsage
+	ImageFs *FsUsage
+	// HostFs breaks the used bytes of NodeFs down by owner, nil if NodeFs is nil.
+	HostFs *HostUsage
+	// StatsAge is the age of the kubelet stats at the time of the request, by filesystem, e.g. StatsNodeFs.
+	StatsAge map[string]time.Duration
+}
+
+// NodeStatus is the result of the last stat summary request to the kubelet of a node.
+type NodeStatus struct {
+	NodeName string
+	Up       bool
+	Latency  time.Duration
+	// Error is the error of the request if it failed.
+	Error string
+	// PayloadBytes and ParseDuration are the size of the stat summary response and the time spent decoding it.
+	PayloadBytes  int
+	ParseDuration time.Duration
+	// Interval is the interval until the next request, see Options.HotInterval.
+	Interval time.Duration
+	// KubeletRestarts is the number of kubelet restarts detected since the manager started.
+	KubeletRestarts uint64
+	// SuccessRatio is the fraction of the requests of the last SuccessWindow that succeeded.
+	SuccessRatio float64
+	// ErrorBudgetExhausted is set while more requests failed than Options.ErrorBudget allows.
+	ErrorBudgetExhausted bool
+	// ConsecutiveFailures is the number of requests that failed since the last successful one.
+	ConsecutiveFailures int
+}
+
+// PodStat is the ephemeral storage stat of a single pod. Only the fields of the kubelet FsStats that are
+// exported are kept; fields missing in the summary are 0.
+type PodStat struct {
+	NodeName  string
+	PodName   string
+	Namespace string
+	UID       string
+	// Phase is the pod phase, PhaseTerminating, or empty if Options.Pods is not set.
+	Phase string
+	// WorkloadKind and WorkloadName identify the controller of the pod. Empty if Options.Pods is not set
+	// or the pod has no controller.
+	WorkloadKind string
+	WorkloadName string
+	// Labels are the values of the pod labels of Options.PodLabels, in the same order. Nil if the pod is unknown.
+	Labels []string
+	// Decorations are the label values of Options.Decorators, in the same order. Nil if the pod is unknown.
+	Decorations []string
+	// MaxGrowthBytes is the max growth of used bytes between two consecutive summaries within Options.MaxGrowthWindow.
+	MaxGrowthBytes uint64
+	// PeakUsedBytes is the max used bytes observed for the pod since it or the exporter started, with
+	// Options.TrackPeaks.
+	PeakUsedBytes uint64
+
+	UsedBytes      uint64
+	AvailableBytes uint64
+	CapacityBytes  uint64
+	InodesUsed     uint64
+
+	// Containers and Volumes are only kept with Options.KeepContainers and Options.KeepVolumes.
+	Containers []ContainerStat
+	Volumes    []VolumeStat
+}
+
+// ContainerStat is the writable layer and log usage of a container.
+type ContainerStat struct {
+	Name             string
+	RootfsUsedBytes  uint64
+	RootfsInodesUsed uint64
+	LogsUsedBytes    uint64
+}
+
+// VolumeStat is the usage of a pod volume. PVCName is set for volumes backed by a persistent volume claim.
+type VolumeStat struct {
+	Name    string
+	PVCName string
+	// GenericEphemeral is set for generic ephemeral volumes, whose claim is created and deleted with the pod.
+	// They are not on the node filesystem, unlike the other ephemeral storage of the pod.
+	GenericEphemeral bool
+	UsedBytes        uint64
+	InodesUsed       uint64
+}
+
+// FsUsage is the usage of a node filesystem.
+type FsUsage struct {
+	UsedBytes      uint64
+	AvailableBytes uint64
+	CapacityBytes  uint64
+	InodesUsed     uint64
+	Inodes         uint64
+	// Mount is the mount of the filesystem on the host with Options.MountsFile, nil if unknown.
+	Mount *Mount
+}
+
+// HostUsage attributes the used bytes of the node filesystem. The summary has no per-directory breakdown, so
+// the runtime and other usage are derived from the filesystem and pod totals.
+type HostUsage struct {
+	// PodsBytes is the ephemeral storage of all pods on the node filesystem, including pods filtered out of
+	// Snapshot.Pods. Container writable layers are only included if the image filesystem is the node filesystem.
+	PodsBytes uint64
+	// RuntimeBytes is the container runtime root (images) if it is on the node filesystem, 0 otherwise.
+	RuntimeBytes uint64
+	// OtherBytes is the rest: kubelet and runtime directories not attributed to a pod, system files, etc.
+	OtherBytes uint64
+}
+
+// newHostUsage attributes the node filesystem of summary. The image filesystem is considered to be the node
+// filesystem if the kubelet reports the same capacity and inodes for both.
+func newHostUsage(summary *stats.Summary) *HostUsage {
+	nodeFs := summary.Node.Fs
+	var imageFs *stats.FsStats
+	if summary.Node.Runtime != nil {
+		imageFs = summary.Node.Runtime.ImageFs
+	}
+	shared := imageFs != nil && valueOf(imageFs.CapacityBytes) == valueOf(nodeFs.CapacityBytes) &&
+		valueOf(imageFs.Inodes) == valueOf(nodeFs.Inodes)
+
+	var pods, rootfs uint64
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		if pod.EphemeralStorage == nil {
+			continue
+		}
+		pods += valueOf(pod.EphemeralStorage.UsedBytes)
+		for _, container := range pod.Containers {
+			if container.Rootfs != nil {
+				rootfs += valueOf(container.Rootfs.UsedBytes)
+			}
+		}
+	}
+	usage := &HostUsage{}
+	if shared {
+		usage.PodsBytes = pods
+		// Writable layers are counted by both the image filesystem and the pods.
+		usage.RuntimeBytes = subtract(valueOf(imageFs.UsedBytes), rootfs)
+	} else {
+		usage.PodsBytes = subtract(pods, rootfs)
+	}
+	usage.OtherBytes = subtract(valueOf(nodeFs.UsedBytes), usage.PodsBytes+usage.RuntimeBytes)
+	return usage
+}
+
+func subtract(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// SummaryPodStats returns the stats of the pods of a single summary, computed like Manager.Update does without
+// the options of a Manager, for one-off readers such as the kubectl plugin. Pods without storage stats are skipped.
+func SummaryPodStats(summary *stats.Summary, keepContainers bool) []PodStat {
+	source := DetectSource(summary, "")
+	podStats := make([]PodStat, 0, len(summary.Pods))
+	for i := range summary.Pods {
+		pod := summary.Pods[i]
+		if source == SourceContainers && pod.EphemeralStorage == nil && len(pod.Containers) > 0 {
+			pod.EphemeralStorage = containersEphemeralStorage(&pod, summary.Node.Fs)
+		}
+		if pod.EphemeralStorage != nil {
+			podStats = append(podStats, newPodStat(summary.Node.NodeName, &pod, keepContainers, false))
+		}
+	}
+	return podStats
+}
+
+// NodeFsUsage returns the usage of the node filesystem of summary, nil if the kubelet did not report it.
+func NodeFsUsage(summary *stats.Summary) *FsUsage {
+	if summary.Node.Fs == nil {
+		return nil
+	}
+	return newFsUsage(summary.Node.Fs)
+}
+
+func newPodStat(nodeName string, pod *stats.PodStats, keepContainers, keepVolumes bool) PodStat {
+	fs := pod.EphemeralStorage
+	stat := PodStat{
+		NodeName:       nodeName,
+		PodName:        pod.PodRef.Name,
+		Namespace:      pod.PodRef.Namespace,
+		UID:            pod.PodRef.UID,
+		UsedBytes:      valueOf(fs.UsedBytes),
+		AvailableBytes: valueOf(fs.AvailableBytes),
+		CapacityBytes:  valueOf(fs.CapacityBytes),
+		InodesUsed:     valueOf(fs.InodesUsed),
+	}
+	if keepContainers {
+		stat.Containers = make([]ContainerStat, 0, len(pod.Containers))
+		for _, container := range pod.Containers {
+			cs := ContainerStat{Name: container.Name}
+			if container.Rootfs != nil {
+				cs.RootfsUsedBytes = valueOf(container.Rootfs.UsedBytes)
+				cs.RootfsInodesUsed = valueOf(container.Rootfs.InodesUsed)
+			}
+			if container.Logs != nil {
+				cs.LogsUsedBytes = valueOf(container.Logs.UsedBytes)
+			}
+			stat.Containers = append(stat.Containers, cs)
+		}
+	}
+	if keepVolumes {
+		stat.Volumes = make([]VolumeStat, 0, len(pod.VolumeStats))
+		for _, volume := range pod.VolumeStats {
+			vs := VolumeStat{
+				Name:       volume.Name,
+				UsedBytes:  valueOf(volume.UsedBytes),
+				InodesUsed: valueOf(volume.InodesUsed),
+			}
+			if volume.PVCRef != nil {
+				vs.PVCName = volume.PVCRef.Name
+				// The claim of a generic ephemeral volume is named after the pod and the volume. The pod spec, if
+				// known, is authoritative, see Manager.enrich.
+				vs.GenericEphemeral = vs.PVCName == pod.PodRef.Name+"-"+volume.Name
+			}
+			stat.Volumes = append(stat.Volumes, vs)
+		}
+	}
+	return stat
+}
+
+func newFsUsage(fs *stats.FsStats) *FsUsage {
+	return &FsUsage{
+		UsedBytes:      valueOf(fs.UsedBytes),
+		AvailableBytes: valueOf(fs.AvailableBytes),
+		CapacityBytes:  valueOf(fs.CapacityBytes),
+		InodesUsed:     valueOf(fs.InodesUsed),
+		Inodes:         valueOf(fs.Inodes),
+	}
+}
+
+func valueOf(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+// ScrapeLoopRestarts counts the collection loops restarted by the watchdog, see Options.WatchdogIntervals.
+var ScrapeLoopRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "scrape_loop_restarts_total",
+	Help:      "Number of collection loops restarted because they did not complete a cycle in time, e.g. on a hung request",
+})
+
+// watch runs loop until ctx is done and restarts it if it does not call beat for stall. A restart cancels the
+// context of the stalled loop, which aborts its requests, and runs loop again; the stalled loop must return once
+// its context is done.
+func watch(ctx context.Context, stall time.Duration, loop func(ctx context.Context, beat func()), keysAndValues ...interface{}) {
+	var last atomic.Int64
+	beat := func() { last.Store(time.Now().UnixNano()) }
+	ticker := time.NewTicker(stall / 4)
+	defer ticker.Stop()
+
+	for {
+		beat()
+		loopCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			loop(loopCtx, beat)
+		}()
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case <-done:
+				cancel()
+				return
+			case <-ticker.C:
+				if since := time.Since(time.Unix(0, last.Load())); since > stall {
+					klog.InfoS("Restarting stalled collection loop", append(keysAndValues, "sinceLastCycle", since)...)
+					ScrapeLoopRestarts.Inc()
+					cancel()
+					break wait
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Agent pushes the snapshots of a provider to an aggregator.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Agent struct {
+	addr     string
+	provider provider.Provider
+	interval time.Duration
+	dialOpts []grpc.DialOption
+}
+
+// NewAgent returns an agent that pushes the snapshots of p that are new since the last push, every interval.
+// dialOpts are the options of the connection, which must include its credentials, see Security.DialOptions, and may
+// add e.g. a dialer through a proxy.
+func NewAgent(addr string, p provider.Provider, interval time.Duration, dialOpts ...grpc.DialOption) *Agent {
+	return &Agent{addr: addr, provider: p, interval: interval, dialOpts: dialOpts}
+}
+
+// Start pushes snapshots until ctx is done. The stream is opened again after an error.
+func (a *Agent) Start(ctx context.Context) error {
+	opts := append([]grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{}))}, a.dialOpts...)
+	conn, err := grpc.DialContext(ctx, a.addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		if err := a.stream(ctx, conn); err != nil && ctx.Err() == nil {
+			klog.ErrorS(err, "Failed to push snapshots", "aggregator", a.addr)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.interval):
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every agent pushes its own node.
+func (a *Agent) NeedLeaderElection() bool {
+	return false
+}
+
+// stream pushes snapshots on a new stream until ctx is done or the stream fails. The most recent snapshots are
+// pushed first, as the aggregator may be a different replica than on the previous stream.
+func (a *Agent) stream(ctx context.Context, conn *grpc.ClientConn) error {
+	stream, err := conn.NewStream(ctx, &pushStreamDesc, pushMethod)
+	if err != nil {
+		return err
+	}
+	pushed := map[string]time.Time{}
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		for _, snapshot := range a.provider.Snapshots() {
+			if pushed[snapshot.Node.NodeName].Equal(snapshot.Time) {
+				continue
+			}
+			if err := stream.SendMsg(snapshot); err != nil {
+				if errors.Is(err, io.EOF) {
+					// The aggregator closed the stream, e.g. rejected its credentials, with a status received by RecvMsg.
+					err = stream.RecvMsg(&ack{})
+				}
+				return err
+			}
+			pushed[snapshot.Node.NodeName] = snapshot.Time
+		}
+		select {
+		case <-ctx.Done():
+			// The stream is canceled with ctx.
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
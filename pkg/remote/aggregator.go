@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Aggregator receives the snapshots pushed by agents and provides the most recent one of every node.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Aggregator struct {
+	addr     string
+	ttl      time.Duration
+	grpcOpts []grpc.ServerOption
+
+	lock      sync.RWMutex
+	snapshots map[string]received
+}
+
+type received struct {
+	snapshot *provider.Snapshot
+	at       time.Time
+}
+
+var (
+	_ provider.Provider = &Aggregator{}
+	_ aggregatorServer  = &Aggregator{}
+)
+
+// NewAggregator returns an aggregator listening on addr. Nodes whose agent pushed nothing for ttl are dropped.
+// grpcOpts are the options of the server, which must include its credentials, see Security.ServerOptions.
+func NewAggregator(addr string, ttl time.Duration, grpcOpts ...grpc.ServerOption) *Aggregator {
+	return &Aggregator{
+		addr:      addr,
+		ttl:       ttl,
+		grpcOpts:  grpcOpts,
+		snapshots: map[string]received{},
+	}
+}
+
+// Start serves agents until ctx is done.
+func (a *Aggregator) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(append([]grpc.ServerOption{grpc.ForceServerCodec(jsonCodec{})}, a.grpcOpts...)...)
+	srv.RegisterService(&serviceDesc, a)
+
+	errCh := make(chan error, 1)
+	go func() {
+		klog.Infof("Listening for agents on %s", a.addr)
+		errCh <- srv.Serve(lis)
+	}()
+	select {
+	case <-ctx.Done():
+		srv.GracefulStop()
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, agents push to every replica they reach.
+func (a *Aggregator) NeedLeaderElection() bool {
+	return false
+}
+
+func (a *Aggregator) push(stream grpc.ServerStream) error {
+	for {
+		snapshot := &provider.Snapshot{}
+		err := stream.RecvMsg(snapshot)
+		if errors.Is(err, io.EOF) {
+			return stream.SendMsg(&ack{})
+		}
+		if err != nil {
+			return err
+		}
+		if snapshot.Node.NodeName == "" {
+			klog.Warning("Dropping snapshot pushed without node name")
+			continue
+		}
+		klog.V(4).Infof("Received snapshot of node %s", snapshot.Node.NodeName)
+		a.lock.Lock()
+		a.snapshots[snapshot.Node.NodeName] = received{snapshot: snapshot, at: time.Now()}
+		a.lock.Unlock()
+	}
+}
+
+// Snapshots implements provider.Provider. Snapshots are sorted by node name.
+func (a *Aggregator) Snapshots() []*provider.Snapshot {
+	now := time.Now()
+	a.lock.Lock()
+	snapshots := make([]*provider.Snapshot, 0, len(a.snapshots))
+	for node, r := range a.snapshots {
+		if now.Sub(r.at) > a.ttl {
+			klog.V(1).Infof("Dropping node %s, its agent pushed nothing for %v", node, a.ttl)
+			delete(a.snapshots, node)
+			continue
+		}
+		snapshots = append(snapshots, r.snapshot)
+	}
+	a.lock.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Node.NodeName < snapshots[j].Node.NodeName
+	})
+	return snapshots
+}
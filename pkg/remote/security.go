@@ -0,0 +1,122 @@
+package remote
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"k8s-ephemeral-storage-metrics/pkg/transport"
+)
+
+// Security are the credentials of the connection between agents and the aggregator.
+type Security struct {
+	// Insecure connects over plaintext without authentication. The other fields are ignored.
+	Insecure bool
+	// CertFile and KeyFile are the PEM certificate chain and private key the aggregator serves, or the client
+	// certificate of agents for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// CAFile contains the PEM CA certificates verifying the aggregator on agents, the system roots when empty, and
+	// the client certificates of agents on the aggregator, which then requires one.
+	CAFile string
+	// Token is the bearer token agents send and the aggregator requires. Not checked when empty.
+	Token string
+	// Policy restricts the TLS versions and cipher suites of the connection.
+	Policy transport.TLSPolicy
+}
+
+// ServerOptions returns the options of the gRPC server of the aggregator.
+func (s Security) ServerOptions() ([]grpc.ServerOption, error) {
+	if s.Insecure {
+		return []grpc.ServerOption{grpc.Creds(insecure.NewCredentials())}, nil
+	}
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RootCAs != nil {
+		cfg.ClientCAs, cfg.RootCAs = cfg.RootCAs, nil
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	opts := []grpc.ServerOption{grpc.Creds(credentials.NewTLS(cfg))}
+	if s.Token != "" {
+		opts = append(opts, grpc.StreamInterceptor(tokenInterceptor(s.Token)))
+	}
+	return opts, nil
+}
+
+// DialOptions returns the options of the gRPC connection of agents.
+func (s Security) DialOptions() ([]grpc.DialOption, error) {
+	if s.Insecure {
+		return []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, nil
+	}
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(cfg))}
+	if s.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(s.Token)))
+	}
+	return opts, nil
+}
+
+func (s Security) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{}
+	s.Policy.Apply(cfg)
+	if s.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gRPC certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if s.CAFile != "" {
+		content, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gRPC CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no PEM certificate in %s", s.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// tokenCredentials sends a bearer token with every stream, over TLS only.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// tokenInterceptor rejects the streams without the bearer token.
+func tokenInterceptor(token string) grpc.StreamServerInterceptor {
+	expected := []byte(token)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		for _, value := range md.Get("authorization") {
+			if strings.HasPrefix(value, "Bearer ") && subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(value, "Bearer ")), expected) == 1 {
+				return handler(srv, stream)
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+}
@@ -0,0 +1,53 @@
+package remote
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+// The service exchanges provider.Snapshot values encoded as JSON instead of protobuf messages, so that the
+// snapshot types stay plain Go structs and no generated code is needed. Both sides force the codec.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// ack is the reply of the aggregator when an agent closes its stream.
+type ack struct{}
+
+const (
+	serviceName = "ephemeralstorage.v1.Aggregator"
+	pushMethod  = "/" + serviceName + "/Push"
+)
+
+// pushStreamDesc describes Push, a client stream of the snapshots of the node of an agent.
+var pushStreamDesc = grpc.StreamDesc{
+	StreamName:    "Push",
+	ClientStreams: true,
+}
+
+type aggregatorServer interface {
+	push(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*aggregatorServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    pushStreamDesc.StreamName,
+		ClientStreams: pushStreamDesc.ClientStreams,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(aggregatorServer).push(stream)
+		},
+	}},
+}
@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// maxExecStderr bounds the standard error of a command kept for the error of a failed push.
+const maxExecStderr = 4096
+
+// Exec runs a command on every push with the stats of the nodes as JSON on its standard input, so that proprietary
+// sinks, e.g. the client of an internal TSDB, are written in any language and shipped next to the exporter instead
+// of compiled into it. The push fails if the command exits with a non-zero code, or is killed when the push is
+// canceled. The standard output is discarded and the end of the standard error is in the error.
+type Exec struct {
+	command []string
+}
+
+// NewExec returns a sink running command, its executable followed by its arguments.
+func NewExec(command []string) *Exec {
+	return &Exec{command: command}
+}
+
+func (e *Exec) Name() string {
+	return "exec"
+}
+
+// ExecInput is the standard input of the commands of Exec.
+type ExecInput struct {
+	Time  time.Time  `json:"time"`
+	Nodes []ExecNode `json:"nodes"`
+}
+
+// ExecNode is the stats of a node in ExecInput. SummaryTime is the time of the stats, absent if no stat summary
+// request succeeded yet, and NodeFs and ImageFs are absent if the kubelet did not report them.
+type ExecNode struct {
+	Name        string     `json:"name"`
+	Up          bool       `json:"up"`
+	SummaryTime *time.Time `json:"summaryTime,omitempty"`
+	NodeFs      *ExecFs    `json:"nodeFs,omitempty"`
+	ImageFs     *ExecFs    `json:"imageFs,omitempty"`
+	Pods        []ExecPod  `json:"pods"`
+}
+
+type ExecFs struct {
+	UsedBytes      uint64 `json:"usedBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+	CapacityBytes  uint64 `json:"capacityBytes"`
+	InodesUsed     uint64 `json:"inodesUsed"`
+	Inodes         uint64 `json:"inodes"`
+}
+
+type ExecPod struct {
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	UID            string `json:"uid"`
+	UsedBytes      uint64 `json:"usedBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+	CapacityBytes  uint64 `json:"capacityBytes"`
+	InodesUsed     uint64 `json:"inodesUsed"`
+}
+
+// Push implements Sink.
+func (e *Exec) Push(ctx context.Context, snapshots []*provider.Snapshot) error {
+	input, err := json.Marshal(NewExecInput(snapshots, time.Now()))
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		out := stderr.Bytes()
+		if len(out) > maxExecStderr {
+			out = out[len(out)-maxExecStderr:]
+		}
+		return fmt.Errorf("%s: %v: %s", e.command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NewExecInput returns the input of the commands of Exec for snapshots at now.
+func NewExecInput(snapshots []*provider.Snapshot, now time.Time) ExecInput {
+	input := ExecInput{Time: now, Nodes: make([]ExecNode, 0, len(snapshots))}
+	for _, snapshot := range snapshots {
+		node := ExecNode{Name: snapshot.Node.NodeName, Up: snapshot.Node.Up, NodeFs: execFs(snapshot.NodeFs), ImageFs: execFs(snapshot.ImageFs),
+			Pods: make([]ExecPod, 0, len(snapshot.Pods))}
+		if !snapshot.SummaryTime.IsZero() {
+			summaryTime := snapshot.SummaryTime
+			node.SummaryTime = &summaryTime
+		}
+		for i := range snapshot.Pods {
+			stat := &snapshot.Pods[i]
+			node.Pods = append(node.Pods, ExecPod{Namespace: stat.Namespace, Name: stat.PodName, UID: stat.UID, UsedBytes: stat.UsedBytes,
+				AvailableBytes: stat.AvailableBytes, CapacityBytes: stat.CapacityBytes, InodesUsed: stat.InodesUsed})
+		}
+		input.Nodes = append(input.Nodes, node)
+	}
+	return input
+}
+
+func execFs(fs *provider.FsUsage) *ExecFs {
+	if fs == nil {
+		return nil
+	}
+	return &ExecFs{UsedBytes: fs.UsedBytes, AvailableBytes: fs.AvailableBytes, CapacityBytes: fs.CapacityBytes, InodesUsed: fs.InodesUsed, Inodes: fs.Inodes}
+}
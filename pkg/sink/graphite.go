@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Graphite pushes the series of a gatherer to the plaintext listener of a carbon server, for monitoring stacks
+// that aggregate node metrics with carbon. It pushes the series, with the metric names of the config file and
+// the derived metrics, rather than the snapshots it is given. A series becomes the path
+// <prefix>.<metric>.<label>.<value>..., its labels sorted by name.
+type Graphite struct {
+	bridge *graphite.Bridge
+}
+
+// NewGraphite returns a sink pushing the series of gatherer to addr, a host:port, within timeout. Paths start with
+// prefix if it is not empty.
+func NewGraphite(addr, prefix string, timeout time.Duration, gatherer prometheus.Gatherer) (*Graphite, error) {
+	bridge, err := graphite.NewBridge(&graphite.Config{
+		URL:           addr,
+		Prefix:        prefix,
+		Timeout:       timeout,
+		Gatherer:      gatherer,
+		ErrorHandling: graphite.ContinueOnError,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Graphite{bridge: bridge}, nil
+}
+
+func (g *Graphite) Name() string {
+	return "graphite"
+}
+
+// Push implements Sink. The bridge dials with its own timeout, ctx is not used.
+func (g *Graphite) Push(context.Context, []*provider.Snapshot) error {
+	return g.bridge.Push()
+}
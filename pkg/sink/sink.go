@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Sink receives the stats of the nodes, e.g. to push them to a monitoring system the exporter does not expose
+// metrics to, so that organizations add their own without patching the exporter.
+type Sink interface {
+	// Name identifies the sink in logs and in the sink label of PushFailures. It must not change.
+	Name() string
+	// Push sends snapshots, the most recent one of every node. It is called by a single Runner, must return once
+	// ctx is done, and must not modify the snapshots.
+	Push(ctx context.Context, snapshots []*provider.Snapshot) error
+}
+
+// RegisteredSink is a sink registered with Register and the interval of its pushes.
+type RegisteredSink struct {
+	Sink     Sink
+	Interval time.Duration
+}
+
+var sinks []RegisteredSink
+
+// Register registers a sink run by the exporter every interval, usually from an init function of a package imported
+// by a fork. It must be called before flags are parsed. Embedders run the sink with NewRunner instead.
+func Register(s Sink, interval time.Duration) {
+	sinks = append(sinks, RegisteredSink{Sink: s, Interval: interval})
+	PushFailures.WithLabelValues(s.Name())
+}
+
+// Registered returns the registered sinks, in the order of registration.
+func Registered() []RegisteredSink {
+	return sinks
+}
+
+// PushFailures counts the pushes to sinks that failed, by sink.
+var PushFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "sink_push_failures_total",
+	Help:      "Number of pushes to a sink that failed, by sink",
+}, []string{"sink"})
+
+func init() {
+	PushFailures.WithLabelValues("graphite")
+	PushFailures.WithLabelValues("zabbix")
+	PushFailures.WithLabelValues("exec")
+}
+
+// Runner pushes the snapshots of providers to a sink every interval. A failed push is logged, counted in
+// PushFailures and not retried before the next interval; a push is canceled after an interval.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Runner struct {
+	sink      Sink
+	interval  time.Duration
+	providers []provider.Provider
+}
+
+// NewRunner returns a runner of s pushing the snapshots of providers every interval.
+func NewRunner(s Sink, interval time.Duration, providers ...provider.Provider) *Runner {
+	return &Runner{sink: s, interval: interval, providers: providers}
+}
+
+// Start pushes the snapshots every interval until ctx is done.
+func (r *Runner) Start(ctx context.Context) error {
+	klog.InfoS("Pushing to sink", "sink", r.sink.Name(), "interval", r.interval)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.push(ctx)
+		}
+	}
+}
+
+func (r *Runner) push(ctx context.Context) {
+	var snapshots []*provider.Snapshot
+	for _, p := range r.providers {
+		snapshots = append(snapshots, p.Snapshots()...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+	if err := r.sink.Push(ctx, snapshots); err != nil {
+		PushFailures.WithLabelValues(r.sink.Name()).Inc()
+		klog.ErrorS(err, "Failed to push to sink", "sink", r.sink.Name())
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. With -cluster, only the leader has stats to push.
+func (r *Runner) NeedLeaderElection() bool {
+	return true
+}
@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Keys of the items sent to Zabbix. Pod items take the namespace and name of the pod as parameters, e.g.
+// ephemeral_storage.pod.used_bytes[default,web-0], and are created by the prototypes of the discovery rule
+// ZabbixDiscoveryKey from the macros {#NAMESPACE} and {#POD}.
+const (
+	ZabbixDiscoveryKey         = "ephemeral_storage.pod.discovery"
+	ZabbixPodUsedBytesKey      = "ephemeral_storage.pod.used_bytes"
+	ZabbixNodeUsedBytesKey     = "ephemeral_storage.node.used_bytes"
+	ZabbixNodeAvailableKey     = "ephemeral_storage.node.available_bytes"
+	ZabbixNodeCapacityKey      = "ephemeral_storage.node.capacity_bytes"
+	ZabbixNodePodsUsedBytesKey = "ephemeral_storage.node.pods_used_bytes"
+)
+
+const (
+	// zabbixRediscovery is the interval at which the discovery is sent again although the pods did not change, so
+	// that a restarted Zabbix server or a new template catches up.
+	zabbixRediscovery = time.Hour
+	// zabbixMaxResponse bounds the response of the server, a short JSON.
+	zabbixMaxResponse = 1 << 16
+)
+
+// zabbixHeader starts the packets of the Zabbix sender protocol, followed by the little endian length of the data
+// in 8 bytes.
+var zabbixHeader = []byte("ZBXD\x01")
+
+// Zabbix sends the ephemeral storage of the nodes and pods to the trapper of a Zabbix server or proxy, like
+// zabbix_sender. Each node is the Zabbix host of its name. Pods are sent as low-level discovery, whenever they change
+// and at least hourly, and as items of the discovered prototypes.
+type Zabbix struct {
+	addr string
+
+	// discovered is the last discovery sent by host, and discoveredAt its time.
+	discovered   map[string]string
+	discoveredAt map[string]time.Time
+}
+
+// NewZabbix returns a sink sending to addr, a host:port.
+func NewZabbix(addr string) *Zabbix {
+	return &Zabbix{addr: addr, discovered: map[string]string{}, discoveredAt: map[string]time.Time{}}
+}
+
+func (z *Zabbix) Name() string {
+	return "zabbix"
+}
+
+type zabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []zabbixItem `json:"data"`
+	Clock   int64        `json:"clock"`
+}
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// Push implements Sink.
+func (z *Zabbix) Push(ctx context.Context, snapshots []*provider.Snapshot) error {
+	now := time.Now()
+	items := z.items(snapshots, now)
+	if len(items) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(zabbixRequest{Request: "sender data", Data: items, Clock: now.Unix()})
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", z.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(zabbixPacket(payload)); err != nil {
+		return err
+	}
+	response, err := readZabbixPacket(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	var result zabbixResponse
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("failed to decode response %q: %v", response, err)
+	}
+	if result.Response != "success" {
+		return fmt.Errorf("server responded %q: %s", result.Response, result.Info)
+	}
+	// Items of hosts or keys unknown to the server are counted as failed, e.g. before the template is linked.
+	klog.V(1).InfoS("Sent metrics to zabbix", "address", z.addr, "items", len(items), "info", result.Info)
+	return nil
+}
+
+// items returns the discovery, pod and node items of snapshots. Discoveries are only included if the pods of the
+// host changed or the last one is older than zabbixRediscovery.
+func (z *Zabbix) items(snapshots []*provider.Snapshot, now time.Time) []zabbixItem {
+	var items []zabbixItem
+	clock := now.Unix()
+	for _, snapshot := range snapshots {
+		if snapshot.SummaryTime.IsZero() {
+			continue
+		}
+		host := snapshot.Node.NodeName
+		add := func(key string, value uint64) {
+			items = append(items, zabbixItem{Host: host, Key: key, Value: strconv.FormatUint(value, 10), Clock: clock})
+		}
+
+		if discovery := zabbixDiscovery(snapshot.Pods); discovery != z.discovered[host] || now.Sub(z.discoveredAt[host]) >= zabbixRediscovery {
+			items = append(items, zabbixItem{Host: host, Key: ZabbixDiscoveryKey, Value: discovery, Clock: clock})
+			z.discovered[host], z.discoveredAt[host] = discovery, now
+		}
+		var podsUsed uint64
+		for i := range snapshot.Pods {
+			stat := &snapshot.Pods[i]
+			podsUsed += stat.UsedBytes
+			add(fmt.Sprintf("%s[%s,%s]", ZabbixPodUsedBytesKey, stat.Namespace, stat.PodName), stat.UsedBytes)
+		}
+		add(ZabbixNodePodsUsedBytesKey, podsUsed)
+		if fs := snapshot.NodeFs; fs != nil {
+			add(ZabbixNodeUsedBytesKey, fs.UsedBytes)
+			add(ZabbixNodeAvailableKey, fs.AvailableBytes)
+			add(ZabbixNodeCapacityKey, fs.CapacityBytes)
+		}
+	}
+	return items
+}
+
+// zabbixDiscovery returns the low-level discovery of pods, sorted so that it only changes with the pods.
+func zabbixDiscovery(pods []provider.PodStat) string {
+	type macros struct {
+		Namespace string `json:"{#NAMESPACE}"`
+		Pod       string `json:"{#POD}"`
+	}
+	data := make([]macros, 0, len(pods))
+	for i := range pods {
+		data = append(data, macros{Namespace: pods[i].Namespace, Pod: pods[i].PodName})
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Namespace != data[j].Namespace {
+			return data[i].Namespace < data[j].Namespace
+		}
+		return data[i].Pod < data[j].Pod
+	})
+	out, _ := json.Marshal(struct {
+		Data []macros `json:"data"`
+	}{Data: data})
+	return string(out)
+}
+
+func zabbixPacket(payload []byte) []byte {
+	packet := make([]byte, 0, len(zabbixHeader)+8+len(payload))
+	packet = append(packet, zabbixHeader...)
+	packet = binary.LittleEndian.AppendUint64(packet, uint64(len(payload)))
+	return append(packet, payload...)
+}
+
+func readZabbixPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(zabbixHeader)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(zabbixHeader)], zabbixHeader) {
+		return nil, fmt.Errorf("unexpected header %q", header[:len(zabbixHeader)])
+	}
+	length := binary.LittleEndian.Uint64(header[len(zabbixHeader):])
+	if length > zabbixMaxResponse {
+		return nil, fmt.Errorf("response of %d bytes exceeds %d", length, zabbixMaxResponse)
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
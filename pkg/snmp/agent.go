@@ -0,0 +1,351 @@
+package snmp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// BaseOID is the OID of EPHEMERAL-STORAGE-MIB, below netSnmpPlaypen, the experimental subtree of the Net-SNMP
+// enterprise.
+var BaseOID = OID{1, 3, 6, 1, 4, 1, 8072, 9999, 9999, 1}
+
+// Objects of EPHEMERAL-STORAGE-MIB, below BaseOID. The columns of esNodeTable are indexed by the position of the
+// node in the order of node names, starting at 1.
+var (
+	esNodeCount = BaseOID.Append(1, 1)
+	esNodeEntry = BaseOID.Append(1, 2, 1)
+)
+
+// Columns of esNodeEntry. Column 1 is esNodeIndex, which is not accessible.
+const (
+	esNodeName = iota + 2
+	esNodeKubeletUp
+	esNodeFsCapacity
+	esNodeFsAvailable
+	esNodeFsUsed
+	esNodeImageFsCapacity
+	esNodeImageFsAvailable
+	esNodeImageFsUsed
+	esNodePodsUsed
+	esNodePods
+)
+
+const (
+	// maxRepetitions bounds the max-repetitions of GetBulkRequest, and maxVarBinds the variable bindings of a
+	// response, so that responses fit in a UDP datagram.
+	maxRepetitions = 64
+	maxVarBinds    = 512
+	// errorNotWritable is the error-status of SetRequest, all objects are read-only.
+	errorNotWritable = 17
+	// version2c is the version field of SNMPv2c messages.
+	version2c = 1
+)
+
+// Outcomes of requests, see Requests.
+const (
+	RequestOK           = "ok"
+	RequestBadCommunity = "bad_community"
+	RequestMalformed    = "malformed"
+)
+
+// Requests counts the SNMP requests of the agent, by result.
+var Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ephemeral_storage",
+	Name:      "snmp_requests_total",
+	Help:      "Number of SNMP requests of the agent, by result: ok, bad_community or malformed",
+}, []string{"result"})
+
+func init() {
+	for _, result := range []string{RequestOK, RequestBadCommunity, RequestMalformed} {
+		Requests.WithLabelValues(result)
+	}
+}
+
+var errBadCommunity = errors.New("bad community")
+
+// Agent serves the node figures of providers in EPHEMERAL-STORAGE-MIB to SNMPv2c GetRequest, GetNextRequest and
+// GetBulkRequest, for network management systems of appliance deployments that poll SNMP only. Requests with another
+// community are dropped, SetRequest gets notWritable.
+// It implements manager.Runnable so it can be added to a controller-runtime manager.
+type Agent struct {
+	addr      string
+	community []byte
+	providers []provider.Provider
+}
+
+// NewAgent returns an agent listening on the UDP address addr, e.g. :161, and answering requests of community.
+func NewAgent(addr, community string, providers ...provider.Provider) *Agent {
+	return &Agent{addr: addr, community: []byte(community), providers: providers}
+}
+
+// Start serves requests until ctx is done.
+func (a *Agent) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", a.addr)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Serving SNMP", "address", conn.LocalAddr())
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		response, err := a.handle(buf[:n])
+		switch {
+		case errors.Is(err, errBadCommunity):
+			Requests.WithLabelValues(RequestBadCommunity).Inc()
+			klog.V(2).InfoS("Dropped SNMP request with a bad community", "remote", addr)
+			continue
+		case err != nil:
+			Requests.WithLabelValues(RequestMalformed).Inc()
+			klog.V(2).InfoS("Dropped malformed SNMP request", "remote", addr, "err", err)
+			continue
+		}
+		Requests.WithLabelValues(RequestOK).Inc()
+		if _, err := conn.WriteTo(response, addr); err != nil {
+			klog.V(1).InfoS("Failed to send SNMP response", "remote", addr, "err", err)
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. With -cluster, only the leader has stats to serve.
+func (a *Agent) NeedLeaderElection() bool {
+	return true
+}
+
+// object is an instance of the MIB with its encoded value.
+type object struct {
+	oid   OID
+	tag   byte
+	value []byte
+}
+
+// objects returns the instances of the MIB for the current snapshots, sorted by OID.
+func (a *Agent) objects() []object {
+	var snapshots []*provider.Snapshot
+	for _, p := range a.providers {
+		snapshots = append(snapshots, p.Snapshots()...)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Node.NodeName < snapshots[j].Node.NodeName })
+
+	objects := []object{{oid: esNodeCount.Append(0), tag: tagGauge32, value: encodeUint(uint64(len(snapshots)))}}
+	for i, snapshot := range snapshots {
+		index := uint32(i + 1)
+		add := func(column uint32, tag byte, value []byte) {
+			objects = append(objects, object{oid: esNodeEntry.Append(column, index), tag: tag, value: value})
+		}
+		up := int64(2)
+		if snapshot.Node.Up {
+			up = 1
+		}
+		var podsUsed uint64
+		for j := range snapshot.Pods {
+			podsUsed += snapshot.Pods[j].UsedBytes
+		}
+		add(esNodeName, tagOctetString, []byte(snapshot.Node.NodeName))
+		add(esNodeKubeletUp, tagInteger, encodeInt(up))
+		if fs := snapshot.NodeFs; fs != nil {
+			add(esNodeFsCapacity, tagCounter64, encodeUint(fs.CapacityBytes))
+			add(esNodeFsAvailable, tagCounter64, encodeUint(fs.AvailableBytes))
+			add(esNodeFsUsed, tagCounter64, encodeUint(fs.UsedBytes))
+		}
+		if fs := snapshot.ImageFs; fs != nil {
+			add(esNodeImageFsCapacity, tagCounter64, encodeUint(fs.CapacityBytes))
+			add(esNodeImageFsAvailable, tagCounter64, encodeUint(fs.AvailableBytes))
+			add(esNodeImageFsUsed, tagCounter64, encodeUint(fs.UsedBytes))
+		}
+		add(esNodePodsUsed, tagCounter64, encodeUint(podsUsed))
+		add(esNodePods, tagGauge32, encodeUint(uint64(len(snapshot.Pods))))
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].oid.Compare(objects[j].oid) < 0 })
+	return objects
+}
+
+// handle decodes a request and returns its response.
+func (a *Agent) handle(packet []byte) ([]byte, error) {
+	message, _, err := expect(packet, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	version, rest, err := expect(message.value, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := decodeInt(version.value); err != nil || v != version2c {
+		return nil, fmt.Errorf("unsupported version %x, only SNMPv2c is", version.value)
+	}
+	community, rest, err := expect(rest, tagOctetString)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(community.value, a.community) != 1 {
+		return nil, errBadCommunity
+	}
+	pdu, _, err := readTLV(rest)
+	if err != nil {
+		return nil, err
+	}
+	requestID, rest, err := expect(pdu.value, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	first, rest, err := expect(rest, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	second, rest, err := expect(rest, tagInteger)
+	if err != nil {
+		return nil, err
+	}
+	names, err := decodeNames(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	var errorStatus, errorIndex int64
+	var bindings []object
+	switch pdu.tag {
+	case tagGetRequest:
+		objects := a.objects()
+		for _, name := range names {
+			bindings = append(bindings, get(objects, name))
+		}
+	case tagGetNextRequest:
+		objects := a.objects()
+		for _, name := range names {
+			bindings = append(bindings, next(objects, name))
+		}
+	case tagGetBulkRequest:
+		nonRepeaters, _ := decodeInt(first.value)
+		repetitions, _ := decodeInt(second.value)
+		bindings = bulk(a.objects(), names, nonRepeaters, repetitions)
+	case tagSetRequest:
+		errorStatus, errorIndex = errorNotWritable, 1
+		for _, name := range names {
+			bindings = append(bindings, object{oid: name, tag: tagNull})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PDU 0x%02x", pdu.tag)
+	}
+
+	var varBinds []byte
+	for _, binding := range bindings {
+		varBind := appendTLV(nil, tagOID, encodeOID(binding.oid))
+		varBind = appendTLV(varBind, binding.tag, binding.value)
+		varBinds = appendTLV(varBinds, tagSequence, varBind)
+	}
+	response := appendTLV(nil, tagInteger, requestID.value)
+	response = appendTLV(response, tagInteger, encodeInt(errorStatus))
+	response = appendTLV(response, tagInteger, encodeInt(errorIndex))
+	response = appendTLV(response, tagSequence, varBinds)
+
+	out := appendTLV(nil, tagInteger, version.value)
+	out = appendTLV(out, tagOctetString, community.value)
+	out = appendTLV(out, tagResponse, response)
+	return appendTLV(nil, tagSequence, out), nil
+}
+
+// decodeNames returns the names of the variable bindings of a request, whose values are ignored.
+func decodeNames(b []byte) ([]OID, error) {
+	list, _, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	var names []OID
+	for rest := list.value; len(rest) > 0; {
+		var varBind tlv
+		if varBind, rest, err = expect(rest, tagSequence); err != nil {
+			return nil, err
+		}
+		name, _, err := expect(varBind.value, tagOID)
+		if err != nil {
+			return nil, err
+		}
+		oid, err := decodeOID(name.value)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == maxVarBinds {
+			return nil, fmt.Errorf("more than %d variable bindings", maxVarBinds)
+		}
+		names = append(names, oid)
+	}
+	return names, nil
+}
+
+// get returns the instance name, or noSuchInstance if name is below an object of the MIB and noSuchObject otherwise.
+func get(objects []object, name OID) object {
+	i := sort.Search(len(objects), func(i int) bool { return objects[i].oid.Compare(name) >= 0 })
+	if i < len(objects) && objects[i].oid.Compare(name) == 0 {
+		return objects[i]
+	}
+	if name.HasPrefix(esNodeCount) || (name.HasPrefix(esNodeEntry) && len(name) > len(esNodeEntry) &&
+		name[len(esNodeEntry)] >= esNodeName && name[len(esNodeEntry)] <= esNodePods) {
+		return object{oid: name, tag: tagNoSuchInstance}
+	}
+	return object{oid: name, tag: tagNoSuchObject}
+}
+
+// next returns the first instance after name, or endOfMibView.
+func next(objects []object, name OID) object {
+	i := sort.Search(len(objects), func(i int) bool { return objects[i].oid.Compare(name) > 0 })
+	if i < len(objects) {
+		return objects[i]
+	}
+	return object{oid: name, tag: tagEndOfMibView}
+}
+
+// bulk returns the response of GetBulkRequest: the next instance of the first nonRepeaters names, then up to
+// repetitions next instances of each other name, interleaved.
+func bulk(objects []object, names []OID, nonRepeaters, repetitions int64) []object {
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	if nonRepeaters > int64(len(names)) {
+		nonRepeaters = int64(len(names))
+	}
+	if repetitions < 0 {
+		repetitions = 0
+	}
+	if repetitions > maxRepetitions {
+		repetitions = maxRepetitions
+	}
+	var bindings []object
+	for _, name := range names[:nonRepeaters] {
+		bindings = append(bindings, next(objects, name))
+	}
+	repeaters := append([]OID(nil), names[nonRepeaters:]...)
+	for r := int64(0); r < repetitions && len(repeaters) > 0; r++ {
+		done := true
+		for i, name := range repeaters {
+			if len(bindings) == maxVarBinds {
+				return bindings
+			}
+			binding := next(objects, name)
+			bindings = append(bindings, binding)
+			repeaters[i] = binding.oid
+			done = done && binding.tag == tagEndOfMibView
+		}
+		if done {
+			break
+		}
+	}
+	return bindings
+}
@@ -0,0 +1,219 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the SNMP types the agent reads and writes, see RFC 3416.
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagGauge32        = 0x42
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	tagGetRequest     = 0xa0
+	tagGetNextRequest = 0xa1
+	tagResponse       = 0xa2
+	tagSetRequest     = 0xa3
+	tagGetBulkRequest = 0xa5
+)
+
+var errTruncated = errors.New("truncated message")
+
+// OID is an object identifier, e.g. 1.3.6.1.
+type OID []uint32
+
+func (o OID) String() string {
+	parts := make([]string, len(o))
+	for i, arc := range o {
+		parts[i] = strconv.FormatUint(uint64(arc), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Compare returns -1, 0 or 1 if o is before, equal to or after other in the lexicographic order of the MIB.
+func (o OID) Compare(other OID) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		switch {
+		case o[i] < other[i]:
+			return -1
+		case o[i] > other[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(o) < len(other):
+		return -1
+	case len(o) > len(other):
+		return 1
+	}
+	return 0
+}
+
+// HasPrefix reports whether prefix is o or an ancestor of o.
+func (o OID) HasPrefix(prefix OID) bool {
+	return len(o) >= len(prefix) && o[:len(prefix)].Compare(prefix) == 0
+}
+
+// Append returns a new OID of o followed by arcs.
+func (o OID) Append(arcs ...uint32) OID {
+	oid := make(OID, 0, len(o)+len(arcs))
+	return append(append(oid, o...), arcs...)
+}
+
+// tlv is a decoded BER element.
+type tlv struct {
+	tag   byte
+	value []byte
+}
+
+// readTLV decodes the element at the start of b and returns the rest of b.
+func readTLV(b []byte) (tlv, []byte, error) {
+	if len(b) < 2 {
+		return tlv{}, nil, errTruncated
+	}
+	tag, length, b := b[0], int(b[1]), b[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(b) < n {
+			return tlv{}, nil, fmt.Errorf("unsupported length of %d bytes", n)
+		}
+		length = 0
+		for _, c := range b[:n] {
+			length = length<<8 | int(c)
+		}
+		b = b[n:]
+	}
+	if len(b) < length {
+		return tlv{}, nil, errTruncated
+	}
+	return tlv{tag: tag, value: b[:length]}, b[length:], nil
+}
+
+// expect decodes the element at the start of b, which must have tag.
+func expect(b []byte, tag byte) (tlv, []byte, error) {
+	e, rest, err := readTLV(b)
+	if err == nil && e.tag != tag {
+		err = fmt.Errorf("expected tag 0x%02x, got 0x%02x", tag, e.tag)
+	}
+	return e, rest, err
+}
+
+func decodeInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, fmt.Errorf("invalid integer of %d bytes", len(b))
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func decodeOID(b []byte) (OID, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty OID")
+	}
+	var arcs []uint32
+	var arc uint64
+	for i, c := range b {
+		arc = arc<<7 | uint64(c&0x7f)
+		if arc > 1<<32-1 {
+			return nil, errors.New("OID arc overflows 32 bits")
+		}
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, errTruncated
+			}
+			continue
+		}
+		if len(arcs) == 0 {
+			first := arc / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, uint32(first), uint32(arc-40*first))
+		} else {
+			arcs = append(arcs, uint32(arc))
+		}
+		arc = 0
+	}
+	return arcs, nil
+}
+
+// appendTLV appends the element of tag and value to b.
+func appendTLV(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
+
+// encodeInt returns the minimal two's complement of v.
+func encodeInt(v int64) []byte {
+	n := 1
+	for w := v; w > 127 || w < -128; w >>= 8 {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// encodeUint returns the minimal unsigned encoding of v, with a leading zero if its high bit is set.
+func encodeUint(v uint64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func encodeOID(oid OID) []byte {
+	if len(oid) < 2 {
+		return []byte{0}
+	}
+	b := appendArc(nil, uint64(oid[0])*40+uint64(oid[1]))
+	for _, arc := range oid[2:] {
+		b = appendArc(b, uint64(arc))
+	}
+	return b
+}
+
+func appendArc(b []byte, arc uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(arc & 0x7f)
+	for arc >>= 7; arc > 0; arc >>= 7 {
+		i--
+		tmp[i] = byte(arc&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
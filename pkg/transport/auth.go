@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// AuthFailures counts responses rejected by the api server with 401 or 403.
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "auth_failures_total",
+		Help:      "Number of requests to the api server rejected with 401 or 403, by status code",
+	}, []string{"code"})
+	// AuthRetries counts retries of rejected requests with a reloaded token, by result.
+	AuthRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "auth_retries_total",
+		Help:      "Number of rejected requests retried with a reloaded service account token, by result",
+	}, []string{"result"})
+)
+
+// WithTokenRetry makes requests rejected with 401/403 be retried once with the token reloaded from
+// cfg.BearerTokenFile. client-go only reloads a projected service account token periodically, so requests
+// issued right after a rotation would otherwise fail until the next reload.
+func WithTokenRetry(cfg *rest.Config) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &tokenRetryRoundTripper{tokenFile: cfg.BearerTokenFile, rt: rt}
+	})
+}
+
+type tokenRetryRoundTripper struct {
+	tokenFile string
+	rt        http.RoundTripper
+}
+
+func (t *tokenRetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || (resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden) {
+		return resp, err
+	}
+	AuthFailures.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+
+	if t.tokenFile == "" || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	token, err := os.ReadFile(t.tokenFile)
+	if err != nil {
+		klog.ErrorS(err, "Failed to reload service account token", "file", t.tokenFile)
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	retried, err := t.rt.RoundTrip(retry)
+	if err != nil {
+		AuthRetries.WithLabelValues("error").Inc()
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if retried.StatusCode == http.StatusUnauthorized || retried.StatusCode == http.StatusForbidden {
+		AuthRetries.WithLabelValues("rejected").Inc()
+	} else {
+		klog.V(2).Info("Recovered rejected request with reloaded service account token")
+		AuthRetries.WithLabelValues("recovered").Inc()
+	}
+	return retried, nil
+}
+
+// WrappedRoundTripper implements utilnet.RoundTripperWrapper.
+func (t *tokenRetryRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return t.rt
+}
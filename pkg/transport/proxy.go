@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/client-go/rest"
+)
+
+// ProxyFunc returns the proxy of a request URL: proxyURL, or HTTPS_PROXY and HTTP_PROXY if proxyURL is nil, unless
+// the host matches NO_PROXY. Requests to localhost are never proxied.
+func ProxyFunc(proxyURL *url.URL) func(*url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if proxyURL != nil {
+		cfg.HTTPProxy = proxyURL.String()
+		cfg.HTTPSProxy = proxyURL.String()
+	}
+	return cfg.ProxyFunc()
+}
+
+// WithProxy sends the requests of cfg through proxyURL, except to hosts matching NO_PROXY. Without it, client-go
+// already honors the proxy environment variables.
+func WithProxy(cfg *rest.Config, proxyURL *url.URL) {
+	proxy := ProxyFunc(proxyURL)
+	cfg.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// ProxyDialer returns a dialer of TCP connections tunneled through proxyURL with HTTP CONNECT, except to hosts
+// matching NO_PROXY, for gRPC connections, which only honor the proxy environment variables.
+func ProxyDialer(proxyURL *url.URL) func(ctx context.Context, addr string) (net.Conn, error) {
+	proxy := ProxyFunc(proxyURL)
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		through, err := proxy(&url.URL{Scheme: "https", Host: addr})
+		if err != nil {
+			return nil, err
+		}
+		if through == nil {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+		if through.Scheme != "http" {
+			return nil, fmt.Errorf("unsupported proxy scheme %q, expected http", through.Scheme)
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", through.Host)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+			defer func() { _ = conn.SetDeadline(time.Time{}) }()
+		}
+		req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Host: addr}, Host: addr, Header: http.Header{}}
+		if through.User != nil {
+			password, _ := through.User.Password()
+			credentials := base64.StdEncoding.EncodeToString([]byte(through.User.Username() + ":" + password))
+			req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+		}
+		if err := req.Write(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect through proxy %s: %v", through.Host, err)
+		}
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect through proxy %s: %v", through.Host, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", through.Host, addr, resp.Status)
+		}
+		if br.Buffered() > 0 {
+			return &bufferedConn{Conn: conn, r: br}, nil
+		}
+		return conn, nil
+	}
+}
+
+// bufferedConn reads the bytes the proxy sent after its response first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// tlsVersions are the TLS versions a policy can require at least.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSPolicy restricts the TLS versions and cipher suites of connections, e.g. to the FIPS 140 approved ones.
+type TLSPolicy struct {
+	// MinVersion is the minimum TLS version, e.g. tls.VersionTLS12.
+	MinVersion uint16
+	// CipherSuites are the cipher suites of TLS 1.2 connections, or the Go defaults if empty. The cipher suites of
+	// TLS 1.3 are not configurable.
+	CipherSuites []uint16
+}
+
+// ParseTLSPolicy parses a minimum version, 1.2 or 1.3, and comma separated cipher suite names, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Only the TLS 1.2 cipher suites Go considers secure are accepted.
+func ParseTLSPolicy(minVersion, cipherSuites string) (TLSPolicy, error) {
+	var policy TLSPolicy
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return policy, fmt.Errorf("unknown TLS version %q, expected 1.2 or 1.3", minVersion)
+	}
+	policy.MinVersion = version
+	if cipherSuites == "" {
+		return policy, nil
+	}
+	if version == tls.VersionTLS13 {
+		return policy, fmt.Errorf("cipher suites are not configurable with TLS 1.3")
+	}
+	suites := tls12CipherSuites()
+	for _, name := range strings.Split(cipherSuites, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := suites[name]
+		if !ok {
+			names := make([]string, 0, len(suites))
+			for n := range suites {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return policy, fmt.Errorf("unknown or insecure cipher suite %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		policy.CipherSuites = append(policy.CipherSuites, id)
+	}
+	return policy, nil
+}
+
+// tls12CipherSuites returns the secure cipher suites of TLS 1.2 by name.
+func tls12CipherSuites() map[string]uint16 {
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		for _, v := range suite.SupportedVersions {
+			if v == tls.VersionTLS12 {
+				suites[suite.Name] = suite.ID
+			}
+		}
+	}
+	return suites
+}
+
+// Apply restricts c to the policy.
+func (p TLSPolicy) Apply(c *tls.Config) {
+	c.MinVersion = p.MinVersion
+	c.CipherSuites = p.CipherSuites
+}
+
+// WithTLSPolicy restricts the TLS connections of cfg to policy. It must be called before any other wrapper of cfg
+// is added, it then wraps the transport client-go builds from the TLS options of cfg, which have no minimum version
+// or cipher suites. The transport is shared by the configs with the same TLS options and is changed in place once,
+// before its first request, so the policy must be the same for all configs of the process.
+func WithTLSPolicy(cfg *rest.Config, policy TLSPolicy) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		// Plain HTTP connections use http.DefaultTransport, which has no TLS config.
+		t, ok := rt.(*http.Transport)
+		if !ok || t.TLSClientConfig == nil {
+			return rt
+		}
+		if _, applied := policyApplied.LoadOrStore(t, true); !applied {
+			policy.Apply(t.TLSClientConfig)
+		}
+		return rt
+	})
+}
+
+// policyApplied holds the transports a TLS policy was applied to.
+var policyApplied sync.Map
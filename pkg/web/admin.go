@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Pauser is a collection loop that can be paused.
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// Scraper is a collection loop that can fetch stats out of band, e.g. a provider.Manager.
+type Scraper interface {
+	provider.Provider
+	UpdateNow(ctx context.Context) error
+}
+
+// AdminHandler serves the admin endpoints of the exporter:
+//
+//	POST /-/pause
+//	POST /-/resume
+//	POST /-/scrape-now
+//	GET  /-/config
+//
+// scrape-now fetches the stats immediately and returns the fresh snapshot as JSON, unless the loop is paused. config
+// returns the effective configuration, rendered as YAML at startup. It is meant to be registered for /-/ behind
+// WithBearerToken.
+type AdminHandler struct {
+	pauser  Pauser
+	scraper Scraper
+	config  []byte
+	mux     *http.ServeMux
+}
+
+func NewAdminHandler(p Pauser, s Scraper, config []byte) *AdminHandler {
+	h := &AdminHandler{pauser: p, scraper: s, config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/-/pause", h.post(p.Pause))
+	h.mux.HandleFunc("/-/resume", h.post(p.Resume))
+	h.mux.HandleFunc("/-/scrape-now", h.scrapeNow)
+	h.mux.HandleFunc("/-/config", h.serveConfig)
+	return h
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) post(action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		action()
+		fmt.Fprintf(w, "paused: %t\n", h.pauser.Paused())
+	}
+}
+
+func (h *AdminHandler) scrapeNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// A paused loop is usually paused to spare the kubelet, e.g. during maintenance.
+	if h.pauser.Paused() {
+		http.Error(w, "stat summary requests are paused", http.StatusConflict)
+		return
+	}
+	klog.V(1).InfoS("Fetching stats out of band", "remote", r.RemoteAddr)
+	if err := h.scraper.UpdateNow(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("stat summary request failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	snapshots := h.scraper.Snapshots()
+	if len(snapshots) == 0 {
+		http.Error(w, "no snapshot", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshots[0]); err != nil {
+		klog.ErrorS(err, "Failed to write snapshot")
+	}
+}
+
+func (h *AdminHandler) serveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(h.config); err != nil {
+		klog.ErrorS(err, "Failed to write config")
+	}
+}
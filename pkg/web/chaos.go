@@ -0,0 +1,96 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// defaultChaosDuration is the duration of a fault without the for parameter.
+const defaultChaosDuration = 5 * time.Minute
+
+// ChaosHandler injects faults into the stats of the exporter, to test alert rules and runbooks end to end:
+//
+//	GET    /-/chaos
+//	POST   /-/chaos/fail?for=5m
+//	POST   /-/chaos/spike?bytes=10Gi[&pod=<namespace>/<name>][&for=5m]
+//	DELETE /-/chaos
+//
+// fail fails the stat summary requests, and spike adds bytes to the used bytes of a pod, or of the node filesystem
+// without pod, for the given duration, 5m by default and at most the max duration. GET returns the active faults as
+// JSON and DELETE removes them. It is meant to be registered for /-/chaos and /-/chaos/ behind WithBearerToken.
+type ChaosHandler struct {
+	chaos       *provider.Chaos
+	maxDuration time.Duration
+}
+
+func NewChaosHandler(chaos *provider.Chaos, maxDuration time.Duration) *ChaosHandler {
+	return &ChaosHandler{chaos: chaos, maxDuration: maxDuration}
+}
+
+func (h *ChaosHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/-/chaos"), "/")
+	switch {
+	case action == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+	case action == "" && r.Method == http.MethodDelete:
+		klog.InfoS("Removing injected faults", "remote", r.RemoteAddr)
+		h.chaos.Reset()
+	case action != "fail" && action != "spike":
+		http.NotFound(w, r)
+		return
+	case r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		if err := h.inject(action, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.chaos.State(time.Now())); err != nil {
+		klog.ErrorS(err, "Failed to write injected faults")
+	}
+}
+
+func (h *ChaosHandler) inject(action string, r *http.Request) error {
+	query := r.URL.Query()
+	duration := defaultChaosDuration
+	if value := query.Get("for"); value != "" {
+		var err error
+		if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("for must be a positive duration such as 5m, got %q", value)
+		}
+	}
+	if duration > h.maxDuration {
+		return fmt.Errorf("for must be at most %v", h.maxDuration)
+	}
+	until := time.Now().Add(duration)
+	if action == "fail" {
+		klog.InfoS("Failing stat summary requests", "until", until, "remote", r.RemoteAddr)
+		h.chaos.FailUntil(until)
+		return nil
+	}
+	q, err := resource.ParseQuantity(query.Get("bytes"))
+	if err != nil || q.Sign() <= 0 {
+		return fmt.Errorf("bytes must be a positive quantity such as 10Gi, got %q", query.Get("bytes"))
+	}
+	spike := provider.Spike{Bytes: uint64(q.Value()), Until: until}
+	if pod := query.Get("pod"); pod != "" {
+		namespace, name, ok := strings.Cut(pod, "/")
+		if !ok || namespace == "" || name == "" {
+			return fmt.Errorf("pod must be <namespace>/<name>, got %q", pod)
+		}
+		spike.Namespace, spike.Pod = namespace, name
+	}
+	klog.InfoS("Spiking used bytes", "pod", klog.KRef(spike.Namespace, spike.Pod), "bytes", spike.Bytes, "until", until, "remote", r.RemoteAddr)
+	h.chaos.AddSpike(spike)
+	return nil
+}
@@ -0,0 +1,239 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Group and version of the ephemeral metrics API.
+const (
+	EphemeralMetricsGroup   = "ephemeralmetrics.k8s.io"
+	EphemeralMetricsVersion = "v1alpha1"
+)
+
+var ephemeralMetricsGroupVersion = EphemeralMetricsGroup + "/" + EphemeralMetricsVersion
+
+// PodMetrics is the ephemeral storage used by a pod, like the metrics.k8s.io PodMetrics of its CPU and memory.
+type PodMetrics struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Timestamp is the time of the stat summary of the usage.
+	Timestamp metav1.Time `json:"timestamp"`
+	// Usage has the used bytes of the pod as ephemeral-storage.
+	Usage corev1.ResourceList `json:"usage"`
+	// Containers are the writable layers and logs of the containers of the pod, with -collector.container.
+	Containers []ContainerMetrics `json:"containers,omitempty"`
+}
+
+type ContainerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+type PodMetricsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodMetrics `json:"items"`
+}
+
+// NodeMetrics is the ephemeral storage of the node filesystem of a node.
+type NodeMetrics struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Timestamp         metav1.Time `json:"timestamp"`
+	// Usage and Capacity have the used bytes and capacity of the node filesystem as ephemeral-storage, and are
+	// empty if the kubelet did not report it.
+	Usage    corev1.ResourceList `json:"usage"`
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
+}
+
+type NodeMetricsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeMetrics `json:"items"`
+}
+
+// EphemeralMetricsHandler serves the ephemeral storage of the pods and nodes of providers as the read-only API
+// group ephemeralmetrics.k8s.io, to be registered with the api server by an APIService, so that it is queried with
+// kubectl and authorized with RBAC by the api server like metrics.k8s.io:
+//
+//	GET /apis/ephemeralmetrics.k8s.io/v1alpha1/pods
+//	GET /apis/ephemeralmetrics.k8s.io/v1alpha1/namespaces/<namespace>/pods[/<name>]
+//	GET /apis/ephemeralmetrics.k8s.io/v1alpha1/nodes[/<name>]
+//
+// The group and version paths serve the discovery documents the api server checks the availability of the
+// APIService with. Selectors are not supported.
+type EphemeralMetricsHandler struct {
+	providers         []provider.Provider
+	requireClientCert bool
+}
+
+func NewEphemeralMetricsHandler(providers ...provider.Provider) *EphemeralMetricsHandler {
+	return &EphemeralMetricsHandler{providers: providers}
+}
+
+// RequireClientCert rejects the requests without a verified client certificate, i.e. not proxied by the api server
+// when the server verifies client certificates with its requestheader CA.
+func (h *EphemeralMetricsHandler) RequireClientCert() {
+	h.requireClientCert = true
+}
+
+func (h *EphemeralMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "a client certificate is required")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, "the ephemeral metrics API is read-only")
+		return
+	}
+	if r.URL.Query().Get("labelSelector") != "" || r.URL.Query().Get("fieldSelector") != "" {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, "selectors are not supported")
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/apis/"+EphemeralMetricsGroup), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "":
+		writeJSON(w, metav1.APIGroup{
+			TypeMeta:         metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"},
+			Name:             EphemeralMetricsGroup,
+			Versions:         []metav1.GroupVersionForDiscovery{{GroupVersion: ephemeralMetricsGroupVersion, Version: EphemeralMetricsVersion}},
+			PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: ephemeralMetricsGroupVersion, Version: EphemeralMetricsVersion},
+		})
+	case parts[0] != EphemeralMetricsVersion:
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("the server could not find the requested resource %s", r.URL.Path))
+	case len(parts) == 1:
+		verbs := metav1.Verbs{"get", "list"}
+		writeJSON(w, metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: ephemeralMetricsGroupVersion,
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Namespaced: true, Kind: "PodMetrics", Verbs: verbs},
+				{Name: "nodes", Namespaced: false, Kind: "NodeMetrics", Verbs: verbs},
+			},
+		})
+	case len(parts) == 2 && parts[1] == "pods":
+		writeJSON(w, h.pods("", ""))
+	case len(parts) == 4 && parts[1] == "namespaces" && parts[3] == "pods":
+		writeJSON(w, h.pods(parts[2], ""))
+	case len(parts) == 5 && parts[1] == "namespaces" && parts[3] == "pods":
+		list := h.pods(parts[2], parts[4])
+		if len(list.Items) == 0 {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("podmetrics.%s %q not found", EphemeralMetricsGroup, parts[4]))
+			return
+		}
+		writeJSON(w, list.Items[0])
+	case len(parts) == 2 && parts[1] == "nodes":
+		writeJSON(w, h.nodes(""))
+	case len(parts) == 3 && parts[1] == "nodes":
+		list := h.nodes(parts[2])
+		if len(list.Items) == 0 {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("nodemetrics.%s %q not found", EphemeralMetricsGroup, parts[2]))
+			return
+		}
+		writeJSON(w, list.Items[0])
+	default:
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("the server could not find the requested resource %s", r.URL.Path))
+	}
+}
+
+func (h *EphemeralMetricsHandler) snapshots() []*provider.Snapshot {
+	var snapshots []*provider.Snapshot
+	for _, p := range h.providers {
+		for _, snapshot := range p.Snapshots() {
+			if !snapshot.SummaryTime.IsZero() {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+	return snapshots
+}
+
+// pods returns the metrics of the pods of namespace, all if empty, and of name, all if empty, sorted by namespace
+// and name.
+func (h *EphemeralMetricsHandler) pods(namespace, name string) PodMetricsList {
+	list := PodMetricsList{TypeMeta: metav1.TypeMeta{Kind: "PodMetricsList", APIVersion: ephemeralMetricsGroupVersion}, Items: []PodMetrics{}}
+	for _, snapshot := range h.snapshots() {
+		for i := range snapshot.Pods {
+			stat := &snapshot.Pods[i]
+			if (namespace != "" && stat.Namespace != namespace) || (name != "" && stat.PodName != name) {
+				continue
+			}
+			metrics := PodMetrics{
+				TypeMeta:   metav1.TypeMeta{Kind: "PodMetrics", APIVersion: ephemeralMetricsGroupVersion},
+				ObjectMeta: metav1.ObjectMeta{Name: stat.PodName, Namespace: stat.Namespace, Labels: map[string]string{"node": stat.NodeName}},
+				Timestamp:  metav1.NewTime(snapshot.SummaryTime),
+				Usage:      ephemeralStorage(stat.UsedBytes),
+			}
+			for _, container := range stat.Containers {
+				metrics.Containers = append(metrics.Containers, ContainerMetrics{Name: container.Name, Usage: ephemeralStorage(container.RootfsUsedBytes + container.LogsUsedBytes)})
+			}
+			list.Items = append(list.Items, metrics)
+		}
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return list
+}
+
+// nodes returns the metrics of the node name, all if empty, sorted by name.
+func (h *EphemeralMetricsHandler) nodes(name string) NodeMetricsList {
+	list := NodeMetricsList{TypeMeta: metav1.TypeMeta{Kind: "NodeMetricsList", APIVersion: ephemeralMetricsGroupVersion}, Items: []NodeMetrics{}}
+	for _, snapshot := range h.snapshots() {
+		if name != "" && snapshot.Node.NodeName != name {
+			continue
+		}
+		metrics := NodeMetrics{
+			TypeMeta:   metav1.TypeMeta{Kind: "NodeMetrics", APIVersion: ephemeralMetricsGroupVersion},
+			ObjectMeta: metav1.ObjectMeta{Name: snapshot.Node.NodeName},
+			Timestamp:  metav1.NewTime(snapshot.SummaryTime),
+			Usage:      corev1.ResourceList{},
+		}
+		if fs := snapshot.NodeFs; fs != nil {
+			metrics.Usage, metrics.Capacity = ephemeralStorage(fs.UsedBytes), ephemeralStorage(fs.CapacityBytes)
+		}
+		list.Items = append(list.Items, metrics)
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+	return list
+}
+
+func ephemeralStorage(bytes uint64) corev1.ResourceList {
+	return corev1.ResourceList{corev1.ResourceEphemeralStorage: *resource.NewQuantity(int64(bytes), resource.BinarySI)}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.V(1).InfoS("Failed to write ephemeral metrics response", "err", err)
+	}
+}
+
+// writeStatus writes a failure Status, which kubectl prints the message of.
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// ErrorsHandler serves the last collection errors of an ErrorLog, newest first.
+//
+//	GET /debug/errors?node=<node>&limit=<n>
+//
+// node only returns the errors of the node, limit at most n errors.
+type ErrorsHandler struct {
+	log *provider.ErrorLog
+}
+
+func NewErrorsHandler(log *provider.ErrorLog) *ErrorsHandler {
+	return &ErrorsHandler{log: log}
+}
+
+type errorsResponse struct {
+	Errors []provider.CollectionError `json:"errors"`
+}
+
+func (h *ErrorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit := -1
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	node := query.Get("node")
+
+	resp := errorsResponse{Errors: []provider.CollectionError{}}
+	for _, e := range h.log.Errors() {
+		if limit >= 0 && len(resp.Errors) >= limit {
+			break
+		}
+		if node == "" || e.Node == node {
+			resp.Errors = append(resp.Errors, e)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		klog.ErrorS(err, "Failed to write errors")
+	}
+}
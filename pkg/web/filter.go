@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// FilterTarget is a provider of the series of the metrics endpoint, with the labels of its series, e.g. a cluster
+// label with -cluster.
+type FilterTarget struct {
+	Labels   prometheus.Labels
+	Provider provider.Provider
+}
+
+// FilterHandler serves the metrics endpoint, or a slice of its series for a query, so that specialized scrape jobs
+// pull only what they need:
+//
+//	GET /metrics?namespace=<namespace>&pod=<pod>&collector=<collector>
+//
+// namespace and pod keep the pods of the given namespaces and names, and collector collects the given collectors
+// only. Each parameter can be repeated. Sliced responses are collected on their own, from the targets only.
+type FilterHandler struct {
+	metrics      http.Handler
+	targets      []FilterTarget
+	newCollector func(p provider.Provider, collectors []string) (prometheus.Collector, error)
+	gatherer     func(prometheus.Gatherer) prometheus.Gatherer
+	opts         promhttp.HandlerOpts
+}
+
+// NewFilterHandler returns a handler serving requests without a query with metrics, and the others with the
+// collector newCollector returns for the filtered provider of every target and the collectors of the query, all
+// if empty. gatherer wraps the gatherer of the collectors, e.g. to rename metrics.
+func NewFilterHandler(metrics http.Handler, targets []FilterTarget, newCollector func(p provider.Provider, collectors []string) (prometheus.Collector, error), gatherer func(prometheus.Gatherer) prometheus.Gatherer, opts promhttp.HandlerOpts) *FilterHandler {
+	return &FilterHandler{metrics: metrics, targets: targets, newCollector: newCollector, gatherer: gatherer, opts: opts}
+}
+
+func (h *FilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.RawQuery == "" {
+		h.metrics.ServeHTTP(w, r)
+		return
+	}
+	query := r.URL.Query()
+	namespaces, pods := set(query["namespace"]), set(query["pod"])
+	keep := func(stat *provider.PodStat) bool {
+		return (len(namespaces) == 0 || namespaces[stat.Namespace]) && (len(pods) == 0 || pods[stat.PodName])
+	}
+	reg := prometheus.NewRegistry()
+	for _, target := range h.targets {
+		c, err := h.newCollector(provider.FilterPods(target.Provider, keep), query["collector"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prometheus.WrapRegistererWith(target.Labels, reg).Register(c); err != nil {
+			klog.ErrorS(err, "Failed to register filtered collector")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	promhttp.HandlerFor(h.gatherer(reg), h.opts).ServeHTTP(w, r)
+}
+
+func set(values []string) map[string]bool {
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+type staticProvider []*provider.Snapshot
+
+func (p staticProvider) Snapshots() []*provider.Snapshot {
+	return p
+}
+
+// usedCollector exports the used bytes of the pods of a provider.
+type usedCollector struct {
+	provider provider.Provider
+	desc     *prometheus.Desc
+}
+
+func newUsedCollector(p provider.Provider, collectors []string) (prometheus.Collector, error) {
+	for _, c := range collectors {
+		if c != "pod" {
+			return nil, fmt.Errorf("unknown collector %q", c)
+		}
+	}
+	return usedCollector{provider: p, desc: prometheus.NewDesc("used_bytes", "Used bytes", []string{"namespace_name", "pod_name"}, nil)}, nil
+}
+
+func (c usedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c usedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, snapshot := range c.provider.Snapshots() {
+		for i := range snapshot.Pods {
+			stat := &snapshot.Pods[i]
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(stat.UsedBytes), stat.Namespace, stat.PodName)
+		}
+	}
+}
+
+func TestFilterHandler(t *testing.T) {
+	targets := []FilterTarget{{
+		Labels: prometheus.Labels{"cluster": "a"},
+		Provider: staticProvider{{Pods: []provider.PodStat{
+			{Namespace: "team-a", PodName: "web-0", UsedBytes: 1},
+			{Namespace: "team-a", PodName: "web-1", UsedBytes: 2},
+			{Namespace: "team-b", PodName: "web-0", UsedBytes: 3},
+		}}},
+	}}
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "full")
+	})
+	identity := func(g prometheus.Gatherer) prometheus.Gatherer { return g }
+	h := NewFilterHandler(metrics, targets, newUsedCollector, identity, promhttp.HandlerOpts{})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		// wantSeries are the series served, nil for the unfiltered metrics.
+		wantSeries []string
+	}{
+		{
+			name:       "no query",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "namespace",
+			query:      "namespace=team-a",
+			wantStatus: http.StatusOK,
+			wantSeries: []string{
+				`used_bytes{cluster="a",namespace_name="team-a",pod_name="web-0"} 1`,
+				`used_bytes{cluster="a",namespace_name="team-a",pod_name="web-1"} 2`,
+			},
+		},
+		{
+			name:       "repeated namespaces",
+			query:      "namespace=team-a&namespace=team-b",
+			wantStatus: http.StatusOK,
+			wantSeries: []string{
+				`used_bytes{cluster="a",namespace_name="team-a",pod_name="web-0"} 1`,
+				`used_bytes{cluster="a",namespace_name="team-a",pod_name="web-1"} 2`,
+				`used_bytes{cluster="a",namespace_name="team-b",pod_name="web-0"} 3`,
+			},
+		},
+		{
+			name:       "namespace and pod",
+			query:      "namespace=team-b&pod=web-0",
+			wantStatus: http.StatusOK,
+			wantSeries: []string{
+				`used_bytes{cluster="a",namespace_name="team-b",pod_name="web-0"} 3`,
+			},
+		},
+		{
+			name:       "collector",
+			query:      "collector=pod&pod=web-1",
+			wantStatus: http.StatusOK,
+			wantSeries: []string{
+				`used_bytes{cluster="a",namespace_name="team-a",pod_name="web-1"} 2`,
+			},
+		},
+		{
+			name:       "unknown collector",
+			query:      "collector=volume",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if tt.wantSeries == nil {
+				if rec.Body.String() != "full\n" {
+					t.Errorf("body = %q, want the unfiltered metrics", rec.Body)
+				}
+				return
+			}
+			var series []string
+			for _, line := range strings.Split(rec.Body.String(), "\n") {
+				if line != "" && !strings.HasPrefix(line, "#") {
+					series = append(series, line)
+				}
+			}
+			sort.Strings(series)
+			if strings.Join(series, "\n") != strings.Join(tt.wantSeries, "\n") {
+				t.Errorf("series:\n%s\nwant:\n%s", strings.Join(series, "\n"), strings.Join(tt.wantSeries, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// limiterTTL is how long the rate limiter of an idle client is kept.
+	limiterTTL = 10 * time.Minute
+	// limiterCacheSize bounds the clients with a rate limiter. The least recently seen is forgotten beyond.
+	limiterCacheSize = 4096
+)
+
+// Reasons of APIRequestsRejected.
+const (
+	RejectUnauthorized = "unauthorized"
+	RejectRateLimited  = "rate_limited"
+)
+
+// APIRequestsRejected counts the requests of the endpoints of an APIGuard it rejected, by reason.
+var APIRequestsRejected = func() *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeral_storage",
+		Name:      "api_requests_rejected_total",
+		Help:      "Number of requests of the JSON endpoints rejected for a missing token or a rate limit, by reason",
+	}, []string{"reason"})
+	for _, reason := range []string{RejectUnauthorized, RejectRateLimited} {
+		c.WithLabelValues(reason)
+	}
+	return c
+}()
+
+// APIGuard authenticates and rate limits the requests of the JSON endpoints, e.g. /api/v1/raw-summary, so that they
+// can be reachable on the pod network of a shared cluster. Clients are rate limited by token, or by remote address
+// without tokens, across all the endpoints of the guard.
+type APIGuard struct {
+	tokens   [][]byte
+	limiters *clientLimiters
+}
+
+// NewAPIGuard returns a guard requiring one of tokens as bearer token and allowing perSecond requests per client, in
+// bursts of as many. No tokens disable authentication and a perSecond of 0 rate limiting.
+func NewAPIGuard(tokens []string, perSecond float64) *APIGuard {
+	g := &APIGuard{limiters: newClientLimiters(perSecond)}
+	for _, token := range tokens {
+		g.tokens = append(g.tokens, []byte(token))
+	}
+	return g
+}
+
+// Wrap serves h to the requests allowed by the guard, 401 to those without a valid token and 429 to those over the
+// rate limit.
+func (g *APIGuard) Wrap(h http.Handler) http.Handler {
+	if len(g.tokens) == 0 && g.limiters == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := g.authenticate(r)
+		if !ok {
+			APIRequestsRejected.WithLabelValues(RejectUnauthorized).Inc()
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !g.limiters.allow(w, client) {
+			APIRequestsRejected.WithLabelValues(RejectRateLimited).Inc()
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the client of r: the hash of its token, or its remote address without tokens.
+func (g *APIGuard) authenticate(r *http.Request) (string, bool) {
+	if len(g.tokens) == 0 {
+		return remoteHost(r), true
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+	for _, expected := range g.tokens {
+		if subtle.ConstantTimeCompare(token, expected) == 1 {
+			sum := sha256.Sum256(token)
+			return hex.EncodeToString(sum[:]), true
+		}
+	}
+	return "", false
+}
+
+// remoteHost returns the remote address of r without its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientLimiters rate limits clients independently of each other.
+type clientLimiters struct {
+	limit rate.Limit
+	burst int
+
+	lock     sync.Mutex
+	limiters *cache.LRUExpireCache
+}
+
+// newClientLimiters returns limiters allowing perSecond requests per client, in bursts of as many, nil when perSecond
+// is 0. A nil *clientLimiters allows every request.
+func newClientLimiters(perSecond float64) *clientLimiters {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &clientLimiters{limit: rate.Limit(perSecond), burst: int(math.Max(1, math.Ceil(perSecond))), limiters: cache.NewLRUExpireCache(limiterCacheSize)}
+}
+
+// allow reports whether client is within its rate limit, and otherwise answers 429 on w.
+func (l *clientLimiters) allow(w http.ResponseWriter, client string) bool {
+	if l == nil {
+		return true
+	}
+	reservation := l.limiter(client).Reserve()
+	if reservation.Delay() == 0 {
+		return true
+	}
+	// The request is not served, so it does not take the token of a later one.
+	reservation.Cancel()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reservation.Delay().Seconds()))))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+	return false
+}
+
+// limiter returns the rate limiter of client, created on its first request.
+func (l *clientLimiters) limiter(client string) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	limiter, ok := l.limiters.Get(client)
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+	}
+	// Re-added to extend the TTL of active clients.
+	l.limiters.Add(client, limiter, limiterTTL)
+	return limiter.(*rate.Limiter)
+}
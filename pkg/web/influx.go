@@ -0,0 +1,137 @@
+package web
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog/v2"
+)
+
+// InfluxHandler serves the series of a gatherer in the InfluxDB line protocol, so that Telegraf scrapes them with its
+// http input and the influx data format without the prometheus input in between:
+//
+//	GET /influx
+//
+// Each series is a line of the measurement named after the metric, with its labels as tags, like the prometheus
+// input of Telegraf with metric_version 1: a gauge field for gauges, counter for counters and value for untyped
+// metrics, and sum, count and a field per bucket bound or quantile for histograms and summaries. NaN and infinite
+// values are left out, the line protocol has no notation for them. Lines without a timestamp in the series have the time of the request.
+type InfluxHandler struct {
+	gatherer prometheus.Gatherer
+}
+
+func NewInfluxHandler(gatherer prometheus.Gatherer) *InfluxHandler {
+	return &InfluxHandler{gatherer: gatherer}
+}
+
+func (h *InfluxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		// Like promhttp with ContinueOnError, the series that were gathered are still served.
+		klog.ErrorS(err, "Failed to gather metrics for the influx endpoint")
+	}
+	now := time.Now()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			if fields := influxFields(family.GetType(), metric); len(fields) > 0 {
+				writeInfluxLine(out, family.GetName(), metric, fields, now)
+			}
+		}
+	}
+	_ = out.Flush()
+}
+
+type influxField struct {
+	key   string
+	value float64
+}
+
+// influxFields returns the finite fields of metric, in the order they are written.
+func influxFields(kind dto.MetricType, metric *dto.Metric) []influxField {
+	var fields []influxField
+	add := func(key string, value float64) {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			fields = append(fields, influxField{key: key, value: value})
+		}
+	}
+	switch kind {
+	case dto.MetricType_GAUGE:
+		add("gauge", metric.GetGauge().GetValue())
+	case dto.MetricType_COUNTER:
+		add("counter", metric.GetCounter().GetValue())
+	case dto.MetricType_UNTYPED:
+		add("value", metric.GetUntyped().GetValue())
+	case dto.MetricType_HISTOGRAM:
+		h := metric.GetHistogram()
+		add("sum", h.GetSampleSum())
+		add("count", float64(h.GetSampleCount()))
+		for _, bucket := range h.Bucket {
+			if !math.IsInf(bucket.GetUpperBound(), 1) {
+				add(strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64), float64(bucket.GetCumulativeCount()))
+			}
+		}
+		add("+Inf", float64(h.GetSampleCount()))
+	case dto.MetricType_SUMMARY:
+		s := metric.GetSummary()
+		add("sum", s.GetSampleSum())
+		add("count", float64(s.GetSampleCount()))
+		for _, quantile := range s.Quantile {
+			add(strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64), quantile.GetValue())
+		}
+	}
+	return fields
+}
+
+// writeInfluxLine writes a line of measurement with the labels of metric as tags, sorted by name as the line
+// protocol recommends. Labels with empty values are left out, tags cannot be empty.
+func writeInfluxLine(out *bufio.Writer, measurement string, metric *dto.Metric, fields []influxField, now time.Time) {
+	out.WriteString(influxMeasurementEscaper.Replace(measurement))
+	labels := make([]*dto.LabelPair, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		if label.GetValue() != "" {
+			labels = append(labels, label)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	for _, label := range labels {
+		out.WriteByte(',')
+		out.WriteString(influxTagEscaper.Replace(label.GetName()))
+		out.WriteByte('=')
+		out.WriteString(influxTagEscaper.Replace(label.GetValue()))
+	}
+	for i, field := range fields {
+		if i == 0 {
+			out.WriteByte(' ')
+		} else {
+			out.WriteByte(',')
+		}
+		out.WriteString(influxTagEscaper.Replace(field.key))
+		out.WriteByte('=')
+		out.WriteString(strconv.FormatFloat(field.value, 'f', -1, 64))
+	}
+	t := now
+	if metric.TimestampMs != nil {
+		t = time.UnixMilli(metric.GetTimestampMs())
+	}
+	out.WriteByte(' ')
+	out.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	out.WriteByte('\n')
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
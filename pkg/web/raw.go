@@ -0,0 +1,43 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// RawSummarySource provides the last stat summary of a node, e.g. a provider.Manager with
+// provider.Options.KeepRawSummary.
+type RawSummarySource interface {
+	RawSummary() *provider.RawSummary
+}
+
+// RawSummaryHandler serves the last stat summary of the node as the kubelet responded it, so that other agents of
+// the node reuse the request of the exporter instead of each requesting the kubelet.
+//
+//	GET /api/v1/raw-summary
+//
+// The response is the JSON of the kubelet /stats/summary endpoint. Last-Modified is the time of the request, which
+// If-Modified-Since is matched against. It responds 503 until the first request succeeded.
+type RawSummaryHandler struct {
+	source RawSummarySource
+}
+
+func NewRawSummaryHandler(source RawSummarySource) *RawSummaryHandler {
+	return &RawSummaryHandler{source: source}
+}
+
+func (h *RawSummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	summary := h.source.RawSummary()
+	if summary == nil {
+		http.Error(w, "no stat summary yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, "", summary.Time, bytes.NewReader(summary.Content))
+}
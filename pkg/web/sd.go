@@ -0,0 +1,98 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// SDHandler serves the nodes of every cluster in the format of the Prometheus HTTP service discovery, with a
+// /probe target per node on the exporter itself, so that Prometheus scrapes each node as its own target.
+type SDHandler struct {
+	clusters []Cluster
+}
+
+func NewSDHandler(clusters []Cluster) *SDHandler {
+	return &SDHandler{clusters: clusters}
+}
+
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (h *SDHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Prometheus fetched the targets from the exporter, so it can reach the exporter at the same address. The series
+	// have a node_name label already, a target label would be renamed to exported_node_name.
+	groups := []targetGroup{}
+	for _, c := range h.clusters {
+		for _, node := range c.Manager.Nodes() {
+			groups = append(groups, targetGroup{
+				Targets: []string{r.Host},
+				Labels: map[string]string{
+					"__metrics_path__": "/probe",
+					"__param_cluster":  c.Name,
+					"__param_node":     node,
+					"cluster":          c.Name,
+				},
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(groups); err != nil {
+		klog.ErrorS(err, "Failed to write service discovery targets")
+	}
+}
+
+// ProbeHandler serves the metrics of the node of the node and cluster query parameters only, without a cluster
+// label, which the target labels of the service discovery add.
+type ProbeHandler struct {
+	clusters     []Cluster
+	newCollector func(provider.Provider) prometheus.Collector
+	opts         promhttp.HandlerOpts
+}
+
+// NewProbeHandler returns a handler exposing the collector returned by newCollector for the provider of the node.
+func NewProbeHandler(clusters []Cluster, newCollector func(provider.Provider) prometheus.Collector, opts promhttp.HandlerOpts) *ProbeHandler {
+	return &ProbeHandler{clusters: clusters, newCollector: newCollector, opts: opts}
+}
+
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	name, node := query.Get("cluster"), query.Get("node")
+	if node == "" {
+		http.Error(w, "missing node parameter", http.StatusBadRequest)
+		return
+	}
+	for _, c := range h.clusters {
+		if c.Name != name {
+			continue
+		}
+		m, ok := c.Manager.Node(node)
+		if !ok {
+			break
+		}
+		reg := prometheus.NewRegistry()
+		if err := reg.Register(h.newCollector(m)); err != nil {
+			klog.ErrorS(err, "Failed to register probe collector", "cluster", name, "node", node)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(reg, h.opts).ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "unknown node "+node+" of cluster "+name, http.StatusNotFound)
+}
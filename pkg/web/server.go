@@ -0,0 +1,82 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const shutdownTimeout = 30 * time.Second
+
+// Server is the HTTP server exposing metrics and the exporter's endpoints.
+// It implements manager.Runnable and runs regardless of leader election.
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+
+	certFile  string
+	keyFile   string
+	tlsConfig *tls.Config
+}
+
+func NewServer(addr string) *Server {
+	return &Server{
+		addr: addr,
+		mux:  http.NewServeMux(),
+	}
+}
+
+// Handle registers the handler for the given pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// EnableTLS serves HTTPS with the certificate and key of the PEM files, restricted to config.
+func (s *Server) EnableTLS(certFile, keyFile string, config *tls.Config) {
+	s.certFile = certFile
+	s.keyFile = keyFile
+	s.tlsConfig = config
+}
+
+// Start serves until ctx is done and then shuts the server down gracefully.
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{Addr: s.addr, Handler: s.mux, TLSConfig: s.tlsConfig}
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if s.certFile != "" {
+			klog.Infof("Listening on %s with TLS", s.addr)
+			err = srv.ListenAndServeTLS(s.certFile, s.keyFile)
+		} else {
+			klog.Infof("Listening on %s", s.addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		klog.ErrorS(err, "failed to shutdown server")
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// Cluster is a scraped cluster whose nodes are listed as targets.
+type Cluster struct {
+	Name    string
+	Manager *provider.ClusterManager
+}
+
+// TargetsHandler serves the state of the stat summary requests of every node in the format of the Prometheus
+// /api/v1/targets endpoint, so that tools monitoring Prometheus service discovery work with the exporter too.
+// Every cluster is a scrape pool.
+type TargetsHandler struct {
+	clusters []Cluster
+}
+
+func NewTargetsHandler(clusters []Cluster) *TargetsHandler {
+	return &TargetsHandler{clusters: clusters}
+}
+
+type targetsResponse struct {
+	Status string      `json:"status"`
+	Data   targetsData `json:"data"`
+}
+
+type targetsData struct {
+	ActiveTargets  []target `json:"activeTargets"`
+	DroppedTargets []target `json:"droppedTargets"`
+}
+
+type target struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+	Labels           map[string]string `json:"labels"`
+	ScrapePool       string            `json:"scrapePool"`
+	ScrapeURL        string            `json:"scrapeUrl"`
+	LastError        string            `json:"lastError"`
+	LastScrape       time.Time         `json:"lastScrape"`
+	// LastScrapeDuration is in seconds like in Prometheus.
+	LastScrapeDuration float64 `json:"lastScrapeDuration"`
+	// Health is up, down, or unknown until the node was scraped once.
+	Health string `json:"health"`
+}
+
+func (h *TargetsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := targetsResponse{Status: "success", Data: targetsData{ActiveTargets: []target{}, DroppedTargets: []target{}}}
+	for _, c := range h.clusters {
+		snapshots := map[string]*provider.Snapshot{}
+		for _, snapshot := range c.Manager.Snapshots() {
+			snapshots[snapshot.Node.NodeName] = snapshot
+		}
+		for _, node := range c.Manager.Nodes() {
+			t := target{
+				DiscoveredLabels: map[string]string{"cluster": c.Name, "node_name": node},
+				Labels:           map[string]string{"cluster": c.Name, "node_name": node},
+				ScrapePool:       c.Name,
+				ScrapeURL:        fmt.Sprintf("/api/v1/nodes/%s/proxy/stats/summary", node),
+				Health:           "unknown",
+			}
+			if snapshot, ok := snapshots[node]; ok {
+				t.LastError = snapshot.Node.Error
+				t.LastScrape = snapshot.Time
+				t.LastScrapeDuration = snapshot.Node.Latency.Seconds()
+				t.Health = "down"
+				if snapshot.Node.Up {
+					t.Health = "up"
+				}
+			}
+			resp.Data.ActiveTargets = append(resp.Data.ActiveTargets, t)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		klog.ErrorS(err, "Failed to write targets")
+	}
+}
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// reviewTTL is how long the outcome of the review of a token for a namespace is reused, so that every scrape
+	// does not cost two api server requests.
+	reviewTTL = time.Minute
+	// reviewCacheSize bounds the cached reviews.
+	reviewCacheSize = 1024
+)
+
+// TenantHandler serves the series of a namespace, those with its namespace_name label, at <prefix><namespace> to
+// clients whose bearer token is allowed to get the pods of the namespace. Tokens are authenticated with a
+// TokenReview and authorized with a SubjectAccessReview, so tenants of a shared cluster scrape their own series
+// without seeing their neighbors. Tokens without a cached review are rate limited by remote address, so that
+// unauthenticated clients cannot flood the api server with reviews.
+type TenantHandler struct {
+	prefix   string
+	gatherer prometheus.Gatherer
+	cli      kubernetes.Interface
+	opts     promhttp.HandlerOpts
+	inFlight chan struct{}
+	reviews  *cache.LRUExpireCache
+	limiters *clientLimiters
+}
+
+// NewTenantHandler returns a handler of the namespaces below prefix, e.g. /metrics/namespaces/, serving the series of
+// gatherer with opts. opts.MaxRequestsInFlight bounds the requests of all namespaces together, and reviewsPerSecond
+// the reviews each client may trigger, in bursts of as many. Reviews are not rate limited when it is 0.
+func NewTenantHandler(prefix string, gatherer prometheus.Gatherer, cli kubernetes.Interface, opts promhttp.HandlerOpts, reviewsPerSecond float64) *TenantHandler {
+	h := &TenantHandler{
+		prefix:   prefix,
+		gatherer: gatherer,
+		cli:      cli,
+		opts:     opts,
+		reviews:  cache.NewLRUExpireCache(reviewCacheSize),
+		limiters: newClientLimiters(reviewsPerSecond),
+	}
+	if opts.MaxRequestsInFlight > 0 {
+		h.inFlight = make(chan struct{}, opts.MaxRequestsInFlight)
+		h.opts.MaxRequestsInFlight = 0
+	}
+	return h
+}
+
+func (h *TenantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	namespace := strings.TrimPrefix(r.URL.Path, h.prefix)
+	if len(validation.IsDNS1123Label(namespace)) > 0 {
+		http.NotFound(w, r)
+		return
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	allowed, ok := h.cached(token, namespace)
+	if !ok {
+		if !h.limiters.allow(w, remoteHost(r)) {
+			return
+		}
+		var err error
+		if allowed, err = h.review(r.Context(), token, namespace); err != nil {
+			klog.ErrorS(err, "Failed to review the token of a tenant metrics request", "namespace", namespace)
+			http.Error(w, "failed to review token", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("forbidden to get the pods of namespace %s", namespace), http.StatusForbidden)
+		return
+	}
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+		default:
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	promhttp.HandlerFor(namespaceGatherer{gatherer: h.gatherer, namespace: namespace}, h.opts).ServeHTTP(w, r)
+}
+
+// cached returns the outcome of the review of token for namespace within the last reviewTTL, ok is false without one.
+func (h *TenantHandler) cached(token, namespace string) (allowed, ok bool) {
+	value, ok := h.reviews.Get(reviewKey(token, namespace))
+	if !ok {
+		return false, false
+	}
+	return value.(bool), true
+}
+
+func reviewKey(token, namespace string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]) + "/" + namespace
+}
+
+// review reports whether token authenticates a user allowed to get the pods of namespace.
+func (h *TenantHandler) review(ctx context.Context, token, namespace string) (bool, error) {
+	tokenReview, err := h.cli.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	allowed := false
+	if user := tokenReview.Status.User; tokenReview.Status.Authenticated {
+		extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+		for k, v := range user.Extra {
+			extra[k] = authorizationv1.ExtraValue(v)
+		}
+		accessReview, err := h.cli.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      "get",
+					Resource:  "pods",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return false, err
+		}
+		allowed = accessReview.Status.Allowed
+	}
+	h.reviews.Add(reviewKey(token, namespace), allowed, reviewTTL)
+	return allowed, nil
+}
+
+// namespaceGatherer gathers the series of gatherer with the namespace_name label of namespace.
+type namespaceGatherer struct {
+	gatherer  prometheus.Gatherer
+	namespace string
+}
+
+func (g namespaceGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		metrics := family.Metric[:0]
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "namespace_name" && label.GetValue() == g.namespace {
+					metrics = append(metrics, metric)
+					break
+				}
+			}
+		}
+		if len(metrics) > 0 {
+			family.Metric = metrics
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, err
+}
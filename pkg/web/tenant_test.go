@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTenantClient returns a client authenticating the token "team-a" as a user allowed to get the pods of
+// namespace team-a, and counting the token reviews.
+func newTenantClient(reviews *int) *fake.Clientset {
+	cli := fake.NewSimpleClientset()
+	cli.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "team-a" {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "team-a"}}
+		}
+		return true, review, nil
+	})
+	cli.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "team-a" && review.Spec.ResourceAttributes.Namespace == "team-a"
+		return true, review, nil
+	})
+	return cli
+}
+
+func newTenantGatherer() prometheus.Gatherer {
+	reg := prometheus.NewRegistry()
+	used := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ephemeral_storage_pod_used_bytes", Help: "Used bytes"}, []string{"namespace_name", "pod_name"})
+	used.WithLabelValues("team-a", "web-0").Set(1)
+	used.WithLabelValues("team-b", "db-0").Set(2)
+	reg.MustRegister(used)
+	return reg
+}
+
+func TestTenantHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "own namespace", path: "/metrics/namespaces/team-a", token: "team-a", wantStatus: http.StatusOK, wantBody: `pod_name="web-0"`},
+		{name: "other namespace", path: "/metrics/namespaces/team-b", token: "team-a", wantStatus: http.StatusForbidden},
+		{name: "unauthenticated token", path: "/metrics/namespaces/team-a", token: "unknown", wantStatus: http.StatusForbidden},
+		{name: "no token", path: "/metrics/namespaces/team-a", wantStatus: http.StatusUnauthorized},
+		{name: "invalid namespace", path: "/metrics/namespaces/Team_A", token: "team-a", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reviews int
+			h := NewTenantHandler("/metrics/namespaces/", newTenantGatherer(), newTenantClient(&reviews), promhttp.HandlerOpts{}, 0)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %s:\n%s", tt.wantBody, rec.Body)
+			}
+			if strings.Contains(rec.Body.String(), `pod_name="db-0"`) {
+				t.Errorf("body contains the series of another namespace:\n%s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestTenantHandlerRateLimitsReviews(t *testing.T) {
+	var reviews int
+	h := NewTenantHandler("/metrics/namespaces/", newTenantGatherer(), newTenantClient(&reviews), promhttp.HandlerOpts{}, 1)
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics/namespaces/team-a", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	steps := []struct {
+		token      string
+		wantStatus int
+	}{
+		{token: "team-a", wantStatus: http.StatusOK},
+		// The review of team-a is cached and not limited.
+		{token: "team-a", wantStatus: http.StatusOK},
+		{token: "guess-1", wantStatus: http.StatusTooManyRequests},
+		{token: "guess-2", wantStatus: http.StatusTooManyRequests},
+		{token: "team-a", wantStatus: http.StatusOK},
+	}
+	for i, step := range steps {
+		if got := serve(step.token); got != step.wantStatus {
+			t.Errorf("request %d with token %s: status = %d, want %d", i, step.token, got, step.wantStatus)
+		}
+	}
+	if reviews != 1 {
+		t.Errorf("token reviews = %d, want 1", reviews)
+	}
+}
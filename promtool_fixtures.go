@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// fixturesDuration is the time range of the input series of promtool-fixtures, long enough for the for clause of
+// most alerts.
+const fixturesDuration = time.Hour
+
+// promtoolTest is a promtool unit test file, see
+// https://prometheus.io/docs/prometheus/latest/configuration/unit_testing_rules/.
+type promtoolTest struct {
+	RuleFiles          []string       `json:"rule_files"`
+	EvaluationInterval string         `json:"evaluation_interval"`
+	Tests              []promtoolCase `json:"tests"`
+}
+
+type promtoolCase struct {
+	Interval    string           `json:"interval"`
+	InputSeries []promtoolSeries `json:"input_series"`
+}
+
+type promtoolSeries struct {
+	Series string `json:"series"`
+	Values string `json:"values"`
+}
+
+// promtoolFixtures fetches the stat summary of the node once, collects it with the collectors of the -collector
+// flags and the metric names of the config file, and prints a promtool test file with every series as input series,
+// constant over an hour at the scrape interval. Alert tests are then written against real shapes of the exported
+// data. Flags that need pod objects have no effect. It returns a non-zero exit code on failure.
+func promtoolFixtures() int {
+	appConfig, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	cfg, err := restConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "api server client: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	node, err := resolveNodeName(ctx, cli)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "node name: %v\n", err)
+		return 1
+	}
+	kubelet, err := kubeletClient(cli, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kubelet client: %v\n", err)
+		return 1
+	}
+	m := provider.NewManager(cli, provider.Options{
+		NodeName:       node,
+		Interval:       time.Duration(scrapeIntervalSecond) * time.Second,
+		Kubelet:        kubelet,
+		KeepContainers: enabledCollectors["container"] || enabledCollectors["source"],
+		KeepVolumes:    enabledCollectors["volume"] || enabledCollectors["source"],
+		DedupeEmptyDir: dedupeEmptyDir,
+	})
+	if err := m.Update(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "kubelet stat summary of node %s: %v\n", node, err)
+		return 1
+	}
+	minUsed, _ := minUsedBytesFlag()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector.NewEphemeralStorageCollector(m, collector.Options{
+		Collectors:       enabledCollectors,
+		TopNPerNode:      topNPerNode,
+		MinUsedBytes:     minUsed,
+		SkipZeroCapacity: skipZeroCapacity,
+		Derived:          appConfig.Derived,
+	}))
+	families, err := appConfig.Metrics.Gatherer(reg).Gather()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to collect metrics: %v\n", err)
+		return 1
+	}
+
+	interval := time.Duration(scrapeIntervalSecond) * time.Second
+	test := promtoolTest{
+		RuleFiles:          []string{"rules.yaml"},
+		EvaluationInterval: interval.String(),
+		Tests: []promtoolCase{{
+			Interval:    interval.String(),
+			InputSeries: fixtureSeries(families, int(fixturesDuration/interval)),
+		}},
+	}
+	out, err := yaml.Marshal(test)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode test file: %v\n", err)
+		return 1
+	}
+	fmt.Printf("# Input series of node %s at %s. Set rule_files and add alert_rule_test or promql_expr_test to the\n", node, time.Now().UTC().Format(time.RFC3339))
+	fmt.Printf("# test, and edit the values to shape growth, e.g. '0+1048576x%d'.\n", int(fixturesDuration/interval))
+	fmt.Print(string(out))
+	return 0
+}
+
+// fixtureSeries returns the series of families in the promtool notation, each value repeated for samples intervals.
+// Histograms become their bucket, sum and count series.
+func fixtureSeries(families []*dto.MetricFamily, samples int) []promtoolSeries {
+	var series []promtoolSeries
+	add := func(name string, labels []*dto.LabelPair, extra *dto.LabelPair, value float64) {
+		series = append(series, promtoolSeries{
+			Series: seriesNotation(name, labels, extra),
+			Values: fmt.Sprintf("%sx%d", strconv.FormatFloat(value, 'f', -1, 64), samples),
+		})
+	}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				add(family.GetName(), metric.Label, nil, metric.GetGauge().GetValue())
+			case dto.MetricType_COUNTER:
+				add(family.GetName(), metric.Label, nil, metric.GetCounter().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(family.GetName(), metric.Label, nil, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := metric.GetHistogram()
+				for _, bucket := range h.Bucket {
+					if !math.IsInf(bucket.GetUpperBound(), 1) {
+						le := strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+						add(family.GetName()+"_bucket", metric.Label, &dto.LabelPair{Name: proto.String("le"), Value: &le}, float64(bucket.GetCumulativeCount()))
+					}
+				}
+				add(family.GetName()+"_bucket", metric.Label, &dto.LabelPair{Name: proto.String("le"), Value: proto.String("+Inf")}, float64(h.GetSampleCount()))
+				add(family.GetName()+"_sum", metric.Label, nil, h.GetSampleSum())
+				add(family.GetName()+"_count", metric.Label, nil, float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// seriesNotation returns the series in the notation of PromQL, e.g. name{namespace_name="default"}.
+func seriesNotation(name string, labels []*dto.LabelPair, extra *dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels)+1)
+	for _, label := range labels {
+		pairs = append(pairs, label.GetName()+"="+strconv.Quote(label.GetValue()))
+	}
+	if extra != nil {
+		pairs = append(pairs, extra.GetName()+"="+strconv.Quote(extra.GetValue()))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
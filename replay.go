@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"k8s-ephemeral-storage-metrics/pkg/fakekubelet"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// startReplayKubelet starts a fake kubelet, which also serves as api server like the one of -dev-mode, serving the
+// stat summaries recorded with -record-dir in dir, the directory of a node named after it. Each request is served
+// the next summary, so that every scrape replays one recorded request whatever the interval, and the last one once
+// they are exhausted.
+func startReplayKubelet(ctx context.Context, dir string) (*fakekubelet.Server, *rest.Config, error) {
+	dir = filepath.Clean(dir)
+	files, err := provider.RecordedSummaries(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no recorded stat summaries in %s, which should be the directory of a node in -record-dir", dir)
+	}
+	kubelet := fakekubelet.NewServer(fakekubelet.Options{NodeName: filepath.Base(dir)})
+	var lock sync.Mutex
+	next := 0
+	kubelet.SetPayloadSource(func() ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		file := files[len(files)-1]
+		if next < len(files) {
+			file = files[next]
+			next++
+			if next == len(files) {
+				klog.Infof("Replayed the %d recorded stat summaries, serving the last one from now on", len(files))
+			}
+		}
+		klog.V(1).InfoS("Replaying stat summary", "file", file)
+		return os.ReadFile(file)
+	})
+	go func() {
+		<-ctx.Done()
+		kubelet.Close()
+	}()
+	klog.Infof("Replaying %d stat summaries of node %s from %s at %s", len(files), kubelet.NodeName(), dir, kubelet.URL)
+	return kubelet, &rest.Config{Host: kubelet.URL}, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"k8s-ephemeral-storage-metrics/pkg/collector"
+	"k8s-ephemeral-storage-metrics/pkg/fakekubelet"
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// selftestPods is the number of pods of the fake kubelet of selftest.
+const selftestPods = 5
+
+// selftest runs the collection of the exporter against a fake kubelet, scrapes its own metrics endpoint and checks
+// the series, so that a build or an image can be smoke tested without a cluster. Collectors are selected with the
+// -collector flags. It returns a non-zero exit code if any check failed.
+func selftest() int {
+	kubelet := fakekubelet.NewServer(fakekubelet.Options{Pods: selftestPods, ContainersPerPod: 2, VolumesPerPod: 1})
+	defer kubelet.Close()
+
+	results := []preflight.Result{}
+	families, err := selftestScrape(kubelet)
+	results = append(results, preflight.Result{Name: "scrape metrics endpoint", Err: err, Hint: "the exporter failed to collect or expose the stats of the fake kubelet"})
+	if err == nil {
+		results = append(results, selftestChecks(families, kubelet.NodeName())...)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.OK() {
+			fmt.Printf("[OK]   %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("[FAIL] %s: %v\n       hint: %s\n", result.Name, result.Err, result.Hint)
+	}
+	if failed > 0 {
+		fmt.Printf("%d check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// selftestScrape fetches the stats of kubelet once and returns the families served by the metrics handler.
+func selftestScrape(kubelet *fakekubelet.Server) (map[string]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: kubelet.URL})
+	if err != nil {
+		return nil, err
+	}
+	m := provider.NewManager(cli, provider.Options{
+		NodeName:       kubelet.NodeName(),
+		Interval:       time.Second,
+		KeepContainers: enabledCollectors["container"] || enabledCollectors["source"],
+		KeepVolumes:    enabledCollectors["volume"] || enabledCollectors["source"],
+	})
+	if err := m.Update(ctx); err != nil {
+		return nil, fmt.Errorf("failed to fetch stat summary: %v", err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector.NewEphemeralStorageCollector(m, collector.Options{Collectors: enabledCollectors}))
+
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, metricsHandlerOpts()))
+	defer srv.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics endpoint responded %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+func selftestChecks(families map[string]*dto.MetricFamily, node string) []preflight.Result {
+	value := func(name string) (float64, error) {
+		family, ok := families["ephemeral_storage_"+name]
+		if !ok || len(family.Metric) == 0 {
+			return 0, fmt.Errorf("missing ephemeral_storage_%s", name)
+		}
+		return family.Metric[0].GetGauge().GetValue(), nil
+	}
+	check := func(name string, f func() error) preflight.Result {
+		return preflight.Result{Name: name, Err: f(), Hint: "the exporter exposes wrong series, report a bug"}
+	}
+
+	results := []preflight.Result{
+		check("kubelet_up is 1", func() error {
+			up, err := value("kubelet_up")
+			if err == nil && up != 1 {
+				err = fmt.Errorf("got %v", up)
+			}
+			return err
+		}),
+		check("scrape_error is 0", func() error {
+			failed, err := value("scrape_error")
+			if err == nil && failed != 0 {
+				err = fmt.Errorf("got %v", failed)
+			}
+			return err
+		}),
+		check("values are finite and not negative", func() error {
+			for name, family := range families {
+				if !strings.HasPrefix(name, "ephemeral_storage_") || family.GetType() != dto.MetricType_GAUGE {
+					continue
+				}
+				for _, metric := range family.Metric {
+					if v := metric.GetGauge().GetValue(); math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+						return fmt.Errorf("%s is %v", name, v)
+					}
+				}
+			}
+			return nil
+		}),
+	}
+	if enabledCollectors["pod"] {
+		results = append(results, check(fmt.Sprintf("pod_used_bytes of %d pods of node %s", selftestPods, node), func() error {
+			family, ok := families["ephemeral_storage_pod_used_bytes"]
+			if !ok {
+				return fmt.Errorf("missing ephemeral_storage_pod_used_bytes")
+			}
+			if len(family.Metric) != selftestPods {
+				return fmt.Errorf("got %d series", len(family.Metric))
+			}
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "node_name" && label.GetValue() != node {
+						return fmt.Errorf("got node_name %q", label.GetValue())
+					}
+				}
+			}
+			return nil
+		}))
+	}
+	if enabledCollectors["nodefs"] {
+		results = append(results, check("node_fs_used_bytes is at most node_fs_capacity_bytes", func() error {
+			used, err := value("node_fs_used_bytes")
+			if err != nil {
+				return err
+			}
+			capacity, err := value("node_fs_capacity_bytes")
+			if err != nil {
+				return err
+			}
+			if used > capacity {
+				return fmt.Errorf("used %v > capacity %v", used, capacity)
+			}
+			return nil
+		}))
+	}
+	return results
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-ephemeral-storage-metrics/pkg/preflight"
+	"k8s-ephemeral-storage-metrics/pkg/provider"
+)
+
+// validateKubelet fetches the stat summary of the node once and prints the fields the exporter reads that are
+// missing in the node or a pod, to diagnose pods without metrics on kubelets and container runtimes that omit
+// fields. It returns a non-zero exit code if any field is missing.
+func validateKubelet() int {
+	cfg, err := restConfig()
+	if err != nil {
+		fmt.Printf("[FAIL] api server client: %v\n", err)
+		return 1
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		fmt.Printf("[FAIL] api server client: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	node, err := resolveNodeName(ctx, cli)
+	if err != nil {
+		fmt.Printf("[FAIL] node name: %v\n", err)
+		return 1
+	}
+	kubelet, err := kubeletClient(cli, cfg)
+	if err != nil {
+		fmt.Printf("[FAIL] kubelet client: %v\n", err)
+		return 1
+	}
+	summary, err := preflight.FetchSummary(ctx, cli, kubelet, node)
+	if err != nil {
+		fmt.Printf("[FAIL] kubelet stat summary of node %s: %v\n", node, err)
+		return 1
+	}
+	source := provider.DetectSource(summary, "")
+	fmt.Printf("node %s: %d pods, %s stats\n", node, len(summary.Pods), source)
+	fmt.Printf("storage fields: %s\n", provider.SummaryFields(summary))
+
+	missing, skipped := 0, 0
+	for _, fields := range preflight.ValidateSummary(summary, source) {
+		switch {
+		case len(fields.Missing) == 0:
+			fmt.Printf("[OK]   %s\n", fields.Object)
+			continue
+		case fields.Skipped:
+			skipped++
+			fmt.Printf("[SKIP] %s: missing %s\n       no stats of the pod are exported\n", fields.Object, strings.Join(fields.Missing, ", "))
+		default:
+			fmt.Printf("[MISS] %s: missing %s\n", fields.Object, strings.Join(fields.Missing, ", "))
+		}
+		missing++
+	}
+	if missing > 0 {
+		fmt.Printf("%d object(s) with missing fields, %d pod(s) skipped\n", missing, skipped)
+		return 1
+	}
+	return 0
+}